@@ -0,0 +1,70 @@
+package migo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BatchPlaceholder in a statement of a "-- +batch" migration is replaced
+// by the batch size, so a backfill can limit every batch:
+//
+//	UPDATE users SET email = lower(email)
+//	WHERE id IN (SELECT id FROM users WHERE email <> lower(email) LIMIT :batch_size);
+const BatchPlaceholder = ":batch_size"
+
+// parseBatch applies the options of a "-- +batch" directive. Batches
+// commit one at a time, so the migration runs outside a transaction.
+func (m *Migration) parseBatch(options string) error {
+	for _, f := range strings.Fields(options) {
+		key, value, _ := strings.Cut(f, "=")
+		switch key {
+		case "size":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("size must be a positive number, got %q", value)
+			}
+			m.BatchSize = n
+		case "sleep":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("sleep must be a duration such as 100ms, got %q", value)
+			}
+			m.BatchSleep = d
+		default:
+			return fmt.Errorf("unknown option %q", f)
+		}
+	}
+	if m.BatchSize == 0 {
+		return errors.New("size is required")
+	}
+	m.Transactional = false
+	return nil
+}
+
+// execBatches runs query, the statement of p at line, again and again
+// until it affects no rows, sleeping BatchSleep between batches. It
+// returns the rows of all batches.
+func (mg *Migrator) execBatches(ctx context.Context, e RowsExecer, p PlannedMigration, query string, line int) (int64, error) {
+	m := p.migration
+	query = strings.ReplaceAll(query, BatchPlaceholder, strconv.Itoa(m.BatchSize))
+	var total int64
+	for batch := 1; ; batch++ {
+		rows, err := e.ExecRows(ctx, query)
+		total += rows
+		if err != nil || rows == 0 {
+			return total, err
+		}
+		mg.log().Info("Batch applied", "version", p.Version, "name", p.Name, "line", line, "batch", batch, "rows", rows, "total", total)
+		if m.BatchSleep > 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(m.BatchSleep):
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package migo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChecksumMode selects the checksum applied migrations are validated
+// against. The SHA256 of the whole file is always recorded.
+type ChecksumMode string
+
+const (
+	// ChecksumFile validates the SHA256 of the whole file, so any edit to
+	// an applied migration is a mismatch. It is the default.
+	ChecksumFile ChecksumMode = ""
+	// ChecksumNormalized validates a checksum of the statements with
+	// comments removed and whitespace collapsed, so reformatting or fixing
+	// a comment is accepted. Directives such as -- +notransaction still
+	// count.
+	ChecksumNormalized ChecksumMode = "normalized"
+	// ChecksumUp validates the SHA256 of the up section only, its -- +verify
+	// queries included, so the down section of an applied migration can
+	// still be fixed.
+	ChecksumUp ChecksumMode = "up"
+)
+
+// validationChecksum returns the checksum of m recorded and validated
+// under mode, prefixed with the mode. It is empty for ChecksumFile, which
+// validates m.Checksum. It must be computed on the raw sections, before
+// templates and interpolation.
+func validationChecksum(mode ChecksumMode, m *Migration) (string, error) {
+	switch mode {
+	case ChecksumFile:
+		return "", nil
+	case ChecksumNormalized:
+		var b strings.Builder
+		sections := []string{m.UpSQL, m.DownSQL}
+		if m.VerifySQL != "" {
+			sections = append(sections, m.VerifySQL) // last, so files without one keep their checksum
+		}
+		for _, section := range sections {
+			for _, stmt := range splitStatements(section) {
+				b.WriteString(stmt.code + ";\n")
+			}
+			for _, line := range strings.Split(section, "\n") {
+				if line = strings.TrimSpace(line); strings.HasPrefix(line, "-- +") {
+					b.WriteString(line + "\n")
+				}
+			}
+			b.WriteString("-- +down\n")
+		}
+		hash := sha256.Sum256([]byte(b.String()))
+		return string(mode) + ":" + hex.EncodeToString(hash[:]), nil
+	case ChecksumUp:
+		up := m.UpSQL
+		if m.VerifySQL != "" {
+			up += "\n-- +verify\n" + m.VerifySQL // the verify section belongs to the up section
+		}
+		hash := sha256.Sum256([]byte(up))
+		return string(mode) + ":" + hex.EncodeToString(hash[:]), nil
+	}
+	return "", fmt.Errorf("unknown checksum mode %q", mode)
+}
+
+// checksumMatches reports whether m is unchanged since r was recorded:
+// either the validation checksum recorded in r matches, or the file is
+// byte for byte the same.
+func checksumMatches(r Record, m *Migration) bool {
+	if m.validation != "" && r.ValidationChecksum == m.validation {
+		return true
+	}
+	return r.Checksum == m.Checksum
+}
+
+// recordValidationChecksums adds the validation checksum to the rows of
+// done migrations whose file is unchanged but that were recorded without
+// it, e.g. before the mode was enabled, so edits the mode accepts are
+// accepted for them too.
+func (mg *Migrator) recordValidationChecksums(ctx context.Context, migrations []*Migration, records map[int64]Record) error {
+	var stale []Record
+	for _, m := range migrations {
+		r, ok := records[m.Version]
+		if ok && r.Done() && m.validation != "" && r.ValidationChecksum != m.validation && r.Checksum == m.Checksum {
+			r.ValidationChecksum = m.validation
+			stale = append(stale, r)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	sess, err := mg.drv.Session(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	for _, r := range stale {
+		if err := sess.SaveRecord(ctx, r); err != nil {
+			return err
+		}
+		records[r.Version] = r
+	}
+	mg.log().Info("Recorded validation checksums", "mode", mg.opts.Checksum, "count", len(stale))
+	return nil
+}
+
+// recordIgnoredChecksums warns about the done migrations whose file
+// changed when Options.IgnoreChecksum lets the run proceed anyway, and
+// records the override in the audit history of each.
+func (mg *Migrator) recordIgnoredChecksums(ctx context.Context, migrations []*Migration, records map[int64]Record) error {
+	if !mg.opts.IgnoreChecksum {
+		return nil
+	}
+	var changed []*Migration
+	for _, m := range migrations {
+		if r, ok := records[m.Version]; ok && r.Done() && !checksumMatches(r, m) {
+			changed = append(changed, m)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	versions := make([]int64, len(changed))
+	for i, m := range changed {
+		versions[i] = m.Version
+	}
+	mg.log().Warn("IGNORING CHECKSUM MISMATCHES: applied migration files changed, proceeding anyway", "count", len(changed), "versions", versions)
+	sess, err := mg.drv.Session(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	for _, m := range changed {
+		mg.log().Warn("Checksum mismatch ignored", "version", m.Version, "name", m.Name, "recorded", records[m.Version].Checksum, "file", m.Checksum)
+		if err := mg.audit(ctx, sess, m, HistoryIgnoreChecksum, time.Time{}, nil); err != nil {
+			return fmt.Errorf("failed to record history of migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package migo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock tells the time used for new migration versions, applied_at values,
+// durations and events. Tests and reproducible builds can pass a fixed or
+// stepping clock to get deterministic output.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator returns the IDs that identify runs in events.
+type IDGenerator interface {
+	NewID() string
+}
+
+// SystemClock is the wall clock, used when Options.Clock is nil.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FixedClock returns a Clock that always reports t.
+func FixedClock(t time.Time) Clock {
+	return fixedClock(t)
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// RandomIDs generates random 128-bit hex IDs, used when Options.IDs is nil.
+var RandomIDs IDGenerator = randomIDs{}
+
+type randomIDs struct{}
+
+func (randomIDs) NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SequentialIDs returns an IDGenerator producing prefix-1, prefix-2, ...
+func SequentialIDs(prefix string) IDGenerator {
+	return &sequentialIDs{prefix: prefix}
+}
+
+type sequentialIDs struct {
+	mu     sync.Mutex
+	prefix string
+	n      int
+}
+
+func (s *sequentialIDs) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	return fmt.Sprintf("%s-%d", s.prefix, s.n)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultBackupDir = "backups"
+
+// BackupConfig controls the backups taken by up --backup. Command replaces
+// pg_dump; "{path}" in its arguments is replaced by the archive path, which
+// is also passed as MIGO_BACKUP_PATH.
+type BackupConfig struct {
+	Dir     string   `yaml:"dir"` // defaults to ./backups
+	Command []string `yaml:"command"`
+}
+
+// backup writes a restore point of the database to a new archive in
+// cfg.Dir and returns its path. Credentials are passed through the PG*
+// environment variables, also to a custom command.
+func backup(ctx context.Context, cfg BackupConfig, pgDump string, connDSN func(context.Context) (string, error)) (string, error) {
+	dsn, err := connDSN(ctx)
+	if err != nil {
+		return "", err
+	}
+	env, err := pgEnv(dsn)
+	if err != nil {
+		return "", err
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		dir = defaultBackupDir
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	path := filepath.Join(dir, "migo-"+time.Now().UTC().Format("20060102T150405Z")+".dump")
+
+	args := cfg.Command
+	if len(args) == 0 {
+		if pgDump == "" {
+			pgDump = "pg_dump"
+		}
+		args = []string{pgDump, "--format=custom", "--file={path}"}
+	}
+	argv := make([]string, len(args))
+	for i, a := range args {
+		argv[i] = strings.ReplaceAll(a, "{path}", path)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(append(os.Environ(), env...), "MIGO_BACKUP_PATH="+path)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("backup command %s failed: %v: %s", argv[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return path, nil
+}
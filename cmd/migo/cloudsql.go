@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	sqlAdminAPI   = "https://sqladmin.googleapis.com/sql/v1beta4"
+	cloudSQLPort  = "3307" // server-side proxy port of Cloud SQL instances
+	cloudSQLScope = "https://www.googleapis.com/auth/sqlservice.admin"
+	cloudSQLLogin = "https://www.googleapis.com/auth/sqlservice.login"
+	// certRefreshMargin is how long before expiry an ephemeral certificate
+	// is replaced.
+	certRefreshMargin = 4 * time.Minute
+)
+
+// cloudSQL connects to a Cloud SQL instance the way the Cloud SQL Auth
+// Proxy does, without running it: it requests an ephemeral client
+// certificate from the SQL Admin API and opens TLS connections to the
+// instance's server-side proxy. Credentials are Application Default
+// Credentials, e.g. the service account of Cloud Build or Cloud Run.
+type cloudSQL struct {
+	dsn                       string
+	project, region, instance string
+	iam                       bool // automatic IAM database authentication
+	privateIP                 bool
+	ts                        oauth2.TokenSource
+	client                    *http.Client
+	key                       *rsa.PrivateKey
+
+	mu      sync.Mutex
+	tls     *tls.Config
+	addr    string
+	expires time.Time
+}
+
+// newCloudSQL prepares connections to instance, a connection name of the
+// form project:region:instance. dsn names the database user and database;
+// with iam the user is the IAM principal and no password is used.
+func newCloudSQL(ctx context.Context, dsn, instance string, iam, privateIP bool) (*cloudSQL, error) {
+	parts := strings.Split(instance, ":")
+	if len(parts) < 3 {
+		return nil, errors.New(msg("invalid Cloud SQL instance %q, expected project:region:instance", instance))
+	}
+	n := len(parts)
+	ts, err := google.DefaultTokenSource(ctx, cloudSQLScope, cloudSQLLogin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Google credentials: %w", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudSQL{
+		dsn:       dsn,
+		project:   strings.Join(parts[:n-2], ":"),
+		region:    parts[n-2],
+		instance:  parts[n-1],
+		iam:       iam,
+		privateIP: privateIP,
+		ts:        ts,
+		client:    oauth2.NewClient(ctx, ts),
+		key:       key,
+	}, nil
+}
+
+func (c *cloudSQL) Connect(ctx context.Context) (driver.Conn, error) {
+	_, addr, err := c.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The dialer provides TLS, so the PostgreSQL protocol runs unencrypted
+	// inside it.
+	dsn, err := setDSNParam(c.dsn, "host", addr)
+	if err == nil {
+		dsn, err = setDSNParam(dsn, "sslmode", "disable")
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newConnector(dsn, c)
+	if err != nil {
+		return nil, err
+	}
+	return conn.Connect(ctx)
+}
+
+func (c *cloudSQL) Driver() driver.Driver {
+	return sqlDriverImpl()
+}
+
+func (c *cloudSQL) Dial(network, address string) (net.Conn, error) {
+	return c.DialContext(context.Background(), network, address)
+}
+
+func (c *cloudSQL) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.DialContext(ctx, network, address)
+}
+
+// DialContext opens a TLS connection to the instance, whatever address
+// the driver asks for.
+func (c *cloudSQL) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	cfg, addr, err := c.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addr, cloudSQLPort))
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("Cloud SQL TLS handshake failed: %w", err)
+	}
+	return conn, nil
+}
+
+// config returns the TLS configuration and address of the instance,
+// refreshing the ephemeral certificate shortly before it expires.
+func (c *cloudSQL) config(ctx context.Context) (*tls.Config, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tls != nil && time.Until(c.expires) > certRefreshMargin {
+		return c.tls, c.addr, nil
+	}
+
+	var settings struct {
+		IPAddresses []struct {
+			Type      string `json:"type"`
+			IPAddress string `json:"ipAddress"`
+		} `json:"ipAddresses"`
+		ServerCACert struct {
+			Cert string `json:"cert"`
+		} `json:"serverCaCert"`
+		DNSName      string `json:"dnsName"`
+		ServerCAMode string `json:"serverCaMode"`
+	}
+	if err := c.call(ctx, http.MethodGet, "connectSettings", nil, &settings); err != nil {
+		return nil, "", err
+	}
+	want := "PRIMARY"
+	if c.privateIP {
+		want = "PRIVATE"
+	}
+	addr := ""
+	for _, ip := range settings.IPAddresses {
+		if ip.Type == want {
+			addr = ip.IPAddress
+		}
+	}
+	if addr == "" {
+		return nil, "", errors.New(msg("Cloud SQL instance %s has no %s IP address", c.instance, strings.ToLower(want)))
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&c.key.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	req := map[string]string{"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pub}))}
+	if c.iam {
+		tok, err := c.ts.Token()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get Google access token: %w", err)
+		}
+		req["access_token"] = strings.TrimRight(tok.AccessToken, ".")
+	}
+	var ephemeral struct {
+		EphemeralCert struct {
+			Cert string `json:"cert"`
+		} `json:"ephemeralCert"`
+	}
+	if err := c.call(ctx, http.MethodPost, ":generateEphemeralCert", req, &ephemeral); err != nil {
+		return nil, "", err
+	}
+
+	certBlock, _ := pem.Decode([]byte(ephemeral.EphemeralCert.Cert))
+	if certBlock == nil {
+		return nil, "", errors.New("Cloud SQL returned an invalid client certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(settings.ServerCACert.Cert)) {
+		return nil, "", errors.New("Cloud SQL returned an invalid server CA certificate")
+	}
+
+	c.tls = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: c.key, Leaf: cert}},
+		MinVersion:   tls.VersionTLS13,
+		// Server certificates name the instance rather than its address,
+		// so the chain and name are verified by hand.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyServer(raw, roots, settings.DNSName, settings.ServerCAMode)
+		},
+	}
+	c.addr = addr
+	c.expires = cert.NotAfter
+	return c.tls, c.addr, nil
+}
+
+// verifyServer checks the server certificate chains to the instance's CA
+// and names the instance: by project:instance for per-instance CAs, by DNS
+// name for shared ones.
+func (c *cloudSQL) verifyServer(raw [][]byte, roots *x509.CertPool, dnsName, caMode string) error {
+	if len(raw) == 0 {
+		return errors.New("Cloud SQL server sent no certificate")
+	}
+	certs := make([]*x509.Certificate, len(raw))
+	for i, r := range raw {
+		cert, err := x509.ParseCertificate(r)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := certs[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return err
+	}
+	if caMode == "" || caMode == "GOOGLE_MANAGED_INTERNAL_CA" {
+		if name := c.project + ":" + c.instance; leaf.Subject.CommonName != name {
+			return fmt.Errorf("Cloud SQL server certificate is for %q, expected %q", leaf.Subject.CommonName, name)
+		}
+		return nil
+	}
+	return leaf.VerifyHostname(strings.TrimSuffix(dnsName, "."))
+}
+
+// call calls the SQL Admin API method of the instance.
+func (c *cloudSQL) call(ctx context.Context, method, path string, in, out any) error {
+	endpoint := fmt.Sprintf("%s/projects/%s/instances/%s", sqlAdminAPI, url.PathEscape(c.project), url.PathEscape(c.instance))
+	if strings.HasPrefix(path, ":") {
+		endpoint += path
+	} else {
+		endpoint += "/" + path
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SQL Admin API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SQL Admin API %s returned %s: %s", path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"slices"
+	"strings"
+
+	"github.com/bagastri07/migo"
+)
+
+// command describes a CLI command. The table drives parsing, the usage
+// message and shell completion, so a command's flags are declared once.
+type command struct {
+	name     string
+	sub      string // required subcommand, e.g. "dump" for schema
+	usage    string // arguments shown in usage messages
+	summary  string
+	minArgs  int                    // positional arguments required after the command
+	flags    func(fs *flag.FlagSet) // binds the command's flags, if any
+	versions bool                   // positional arguments are migration versions
+	choices  []string               // values of the first positional argument
+}
+
+// Flags of the individual commands, bound by the command table.
+var (
+	lintAll         bool
+	expectPlan      string
+	serveHealth     string
+	keepServing     bool
+	planFormat      string
+	planCheck       bool
+	planOutput      string
+	scriptOutput    string
+	driftSchema     string
+	scratchDSN      string
+	diffFrom        string
+	diffTo          string
+	diffSchema      string
+	diffPrint       bool
+	genDownWrite    bool
+	schemaOutput    string
+	team            string
+	tenants         TenantsConfig
+	continueOnError bool
+	upLimit         int
+	downSteps       int
+	strictGaps      bool
+	ignoreChecksum  bool
+	fake            bool
+	takeBackup      bool
+	atomicRun       bool
+	parallel        int
+	tagFilter       migo.TagFilter
+	infoVerbose     bool
+	createEdit      bool
+	createUTC       bool
+	createLocal     bool
+)
+
+func upFlags(fs *flag.FlagSet) {
+	fs.StringVar(&expectPlan, "expect-plan", "", "Fail unless the run matches this file from `plan --format json`")
+	fs.StringVar(&serveHealth, "serve-health", "", "Serve /healthz and /readyz on this address, e.g. :8080")
+	fs.BoolVar(&keepServing, "keep-serving", false, "Keep serving the health endpoints after the run until terminated")
+	teamFlag(fs)
+	tagsFlags(fs)
+	fs.StringVar(&tenants.Pattern, "tenants", "", "Migrate every schema whose name is LIKE this pattern, each with its own bookkeeping, e.g. tenant_%")
+	fs.StringVar(&tenants.Query, "tenant-query", "", "Migrate the schemas this query returns, one name per row")
+	fs.IntVar(&upLimit, "limit", 0, "Apply at most this many pending migrations, oldest first")
+	fs.IntVar(&upLimit, "steps", 0, "Same as --limit")
+	fs.BoolVar(&continueOnError, "continue-on-error", false, "Keep migrating the remaining tenants or shards after one fails")
+	strictGapsFlag(fs)
+	fs.BoolVar(&ignoreChecksum, "ignore-checksum", false, "Proceed past applied migrations whose file changed, warning and recording the override in the audit history")
+	fs.BoolVar(&atomicRun, "atomic", false, "Apply all pending migrations in one transaction, rolling every one back if any fails")
+	fs.IntVar(&parallel, "parallel", 0, "Apply up to this many consecutive migrations marked -- +parallel at once")
+	fs.BoolVar(&takeBackup, "backup", false, "Back up the database with pg_dump (or backup.command in the config) before applying migrations")
+	fs.BoolVar(&fake, "fake", false, "Record the pending migrations as applied without executing them, e.g. after applying them by hand")
+}
+
+func strictGapsFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&strictGaps, "strict-gaps", false, "Refuse to run when an old migration was never applied or an applied one has no file")
+}
+
+func tagsFlags(fs *flag.FlagSet) {
+	fs.Func("tags", "Comma-separated tags selecting migrations; !tag leaves out the ones tagged tag, e.g. '!slow'", func(s string) error {
+		for _, tag := range strings.Split(s, ",") {
+			if tag = strings.TrimSpace(tag); strings.HasPrefix(tag, "!") {
+				tagFilter.Exclude = append(tagFilter.Exclude, tag[1:])
+			} else if tag != "" {
+				tagFilter.Only = append(tagFilter.Only, tag)
+			}
+		}
+		return nil
+	})
+	fs.Func("only-tags", "Only include migrations with one of these comma-separated tags", func(s string) error {
+		for _, tag := range strings.Split(s, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tagFilter.Only = append(tagFilter.Only, tag)
+			}
+		}
+		return nil
+	})
+}
+
+func teamFlag(fs *flag.FlagSet) {
+	fs.StringVar(&team, "team", "", "Only include migrations touching this team's tables (see ownership in the config)")
+}
+
+var commands = []*command{
+	{name: "create", usage: "[--edit] [--utc|--local] <name>", summary: "Create new migration file", minArgs: 1, flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&createEdit, "edit", false, "Open the new file in $VISUAL or $EDITOR")
+		fs.BoolVar(&createUTC, "utc", false, "Take the version from the time in UTC (the default)")
+		fs.BoolVar(&createLocal, "local", false, "Take the version from the local time")
+	}},
+	{name: "up", usage: "[--expect-plan plan.json] [--serve-health addr] [--team name] [--tags list] [--limit n] [--tenants pattern] [--continue-on-error] [--strict-gaps] [--ignore-checksum] [--fake] [--backup] [--atomic] [--parallel n]", summary: "Apply all pending migrations", flags: upFlags},
+	{name: "up-to", usage: "[--expect-plan plan.json] [--team name] [--tags list] [--limit n] [--tenants pattern] [--continue-on-error] [--strict-gaps] [--ignore-checksum] [--fake] [--backup] [--atomic] [--parallel n] <version>", summary: "Apply migrations up to specific version", minArgs: 1, flags: upFlags, versions: true},
+	{name: "up-by-one", usage: "[--team name] [--strict-gaps]", summary: "Apply only the next pending migration and print its version", flags: func(fs *flag.FlagSet) {
+		teamFlag(fs)
+		strictGapsFlag(fs)
+	}},
+	{name: "down", usage: "[--steps n]", summary: "Rollback the last migration", flags: func(fs *flag.FlagSet) {
+		fs.IntVar(&downSteps, "steps", 1, "Roll back the last n applied migrations, newest first, after a preview and confirmation")
+	}},
+	{name: "down-to", usage: "<version>", summary: "Roll back every migration newer than version", minArgs: 1, versions: true},
+	{name: "reset", summary: "Roll back every applied migration"},
+	{name: "baseline", usage: "<version>", summary: "Mark migrations up to version as applied without running them", minArgs: 1, versions: true},
+	{name: "mark-applied", usage: "<version>...", summary: "Record migrations as applied without executing them", minArgs: 1, versions: true},
+	{name: "squash", usage: "<from-version> <to-version> [name]", summary: "Consolidate a range of migrations into one file", minArgs: 2, versions: true},
+	{name: "gen-down", usage: "[--write] <version>", summary: "Draft the down section of a migration from its up DDL", minArgs: 1, versions: true, flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&genDownWrite, "write", false, "Write the draft into the file when its down section is empty, instead of printing it")
+	}},
+	{name: "plan", usage: "[--format text|json] [--check] [--output plan.sql] [--team name] [--tags list] [--strict-gaps] [version]", summary: "Show pending migrations without applying them", versions: true, flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&planFormat, "format", "text", "Output format: text or json")
+		fs.BoolVar(&planCheck, "check", false, "Exit with status 2 when migrations are pending")
+		fs.StringVar(&planOutput, "output", "", "Also write the SQL of the planned migrations and hooks, with version headers, to this file")
+		teamFlag(fs)
+		tagsFlags(fs)
+		strictGapsFlag(fs)
+	}},
+	{name: "script", usage: "[--output migrate.sql] [--team name] [--tags list] [--strict-gaps] [version]", summary: "Write pending migrations and their bookkeeping as a standalone SQL script", versions: true, flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&scriptOutput, "output", "", "Write the script to this file instead of standard output")
+		teamFlag(fs)
+		tagsFlags(fs)
+		strictGapsFlag(fs)
+	}},
+	{name: "lint", usage: "[--all]", summary: "Check pending migrations for dangerous operations", flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&lintAll, "all", false, "Lint every migration, not only pending ones")
+	}},
+	{name: "preflight", summary: "Check the server version, extensions, privileges and database name"},
+	{name: "drift", usage: "[--schema name] [--scratch-dsn dsn]", summary: "Compare the live schema against the applied migrations", flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&driftSchema, "schema", "public", "Schema to compare against the migrations")
+		fs.StringVar(&scratchDSN, "scratch-dsn", "", "Database to replay migrations on (required with --read-only)")
+	}},
+	{name: "diff", usage: "--from <dsn> --to <dsn> [--schema name] [--print] [name]", summary: "Generate a migration making one database's schema match another's", flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&diffFrom, "from", "", "Database whose schema the migration starts from, e.g. production")
+		fs.StringVar(&diffTo, "to", "", "Database whose schema the migration produces, e.g. a prototype")
+		fs.StringVar(&diffSchema, "schema", "public", "Schema to compare")
+		fs.BoolVar(&diffPrint, "print", false, "Print the migration instead of creating a file")
+	}},
+	{name: "schema", sub: "dump", usage: "[--output schema.sql]", summary: "Write the database schema DDL to a file", flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&schemaOutput, "output", "", "File to write the schema to (default from config, then schema.sql)")
+	}},
+	{name: "serve", usage: "[--addr :8080] [--token-file file]", summary: "Serve the authenticated HTTP API", flags: serveFlags},
+	{name: "daemon", sub: "install", usage: "[--name migo] [--print] [-- command args...]", summary: "Install a systemd unit or Windows service running serve", flags: daemonFlags},
+	{name: "import", usage: "golang-migrate|goose [--from dir] [--table name] [--files-only]", summary: "Convert another tool's migrations and adopt its history", minArgs: 1, flags: importFlags, choices: []string{"golang-migrate", "goose"}},
+	{name: "watch", usage: "[--interval 500ms] [--debounce 300ms]", summary: "Apply pending migrations whenever the migration files change", flags: watchFlags},
+	{name: "tui", summary: "Browse, apply and roll back migrations in a terminal UI"},
+	{name: "info", usage: "[--verbose]", summary: "Show migration state and checksum validation", flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&infoVerbose, "verbose", false, "Also show who applied each migration: OS user, host, migo version and CI job")
+	}},
+	{name: "history", usage: "[--format text|json] [version]", summary: "Show the log of applies, rollbacks and failures", flags: historyFlags, versions: true},
+	{name: "completion", usage: "bash|zsh|fish", summary: "Print a shell completion script", minArgs: 1, choices: []string{"bash", "zsh", "fish"}},
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// commandNames returns "create|up|...|completion" for the usage message.
+func commandNames() string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return strings.Join(names, "|")
+}
+
+// usageError returns the usage message of c.
+func (c *command) usageError() error {
+	usage := "migo " + c.name
+	if c.sub != "" {
+		usage += " " + c.sub
+	}
+	if c.usage != "" {
+		usage += " " + c.usage
+	}
+	return errors.New(msg("usage: %s", usage))
+}
+
+// flagSet returns a flag set with the flags of c.
+func (c *command) flagSet() *flag.FlagSet {
+	name := c.name
+	if c.sub != "" {
+		name += " " + c.sub
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	return fs
+}
+
+// parseError converts a flag parsing error, already printed with the
+// usage by the flag package, into a silent exit. -h exits successfully.
+func parseError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return &exitError{code: exitOK}
+	}
+	return &exitError{code: exitFailure}
+}
+
+// parseCommand finds the command named by args[0], parses its flags and
+// returns its positional arguments.
+func parseCommand(args []string) (*command, []string, error) {
+	if len(args) < 1 {
+		return nil, nil, errors.New(msg("usage: %s", "migo ["+commandNames()+"]"))
+	}
+	c := lookupCommand(args[0])
+	if c == nil {
+		return nil, nil, errors.New(msg("unknown command: %s", args[0]))
+	}
+	args = args[1:]
+	if c.sub != "" {
+		if len(args) < 1 || args[0] != c.sub {
+			return nil, nil, c.usageError()
+		}
+		args = args[1:]
+	}
+	// A choice comes first like a subcommand, so flags can follow it
+	var choice []string
+	if len(args) > 0 && slices.Contains(c.choices, args[0]) {
+		choice, args = args[:1], args[1:]
+	}
+	fs := c.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, parseError(err)
+	}
+	args = append(choice, fs.Args()...)
+	if len(args) < c.minArgs {
+		return nil, nil, c.usageError()
+	}
+	return c, args, nil
+}
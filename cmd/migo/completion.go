@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// completion prints the completion script for shell. The scripts call
+// `migo completion versions` to complete migration versions from the
+// local migrations directories.
+func completion(shell string, cfg *Config, dirs []string) error {
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	case "versions":
+		migrations, err := cfg.loadMigrations(dirs)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			fmt.Println(m.Version)
+		}
+	default:
+		return errors.New(msg("unsupported shell %q, expected bash, zsh or fish", shell))
+	}
+	return nil
+}
+
+// completionFlag is a flag offered by the completion scripts.
+type completionFlag struct {
+	name, usage string
+	value       bool // takes a value in the next word
+}
+
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{name: "--" + f.Name, usage: f.Usage, value: !ok || !b.IsBoolFlag()})
+	})
+	return flags
+}
+
+// globalValueFlags returns the global flags taking a value, as a shell
+// case pattern, so the scripts can skip their values when looking for the
+// command.
+func globalValueFlags(sep string) string {
+	var names []string
+	for _, f := range completionFlags(flag.CommandLine) {
+		if f.value {
+			names = append(names, f.name, f.name[1:])
+		}
+	}
+	return strings.Join(names, sep)
+}
+
+func flagNames(flags []completionFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = f.name
+	}
+	return strings.Join(names, " ")
+}
+
+// words returns the non-flag words completed after c.
+func (c *command) words() string {
+	if c.sub != "" {
+		return c.sub
+	}
+	return strings.Join(c.choices, " ")
+}
+
+func bashCompletion() string {
+	var cases strings.Builder
+	for _, c := range commands {
+		versions := 0
+		if c.versions {
+			versions = 1
+		}
+		fmt.Fprintf(&cases, "\t%s) flags=%q words=%q versions=%d ;;\n", c.name, flagNames(completionFlags(c.flagSet())), c.words(), versions)
+	}
+	return fmt.Sprintf(`# bash completion for migo; load with: source <(migo completion bash)
+_migo() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" cmd="" i w
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		w="${COMP_WORDS[i]}"
+		case "$w" in
+		--*=*) ;;
+		%s) ((i++)) ;;
+		-*) ;;
+		*) cmd="$w"; break ;;
+		esac
+	done
+	if [[ -z "$cmd" ]]; then
+		if [[ "$cur" == -* ]]; then
+			COMPREPLY=($(compgen -W %q -- "$cur"))
+		else
+			COMPREPLY=($(compgen -W %q -- "$cur"))
+		fi
+		return
+	fi
+
+	local flags="" words="" versions=0
+	case "$cmd" in
+%s	esac
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+		return
+	fi
+	if ((versions)); then
+		words="$words $("${COMP_WORDS[0]}" "${COMP_WORDS[@]:1:i-1}" completion versions 2>/dev/null)"
+	fi
+	COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -F _migo migo
+`, globalValueFlags("|"), flagNames(completionFlags(flag.CommandLine)), strings.ReplaceAll(commandNames(), "|", " "), cases.String())
+}
+
+func zshCompletion() string {
+	var described, cases strings.Builder
+	for _, c := range commands {
+		fmt.Fprintf(&described, "\t\t\t\t%s\n", zshQuote(c.name+":"+c.summary))
+		fmt.Fprintf(&cases, "\t%s)\n", c.name)
+		for _, f := range completionFlags(c.flagSet()) {
+			fmt.Fprintf(&cases, "\t\tflags+=(%s)\n", zshQuote(f.name+":"+f.usage))
+		}
+		if w := c.words(); w != "" {
+			fmt.Fprintf(&cases, "\t\tchoices=(%s)\n", w)
+		}
+		if c.versions {
+			cases.WriteString("\t\tchoices+=(${(f)\"$(${words[1]} ${words[2,i-1]} completion versions 2>/dev/null)\"})\n")
+		}
+		cases.WriteString("\t\t;;\n")
+	}
+	var global strings.Builder
+	for _, f := range completionFlags(flag.CommandLine) {
+		fmt.Fprintf(&global, "\t\t\t\t%s\n", zshQuote(f.name+":"+f.usage))
+	}
+	return fmt.Sprintf(`#compdef migo
+# zsh completion for migo; load with: source <(migo completion zsh)
+_migo() {
+	local i w cmd=""
+	for ((i = 2; i < CURRENT; i++)); do
+		w="${words[i]}"
+		case "$w" in
+		--*=*) ;;
+		%s) ((i++)) ;;
+		-*) ;;
+		*) cmd="$w"; break ;;
+		esac
+	done
+	if [[ -z "$cmd" ]]; then
+		if [[ "${words[CURRENT]}" == -* ]]; then
+			local -a global=(
+%s			)
+			_describe 'flag' global
+		else
+			local -a cmds=(
+%s			)
+			_describe 'command' cmds
+		fi
+		return
+	fi
+
+	local -a flags choices
+	case "$cmd" in
+%s	esac
+	if [[ "${words[CURRENT]}" == -* ]]; then
+		(( ${#flags} )) && _describe 'flag' flags
+	else
+		(( ${#choices} )) && compadd -- $choices
+	fi
+}
+compdef _migo migo
+`, globalValueFlags("|"), global.String(), described.String(), cases.String())
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString(`# fish completion for migo; load with: migo completion fish | source
+function __migo_command
+	set -l tokens (commandline -opc)
+	set -e tokens[1]
+	set -l skip 0
+	for t in $tokens
+		if test $skip = 1
+			set skip 0
+			continue
+		end
+		switch $t
+			case '--*=*'
+			case ` + globalValueFlags(" ") + `
+				set skip 1
+			case '-*'
+			case '*'
+				echo $t
+				return
+		end
+	end
+	echo ''
+end
+
+function __migo_versions
+	set -l tokens (commandline -opc)
+	$tokens[1] completion versions 2>/dev/null
+end
+
+complete -c migo -f
+`)
+	for _, f := range completionFlags(flag.CommandLine) {
+		fmt.Fprintf(&b, "complete -c migo -n 'test -z (__migo_command)' -l %s -d %s%s\n", f.name[2:], fishQuote(f.usage), fishRequires(f))
+	}
+	for _, c := range commands {
+		fmt.Fprintf(&b, "complete -c migo -n 'test -z (__migo_command)' -a %s -d %s\n", c.name, fishQuote(c.summary))
+		cond := fmt.Sprintf("'test (__migo_command) = %s'", c.name)
+		for _, f := range completionFlags(c.flagSet()) {
+			fmt.Fprintf(&b, "complete -c migo -n %s -l %s -d %s%s\n", cond, f.name[2:], fishQuote(f.usage), fishRequires(f))
+		}
+		if w := c.words(); w != "" {
+			fmt.Fprintf(&b, "complete -c migo -n %s -a %s\n", cond, fishQuote(w))
+		}
+		if c.versions {
+			fmt.Fprintf(&b, "complete -c migo -n %s -a '(__migo_versions)'\n", cond)
+		}
+	}
+	return b.String()
+}
+
+func fishRequires(f completionFlag) string {
+	if f.value {
+		return " -r"
+	}
+	return ""
+}
+
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/bagastri07/migo"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigPath = "migo.yaml"
+
+// Config is the optional migo.yaml file. Flags and environment variables
+// take precedence over its values.
+type Config struct {
+	DSN         string            `yaml:"dsn"`
+	Driver      string            `yaml:"driver"` // pq or pgx, see --driver
+	TLS         TLSConfig         `yaml:"tls"`
+	Dir         dirList           `yaml:"dir"`    // one directory or a list
+	Source      string            `yaml:"source"` // e.g. s3:// or gs://bucket/migrations/, in place of dir
+	Interpolate bool              `yaml:"interpolate"`
+	Template    bool              `yaml:"template"`
+	Vars        map[string]string `yaml:"vars"`
+	Hooks       HooksConfig       `yaml:"hooks"`
+	Lint        LintConfig        `yaml:"lint"`
+	Schema      SchemaConfig      `yaml:"schema"`
+	Notify      NotifyConfig      `yaml:"notify"`
+	Ownership   migo.Ownership    `yaml:"ownership"` // team -> tables or schema.*
+	Tenants     TenantsConfig     `yaml:"tenants"`
+	Shards      []ShardConfig     `yaml:"shards"`
+	Components  []ComponentConfig `yaml:"components"`
+	Checksum    migo.ChecksumMode `yaml:"checksum"` // normalized or up, see migo.ChecksumMode
+	Flyway      bool              `yaml:"flyway"`   // Flyway file names and flyway_schema_history
+	StrictGaps  bool              `yaml:"strict_gaps"`
+	Retry       RetryConfig       `yaml:"retry"`
+	Backup      BackupConfig      `yaml:"backup"`
+	Protected   ProtectedConfig   `yaml:"protected"`
+	Preflight   PreflightConfig   `yaml:"preflight"`
+	Create      CreateConfig      `yaml:"create"`
+	Filename    FilenameConfig    `yaml:"filename"`
+	Signature   SignatureConfig   `yaml:"signature"`
+}
+
+// FilenameConfig is how migration files are named, see
+// migo.FilenameFormat.
+type FilenameConfig struct {
+	Pattern string `yaml:"pattern"` // e.g. "{version}__{name}.sql"
+	Width   int    `yaml:"width"`   // sequence numbers of this many digits instead of timestamps
+}
+
+// PreflightConfig lists the checks made before migrations run, see
+// migo.Preflight.
+type PreflightConfig struct {
+	ServerVersion string   `yaml:"server_version"` // e.g. ">=14, <18"
+	Extensions    []string `yaml:"extensions"`
+	Privileges    bool     `yaml:"privileges"`
+	Database      string   `yaml:"database"` // regular expression
+}
+
+func (p PreflightConfig) empty() bool {
+	return p.ServerVersion == "" && len(p.Extensions) == 0 && !p.Privileges && p.Database == ""
+}
+
+// NotifyConfig posts a summary of every up, up-to and down run. Webhook
+// receives the summary as JSON; Slack is a Slack incoming webhook URL.
+type NotifyConfig struct {
+	Environment  string `yaml:"environment"`
+	Webhook      string `yaml:"webhook"`
+	Slack        string `yaml:"slack"`
+	FailuresOnly bool   `yaml:"failures_only"`
+}
+
+// SchemaConfig controls schema dumps. When File is set, the schema is also
+// dumped there after every successful up, up-to and down.
+type SchemaConfig struct {
+	File   string `yaml:"file"`
+	PgDump string `yaml:"pg_dump"` // path to pg_dump, defaults to the one on PATH
+}
+
+// LintConfig overrides the severity (error, warning or off) of lint rules.
+type LintConfig struct {
+	Rules map[string]migo.Severity `yaml:"rules"`
+}
+
+// RetryConfig retries migrations failing with a transient error, see
+// migo.RetryPolicy. The --retry and --retry-backoff flags override it.
+type RetryConfig struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+	Codes    []string      `yaml:"codes"` // SQLSTATEs, defaults to migo.DefaultRetryCodes
+}
+
+// HooksConfig locates the hook scripts. Dir defaults to ./hooks; the
+// individual paths override the files found there.
+type HooksConfig struct {
+	Dir        string `yaml:"dir"`
+	BeforeAll  string `yaml:"before_all"`
+	AfterAll   string `yaml:"after_all"`
+	BeforeEach string `yaml:"before_each"`
+	AfterEach  string `yaml:"after_each"`
+}
+
+// loadConfig reads path. A missing file is only an error when the path was
+// given explicitly.
+func loadConfig(path string, explicit bool) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// dirList is a directory, or a list of them, in the config.
+type dirList []string
+
+func (d *dirList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*d = dirList{n.Value}
+		return nil
+	}
+	var dirs []string
+	if err := n.Decode(&dirs); err != nil {
+		return err
+	}
+	*d = dirs
+	return nil
+}
+
+// migrationDirs returns the migration directories, dirs from --dir or
+// else the config's. Commands writing new files use the first one.
+func (c *Config) migrationDirs(dirs []string) []string {
+	if len(dirs) == 0 {
+		dirs = c.Dir
+	}
+	if len(dirs) == 0 {
+		return []string{migo.DefaultDir}
+	}
+	return dirs
+}
+
+// shardDSNs returns the DSNs of the shards, for redaction.
+func (c *Config) shardDSNs() []string {
+	dsns := make([]string, len(c.Shards))
+	for i, s := range c.Shards {
+		dsns[i] = s.DSN
+	}
+	return dsns
+}
+
+// driver returns the Postgres driver for db, keeping the history where the
+// config says.
+func (c *Config) driver(db *sql.DB) *migo.Postgres {
+	if c.Flyway {
+		return migo.NewPostgres(db).WithFlywayHistory()
+	}
+	return migo.NewPostgres(db)
+}
+
+// loadMigrations reads the migrations in dirs, named the way the config
+// says.
+func (c *Config) loadMigrations(dirs []string) ([]*migo.Migration, error) {
+	sources := make([][]*migo.Migration, len(dirs))
+	for i, dir := range dirs {
+		var err error
+		if c.Flyway {
+			sources[i], err = migo.LoadFlywayMigrations(dir)
+		} else {
+			sources[i], err = c.filenameFormat().LoadMigrations(dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return migo.MergeMigrations(sources...)
+}
+
+func (c *Config) filenameFormat() migo.FilenameFormat {
+	return migo.FilenameFormat{Pattern: c.Filename.Pattern, Width: c.Filename.Width}
+}
+
+func (c *Config) loadHooks() (migo.Hooks, error) {
+	dir := c.Hooks.Dir
+	if dir == "" {
+		dir = migo.DefaultHooksDir
+	}
+	hooks, err := migo.LoadHooks(dir)
+	if err != nil {
+		return migo.Hooks{}, err
+	}
+
+	// A slice rather than a map keyed by path: the same script may serve
+	// several hooks.
+	for _, h := range []struct {
+		path string
+		dst  *string
+	}{
+		{c.Hooks.BeforeAll, &hooks.BeforeAll},
+		{c.Hooks.AfterAll, &hooks.AfterAll},
+		{c.Hooks.BeforeEach, &hooks.BeforeEach},
+		{c.Hooks.AfterEach, &hooks.AfterEach},
+	} {
+		if h.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(h.path)
+		if err != nil {
+			return migo.Hooks{}, fmt.Errorf("failed to read hook: %w", err)
+		}
+		*h.dst = string(data)
+	}
+	return hooks, nil
+}
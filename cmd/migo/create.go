@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CreateConfig holds the defaults of the create command.
+type CreateConfig struct {
+	Edit      bool `yaml:"edit"`       // open new migrations in $VISUAL or $EDITOR, when stdin is a terminal
+	LocalTime bool `yaml:"local_time"` // timestamp versions in local time instead of UTC
+}
+
+// relativePath returns path relative to the working directory, or path
+// itself when it can't be.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, abs); err == nil {
+		return rel
+	}
+	return path
+}
+
+// openEditor opens path in $VISUAL, or else $EDITOR, and waits for it to
+// exit. The variable may carry arguments, e.g. "code --wait". The editor
+// writes to stderr, so stdout only carries the path.
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	argv := strings.Fields(editor)
+	if len(argv) == 0 {
+		return errors.New(msg("set VISUAL or EDITOR to open the new migration"))
+	}
+	cmd := exec.Command(argv[0], append(argv[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", msg("editor %s failed", argv[0]), err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// pathFlags are global flags holding paths, made absolute in service
+// definitions since services don't start in the current directory.
+var pathFlags = []string{"config", "dsn-file", "env-file", "metrics-textfile"}
+
+// serviceArgs returns the global flags of the current invocation followed
+// by command, so the service runs with the same configuration. The DSN
+// itself is never written into a service definition.
+func serviceArgs(command []string, vars map[string]string) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--chdir", cwd}
+	var visitErr error
+	flag.Visit(func(f *flag.Flag) {
+		switch {
+		case f.Name == "chdir":
+			return
+		case f.Name == "dsn":
+			visitErr = errors.New(msg("refusing to write --dsn into a service definition; use --dsn-file or DATABASE_URL in the environment file"))
+			return
+		case f.Name == "var":
+			return // repeatable; added below from vars
+		}
+		v := f.Value.String()
+		if slices.Contains(pathFlags, f.Name) && v != "" {
+			v, _ = filepath.Abs(v)
+		}
+		args = append(args, "--"+f.Name+"="+v)
+	})
+	if visitErr != nil {
+		return nil, visitErr
+	}
+	for _, k := range slices.Sorted(maps.Keys(vars)) {
+		args = append(args, "--var="+k+"="+vars[k])
+	}
+	return append(args, command...), nil
+}
+
+var (
+	daemonName  string
+	daemonPrint bool
+)
+
+func daemonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&daemonName, "name", "migo", "Service name")
+	fs.BoolVar(&daemonPrint, "print", false, "Print the service definition instead of installing it")
+}
+
+// daemonInstall runs `daemon install [--name migo] [--print] [-- command
+// args...]`. The command defaults to serve.
+func daemonInstall(command []string, vars map[string]string) error {
+	if len(command) == 0 {
+		command = []string{"serve"}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	svcArgs, err := serviceArgs(command, vars)
+	if err != nil {
+		return err
+	}
+	return installService(daemonName, exe, svcArgs, daemonPrint)
+}
+
+// systemdUnit renders a systemd unit running exe with args. Secrets such as
+// DATABASE_URL and MIGO_API_TOKEN belong in the environment file.
+func systemdUnit(name, exe string, args []string) string {
+	cwd, _ := os.Getwd()
+	quoted := []string{systemdQuote(exe)}
+	for _, a := range args {
+		quoted = append(quoted, systemdQuote(a))
+	}
+	return fmt.Sprintf(`[Unit]
+Description=migo database migrations (%[1]s)
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+WorkingDirectory=%[2]s
+EnvironmentFile=-/etc/migo/%[1]s.env
+ExecStart=%[3]s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, name, cwd, strings.Join(quoted, " "))
+}
+
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$%;") {
+		return s
+	}
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%").Replace(s)
+	return `"` + s + `"`
+}
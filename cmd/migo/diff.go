@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bagastri07/migo"
+)
+
+// diff writes a migration making the schema of --from match --to into dir,
+// named f, or prints it with --print.
+func diff(ctx context.Context, f migo.FilenameFormat, dir, name string, clock migo.Clock) error {
+	if diffFrom == "" || diffTo == "" {
+		return errors.New(msg("diff needs both --from and --to"))
+	}
+	from, err := openDB(diffFrom)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg("DB connect error"), err)
+	}
+	defer from.Close()
+	to, err := openDB(diffTo)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg("DB connect error"), err)
+	}
+	defer to.Close()
+
+	d, err := migo.DiffSchemas(ctx, from, to, diffSchema)
+	if err != nil {
+		return err
+	}
+	if d.Empty() {
+		fmt.Println(msg("No schema differences"))
+		return nil
+	}
+	if diffPrint {
+		fmt.Print(d.Migration())
+		return nil
+	}
+	path, err := f.CreateDiff(dir, name, clock, d)
+	if err != nil {
+		return err
+	}
+	slog.Info("Created migration file", "path", path, "differences", len(d.Items))
+	return nil
+}
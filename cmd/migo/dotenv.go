@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultEnvFile is loaded from the working directory when it exists.
+const defaultEnvFile = ".env"
+
+// loadEnvFile sets the variables of the dotenv file at path that aren't
+// already in the environment, so the real environment always wins. A
+// missing file is only an error when required.
+func loadEnvFile(path string, required bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	vars, err := parseEnvFile(bufio.NewScanner(f))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, kv := range vars {
+		if _, ok := os.LookupEnv(kv[0]); ok {
+			continue
+		}
+		if err := os.Setenv(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseEnvFile reads KEY=value lines, optionally starting with export.
+// Single-quoted values are taken as they are, double-quoted ones
+// understand \n, \t, \" and \\, and unquoted ones end at a " #" comment.
+// Variables are not expanded.
+func parseEnvFile(sc *bufio.Scanner) ([][2]string, error) {
+	var vars [][2]string
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validEnvName(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=value", n)
+		}
+		value, err := envValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		vars = append(vars, [2]string{key, value})
+	}
+	return vars, sc.Err()
+}
+
+// envValue unquotes the value of a dotenv line.
+func envValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	quote := v[0]
+	if quote != '\'' && quote != '"' {
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+		return v, nil
+	}
+	var b strings.Builder
+	escaped := false
+	for i := 1; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case escaped:
+			escaped = false
+			switch c {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(c)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			}
+		case c == '\\' && quote == '"':
+			escaped = true
+		case c == quote:
+			if rest := strings.TrimSpace(v[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected %q after the closing quote", rest)
+			}
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("missing closing %c", quote)
+}
+
+// validEnvName reports whether name is a portable environment variable
+// name: letters, digits and underscores, not starting with a digit.
+func validEnvName(name string) bool {
+	for i, r := range name {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
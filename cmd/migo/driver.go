@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
+)
+
+// The database/sql drivers --driver selects.
+const (
+	driverPQ  = "pq"  // lib/pq, the default
+	driverPgx = "pgx" // jackc/pgx
+)
+
+// sqlDriver is the driver every connection is opened with.
+var sqlDriver = driverPQ
+
+// pgxCancelDeadline is how long a connection whose context was canceled
+// waits for the server to cancel the running statement before pgx drops
+// it.
+const pgxCancelDeadline = 10 * time.Second
+
+// dialer opens the connections of a connector in place of the driver:
+// lib/pq calls all three methods, pgx DialContext.
+type dialer interface {
+	pq.Dialer
+	pq.DialerContext
+}
+
+// openDB opens dsn with sqlDriver. Like sql.Open, it doesn't connect yet.
+func openDB(dsn string) (*sql.DB, error) {
+	if sqlDriver == driverPQ {
+		return sql.Open("postgres", dsn)
+	}
+	c, err := newConnector(dsn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(c), nil
+}
+
+// newConnector returns a sqlDriver connector for dsn, dialing with d
+// instead of the driver when it isn't nil.
+func newConnector(dsn string, d dialer) (driver.Connector, error) {
+	if sqlDriver == driverPQ {
+		c, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			c.Dialer(d)
+		}
+		return c, nil
+	}
+	params, err := dsnParams(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Unnamed statements described on every run, as lib/pq does: cached
+	// prepared statements break once a migration changes the tables they
+	// read, and behind PgBouncer.
+	if params["default_query_exec_mode"] == "" {
+		cfg.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	}
+	// A canceled context cancels the running statement on the server
+	// instead of only dropping the connection.
+	cfg.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{Conn: conn, DeadlineDelay: pgxCancelDeadline}
+	}
+	if d != nil {
+		cfg.DialFunc = d.DialContext
+	}
+	return stdlib.GetConnector(*cfg), nil
+}
+
+// sqlDriverImpl returns the driver.Driver of sqlDriver, for connectors
+// wrapping its connections.
+func sqlDriverImpl() driver.Driver {
+	if sqlDriver == driverPgx {
+		return stdlib.GetDefaultDriver()
+	}
+	return &pq.Driver{}
+}
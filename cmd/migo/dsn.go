@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// resolveDSN returns the DSN from --dsn-file, from stdin when --dsn is "-",
+// or dsn itself, so credentials don't have to appear in process listings.
+func resolveDSN(dsn, dsnFile string) (string, error) {
+	switch {
+	case dsnFile != "":
+		data, err := os.ReadFile(dsnFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read DSN file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case dsn == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read DSN from stdin: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return dsn, nil
+}
+
+// setDSNParam sets a connection parameter on a URL or key=value DSN. Both
+// drivers pass parameters they don't know as server run-time settings.
+func setDSNParam(dsn, key, value string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid DSN: %w", err)
+		}
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return strings.TrimSpace(dsn + " " + key + "=" + quoteDSNValue(value)), nil
+}
+
+// quoteDSNValue quotes a key=value DSN value when it contains spaces,
+// quotes or backslashes.
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// setDSNCredentials sets the user, unless empty, and password of a URL or
+// key=value DSN. URLs get them in the userinfo, where redaction looks for
+// passwords.
+func setDSNCredentials(dsn, user, password string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid DSN: %w", err)
+		}
+		if user == "" && u.User != nil {
+			user = u.User.Username()
+		}
+		u.User = url.UserPassword(user, password)
+		return u.String(), nil
+	}
+	var err error
+	if user != "" {
+		if dsn, err = setDSNParam(dsn, "user", user); err != nil {
+			return "", err
+		}
+	}
+	return setDSNParam(dsn, "password", password)
+}
+
+// pgEnvNames maps DSN parameters to the libpq environment variables read
+// by external tools such as pg_dump.
+var pgEnvNames = map[string]string{
+	"host":             "PGHOST",
+	"port":             "PGPORT",
+	"user":             "PGUSER",
+	"password":         "PGPASSWORD",
+	"dbname":           "PGDATABASE",
+	"sslmode":          "PGSSLMODE",
+	"sslrootcert":      "PGSSLROOTCERT",
+	"sslcert":          "PGSSLCERT",
+	"sslkey":           "PGSSLKEY",
+	"connect_timeout":  "PGCONNECT_TIMEOUT",
+	"application_name": "PGAPPNAME",
+	"options":          "PGOPTIONS",
+}
+
+// dsnParams returns the connection parameters of a URL or key=value DSN.
+func dsnParams(dsn string) (map[string]string, error) {
+	params := map[string]string{}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSN: %w", err)
+		}
+		params["host"] = u.Hostname()
+		params["port"] = u.Port()
+		params["dbname"] = strings.TrimPrefix(u.Path, "/")
+		if u.User != nil {
+			params["user"] = u.User.Username()
+			params["password"], _ = u.User.Password()
+		}
+		for k, v := range u.Query() {
+			params[k] = v[0]
+		}
+	} else {
+		for _, field := range splitKeyValues(dsn) {
+			if k, v, ok := strings.Cut(field, "="); ok {
+				params[strings.TrimSpace(k)] = unquoteDSNValue(strings.TrimSpace(v))
+			}
+		}
+	}
+	return params, nil
+}
+
+// pgEnv converts dsn into libpq environment variables, so external tools
+// can connect without the DSN appearing in their command line.
+func pgEnv(dsn string) ([]string, error) {
+	params, err := dsnParams(dsn)
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	for k, v := range params {
+		if name, ok := pgEnvNames[k]; ok && v != "" {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env, nil
+}
+
+// unquoteDSNValue reverses quoteDSNValue.
+func unquoteDSNValue(v string) string {
+	if len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+		return v
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range v[1 : len(v)-1] {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitKeyValues splits a key=value DSN on spaces outside single quotes.
+// Inside quotes a backslash escapes the next character.
+func splitKeyValues(dsn string) []string {
+	var fields []string
+	var cur strings.Builder
+	quoted, escaped := false, false
+	for _, r := range dsn {
+		switch {
+		case escaped:
+			escaped = false
+			cur.WriteRune(r)
+		case r == '\\' && quoted:
+			escaped = true
+			cur.WriteRune(r)
+		case r == '\'':
+			quoted = !quoted
+			cur.WriteRune(r)
+		case r == ' ' && !quoted:
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
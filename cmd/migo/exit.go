@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/bagastri07/migo"
+)
+
+// Exit codes, so scripts and CI can branch on the failure class.
+const (
+	exitOK         = 0
+	exitFailure    = 1 // any other error
+	exitPending    = 2 // plan --check found pending migrations
+	exitChecksum   = 3 // an applied migration file changed
+	exitConnection = 4 // the database could not be reached or refused the login
+	exitLockHeld   = 5 // another runner holds the migration lock
+)
+
+// exitError ends the process with code. A nil err exits silently.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return ""
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var ee *exitError
+	var pgErr interface{ SQLState() string }
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ee):
+		return ee.code
+	case errors.Is(err, migo.ErrChecksumMismatch):
+		return exitChecksum
+	case errors.Is(err, migo.ErrLockHeld):
+		return exitLockHeld
+	case errors.As(err, &pgErr):
+		// Class 08 is connection exception, 28 invalid authorization and
+		// 3D000 a database that doesn't exist.
+		code := pgErr.SQLState()
+		if strings.HasPrefix(code, "08") || strings.HasPrefix(code, "28") || code == "3D000" {
+			return exitConnection
+		}
+	case errors.As(err, &netErr), errors.Is(err, driver.ErrBadConn):
+		return exitConnection
+	}
+	return exitFailure
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bagastri07/migo"
+)
+
+// planFile is the JSON artifact written by `plan --format json`, e.g. to
+// attach to a change ticket, and checked by `up --expect-plan`.
+type planFile struct {
+	Migrations []planStep `json:"migrations"`
+}
+
+type planStep struct {
+	Version       int64          `json:"version"`
+	Name          string         `json:"name"`
+	Repeatable    bool           `json:"repeatable,omitempty"`
+	Direction     migo.Direction `json:"direction"`
+	Checksum      string         `json:"checksum"`
+	Transactional bool           `json:"transactional"`
+	SQL           string         `json:"sql"`
+	Verify        string         `json:"verify,omitempty"`
+	Warnings      []string       `json:"warnings,omitempty"`
+}
+
+func newPlanStep(p migo.PlannedMigration) planStep {
+	return planStep{
+		Version:       p.Version,
+		Name:          p.Name,
+		Repeatable:    p.Repeatable,
+		Direction:     p.Direction,
+		Checksum:      p.Checksum,
+		Transactional: p.Transactional,
+		SQL:           p.SQL,
+		Verify:        p.Verify,
+		Warnings:      p.Warnings,
+	}
+}
+
+// key identifies the migration of s within a plan: its version, or the
+// name of a repeatable migration.
+func (s planStep) key() string {
+	if s.Repeatable {
+		return "R__" + s.Name
+	}
+	return strconv.FormatInt(s.Version, 10)
+}
+
+func (s planStep) label() string {
+	return migrationLabel(s.Version, s.Name, s.Repeatable)
+}
+
+func writePlanJSON(w io.Writer, plan []migo.PlannedMigration) error {
+	f := planFile{Migrations: []planStep{}}
+	for _, p := range plan {
+		f.Migrations = append(f.Migrations, newPlanStep(p))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// expectation checks a run against an approved plan: the pending
+// migrations before it starts, and the migrations that actually ran after
+// it finished.
+type expectation struct {
+	path    string
+	want    []planStep
+	planned map[string]planStep
+	ran     []planStep
+}
+
+func loadExpectation(path string) (*expectation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file: %w", err)
+	}
+	var f planFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid plan file %s: %w", path, err)
+	}
+	return &expectation{path: path, want: f.Migrations, planned: map[string]planStep{}}, nil
+}
+
+// check refuses to start a run whose pending migrations differ from the
+// approved plan.
+func (x *expectation) check(plan []migo.PlannedMigration) error {
+	var got []planStep
+	for _, p := range plan {
+		s := newPlanStep(p)
+		x.planned[s.key()] = s
+		got = append(got, s)
+	}
+	if diff := diffSteps(x.want, got); diff != "" {
+		return errors.New(msg("pending migrations do not match plan %s, nothing was applied:", x.path) + "\n" + diff)
+	}
+	return nil
+}
+
+func (x *expectation) observe(e migo.Event) {
+	if e.Kind != migo.EventMigrationFinished {
+		return
+	}
+	s, ok := x.planned[planStep{Version: e.Version, Name: e.Name, Repeatable: e.Repeatable}.key()]
+	if !ok {
+		s = planStep{Version: e.Version, Name: e.Name, Repeatable: e.Repeatable, Direction: e.Direction}
+	}
+	x.ran = append(x.ran, s)
+}
+
+// verify compares the migrations that ran with the approved plan.
+func (x *expectation) verify() error {
+	if diff := diffSteps(x.want, x.ran); diff != "" {
+		return errors.New(msg("applied migrations do not match plan %s:", x.path) + "\n" + diff)
+	}
+	return nil
+}
+
+// diffSteps describes how got differs from want, one line per migration,
+// or returns "" when they match.
+func diffSteps(want, got []planStep) string {
+	var b strings.Builder
+	gotByKey := make(map[string]planStep, len(got))
+	for _, s := range got {
+		gotByKey[s.key()] = s
+	}
+	wantByKey := make(map[string]planStep, len(want))
+	for i, w := range want {
+		wantByKey[w.key()] = w
+		g, ok := gotByKey[w.key()]
+		switch {
+		case !ok:
+			fmt.Fprintf(&b, "  - %s %s (%s)\n", w.Direction, w.label(), msg("planned, not run"))
+		case g.Name != w.Name || g.Direction != w.Direction:
+			fmt.Fprintf(&b, "  ~ %s\n", msg("%d: planned %s %s, got %s %s", w.Version, w.Direction, w.Name, g.Direction, g.Name))
+		case g.Checksum != w.Checksum:
+			fmt.Fprintf(&b, "  ~ %s %s: %s\n", w.Direction, w.label(), msg("migration file changed since the plan was made"))
+		case g.SQL != w.SQL:
+			fmt.Fprintf(&b, "  ~ %s %s: %s\n", w.Direction, w.label(), msg("rendered SQL differs from the plan"))
+		case i >= len(got) || got[i].key() != w.key():
+			fmt.Fprintf(&b, "  ~ %s %s: %s\n", w.Direction, w.label(), msg("runs in a different position than planned"))
+		}
+	}
+	for _, g := range got {
+		if _, ok := wantByKey[g.key()]; !ok {
+			fmt.Fprintf(&b, "  + %s %s (%s)\n", g.Direction, g.label(), msg("not in plan"))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcsAPI   = "https://storage.googleapis.com/storage/v1"
+	gcsScope = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+// gcsClient reads objects from Google Cloud Storage through the JSON API,
+// authenticated with application default credentials, as for
+// --cloudsql-instance.
+type gcsClient struct {
+	api    string
+	client *http.Client
+}
+
+// newGCS finds the application default credentials. STORAGE_EMULATOR_HOST,
+// e.g. localhost:4443, points at an emulator instead, without credentials.
+func newGCS(ctx context.Context) (*gcsClient, error) {
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		return &gcsClient{api: strings.TrimSuffix(host, "/") + "/storage/v1", client: http.DefaultClient}, nil
+	}
+	ts, err := google.DefaultTokenSource(ctx, gcsScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Google credentials: %w", err)
+	}
+	return &gcsClient{api: gcsAPI, client: oauth2.NewClient(ctx, ts)}, nil
+}
+
+// fetchGCS downloads the migration files under the prefix of u, a
+// gs://bucket/prefix URL, into dir and returns how many there were.
+func fetchGCS(ctx context.Context, u *url.URL, dir string) (int, error) {
+	c, err := newGCS(ctx)
+	if err != nil {
+		return 0, err
+	}
+	bucket, prefix := u.Host, strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	names, err := c.list(ctx, bucket, prefix)
+	if err != nil {
+		return 0, err
+	}
+	files := 0
+	for _, object := range names {
+		name := strings.TrimPrefix(object, prefix)
+		if !isSourceFile(name) && !isSignedManifest(name) {
+			continue
+		}
+		resp, err := c.get(ctx, "/b/"+url.PathEscape(bucket)+"/o/"+url.PathEscape(object), url.Values{"alt": {"media"}})
+		if err != nil {
+			return 0, err
+		}
+		err = writeSourceFile(dir, name, resp.Body, "")
+		resp.Body.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to download gs://%s/%s: %w", bucket, object, err)
+		}
+		if isSourceFile(name) {
+			files++
+		}
+	}
+	return files, nil
+}
+
+// list returns the names of the objects in bucket starting with prefix.
+func (c *gcsClient) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var names []string
+	query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		resp, err := c.get(ctx, "/b/"+url.PathEscape(bucket)+"/o", query)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid Cloud Storage listing of gs://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, o := range page.Items {
+			names = append(names, o.Name)
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// get sends a GET request for path of the JSON API and returns the
+// successful response.
+func (c *gcsClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.api+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Cloud Storage request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+		return nil, fmt.Errorf("Cloud Storage %s returned %s: %s", path, resp.Status, e.Error.Message)
+	}
+	return nil, fmt.Errorf("Cloud Storage %s returned %s", path, resp.Status)
+}
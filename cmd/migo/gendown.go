@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bagastri07/migo"
+)
+
+// genDown prints the drafted down section of the migration version in
+// dirs, or writes it into the file with --write.
+func genDown(cfg *Config, dirs []string, version int64) error {
+	migrations, err := cfg.loadMigrations(dirs)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version != version {
+			continue
+		}
+		down := migo.GenerateDown(m)
+		if !genDownWrite {
+			fmt.Println(down)
+			return nil
+		}
+		if err := migo.WriteDown(m, down); err != nil {
+			return err
+		}
+		slog.Info("Wrote down section", "path", m.Path)
+		return nil
+	}
+	return errors.New(msg("migration %d not found", version))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// fetchGit fetches the ref of u, a git+https://host/repo.git#ref:path URL,
+// and copies the migration files under path into dir. It returns how many
+// there were and the source with the ref resolved to its commit, for the
+// audit trail.
+func fetchGit(ctx context.Context, u *url.URL, dir string) (int, string, error) {
+	ref, sub, _ := strings.Cut(u.Fragment, ":")
+	sub = strings.Trim(sub, "/")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return 0, "", errors.New(msg("invalid git ref %q", ref))
+	}
+	repo := *u
+	repo.Scheme = strings.TrimPrefix(u.Scheme, "git+")
+	repo.Fragment = ""
+
+	clone, err := os.MkdirTemp("", "migo-git-")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.RemoveAll(clone)
+	git := func(args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", clone}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0") // fail instead of asking for a password
+		return cmd
+	}
+	run := func(args ...string) (string, error) {
+		var stderr bytes.Buffer
+		cmd := git(args...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	if _, err := run("init", "-q"); err != nil {
+		return 0, "", err
+	}
+	if _, err := run("fetch", "-q", "--depth", "1", "--", repo.String(), ref); err != nil {
+		return 0, "", err
+	}
+	commit, err := run("rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return 0, "", err
+	}
+
+	args := []string{"archive", "--format=tar", commit}
+	if sub != "" {
+		args = append(args, "--", sub)
+	}
+	var stderr bytes.Buffer
+	cmd := git(args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, "", err
+	}
+	files, err := untarSource(tar.NewReader(out), sub, dir)
+	if err != nil {
+		io.Copy(io.Discard, out)
+	}
+	if wErr := cmd.Wait(); wErr != nil {
+		return 0, "", fmt.Errorf("git archive failed: %w: %s", wErr, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	origin := "git+" + sourceOrigin(&repo) + "#" + commit
+	if sub != "" {
+		origin += ":" + sub
+	}
+	return files, origin, nil
+}
+
+// untarSource writes the migration files of the archive under sub into
+// dir and returns how many there were.
+func untarSource(tr *tar.Reader, sub, dir string) (int, error) {
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		name := path.Clean(hdr.Name)
+		if sub != "" {
+			var ok bool
+			if name, ok = strings.CutPrefix(name, sub+"/"); !ok {
+				continue
+			}
+		}
+		if hdr.Typeflag != tar.TypeReg || !isSourceFile(name) && !isSignedManifest(name) {
+			continue
+		}
+		if err := writeSourceFile(dir, name, tr, ""); err != nil {
+			return 0, err
+		}
+		if isSourceFile(name) {
+			files++
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bagastri07/migo"
+)
+
+// healthStatus is the progress reported by the health endpoints.
+type healthStatus struct {
+	Status  string `json:"status"` // starting, running, succeeded or failed
+	Applied int    `json:"applied"`
+	Total   int    `json:"total"`
+	Current string `json:"current,omitempty"` // migration being executed
+	Error   string `json:"error,omitempty"`
+}
+
+// healthServer serves /healthz and /readyz while `up` runs, so init
+// containers and sidecars can gate application start on the migrations.
+type healthServer struct {
+	srv *http.Server
+
+	mu     sync.Mutex
+	status healthStatus
+}
+
+func startHealthServer(addr string) (*healthServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve health endpoints: %w", err)
+	}
+	h := &healthServer{status: healthStatus{Status: "starting"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", h.healthz)
+	mux.HandleFunc("GET /readyz", h.readyz)
+	h.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := h.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(err.Error())
+		}
+	}()
+	slog.Info("Serving health endpoints", "addr", ln.Addr().String())
+	return h, nil
+}
+
+func (h *healthServer) observe(e migo.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch e.Kind {
+	case migo.EventRunStarted:
+		h.status.Status, h.status.Total = "running", e.Total
+	case migo.EventMigrationStarted:
+		h.status.Current = migrationLabel(e.Version, e.Name, e.Repeatable)
+	case migo.EventMigrationFinished:
+		h.status.Applied++
+		h.status.Current = ""
+	}
+}
+
+// finish records the outcome of the run.
+func (h *healthServer) finish(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.status.Status, h.status.Error = "failed", err.Error()
+		return
+	}
+	h.status.Status, h.status.Current = "succeeded", ""
+}
+
+func (h *healthServer) snapshot() healthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// healthz reports liveness: the process is up and making progress, even
+// when the run failed.
+func (h *healthServer) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, h.snapshot())
+}
+
+// readyz succeeds only once every migration was applied.
+func (h *healthServer) readyz(w http.ResponseWriter, r *http.Request) {
+	s := h.snapshot()
+	code := http.StatusServiceUnavailable
+	if s.Status == "succeeded" {
+		code = http.StatusOK
+	}
+	writeHealth(w, code, s)
+}
+
+func writeHealth(w http.ResponseWriter, code int, s healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *healthServer) close(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	h.srv.Shutdown(ctx)
+}
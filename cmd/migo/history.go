@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bagastri07/migo"
+)
+
+var historyFormat string
+
+func historyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&historyFormat, "format", "text", "Output format: text or json")
+}
+
+// historyEntry is an entry of `history --format json`.
+type historyEntry struct {
+	ID         int64              `json:"id"`
+	Version    int64              `json:"version"`
+	Name       string             `json:"name"`
+	Action     migo.HistoryAction `json:"action"`
+	Outcome    string             `json:"outcome"`
+	Error      string             `json:"error,omitempty"`
+	User       string             `json:"user,omitempty"`
+	At         time.Time          `json:"at"`
+	DurationMS int64              `json:"duration_ms,omitempty"`
+	Source     string             `json:"source,omitempty"`
+}
+
+// showHistory prints the audit history, oldest first, keeping only the
+// entries of version unless it is zero.
+func showHistory(w io.Writer, history []migo.HistoryEntry, version int64) error {
+	if historyFormat != "text" && historyFormat != "json" {
+		return errors.New(msg("unknown history format %q", historyFormat))
+	}
+	var entries []migo.HistoryEntry
+	for _, h := range history {
+		if version == 0 || h.Version == version {
+			entries = append(entries, h)
+		}
+	}
+
+	if historyFormat == "json" {
+		out := []historyEntry{}
+		for _, h := range entries {
+			out = append(out, historyEntry{h.ID, h.Version, h.Name, h.Action, h.Outcome, h.Error, h.User, h.At, h.Duration.Milliseconds(), h.Source})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	if plainOutput {
+		for _, h := range entries {
+			printRecord("at", h.At.Format(time.RFC3339), "version", h.Version, "name", h.Name, "action", h.Action, "outcome", h.Outcome,
+				"duration_ms", h.Duration.Milliseconds(), "user", h.User, "error", h.Error, "source", h.Source)
+		}
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(w, msg("No migration history"))
+		return nil
+	}
+
+	fmt.Fprintln(w, msg("Migration History:"))
+	fmt.Fprintln(w, "-----------------------------------------------------------------------------------------------")
+	fmt.Fprintf(w, "%-20s %-16s %-25s %-9s %-10s %-10s %s\n", msg("Time"), msg("Version"), msg("Name"), msg("Action"), msg("Outcome"), msg("Duration"), msg("User"))
+	fmt.Fprintln(w, "-----------------------------------------------------------------------------------------------")
+	for _, h := range entries {
+		duration := "-"
+		if h.Duration > 0 {
+			duration = h.Duration.Round(time.Millisecond).String()
+		}
+		outcome := styleGreen
+		if h.Outcome == migo.OutcomeFailed {
+			outcome = styleRed
+		}
+		fmt.Fprintf(w, "%-20s %-16d %-25s %-9s %s %-10s %s\n", h.At.Format("2006-01-02 15:04:05"), h.Version, h.Name, h.Action, cell(outcome, h.Outcome, 10), duration, h.User)
+		if h.Error != "" {
+			fmt.Fprintln(w, "    "+paint(styleRed, h.Error))
+		}
+		if h.Source != "" {
+			fmt.Fprintln(w, "    "+msg("from %s", h.Source))
+		}
+	}
+	fmt.Fprintln(w, "-----------------------------------------------------------------------------------------------")
+	return nil
+}
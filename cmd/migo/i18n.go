@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// catalogs translate CLI messages, keyed by the English format string.
+// English needs no catalog; missing entries fall back to English.
+var catalogs = map[string]map[string]string{
+	"en": nil,
+	"id": indonesian,
+}
+
+// catalog is the catalog of the selected language.
+var catalog map[string]string
+
+// setLanguage selects the catalog for lang, or for the locale environment
+// variables when lang is empty. Unsupported locales fall back to English
+// unless they were asked for explicitly.
+func setLanguage(lang string) error {
+	if lang != "" {
+		c, ok := catalogs[lang]
+		if !ok {
+			return fmt.Errorf("unsupported language %q", lang)
+		}
+		catalog = c
+		return nil
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(env)
+		if locale == "" {
+			continue
+		}
+		// Locales look like "id_ID.UTF-8"
+		lang, _, _ = strings.Cut(strings.ToLower(locale), "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		catalog = catalogs[lang]
+		return nil
+	}
+	return nil
+}
+
+// msg returns the translation of the format string key, formatted with
+// args.
+func msg(key string, args ...any) string {
+	format := key
+	if t, ok := catalog[key]; ok {
+		format = t
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// localizedHandler translates log messages, including the ones logged by
+// the library, which are constant strings with their details in attributes.
+type localizedHandler struct {
+	slog.Handler
+}
+
+func (h localizedHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = msg(r.Message)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h localizedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return localizedHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h localizedHandler) WithGroup(name string) slog.Handler {
+	return localizedHandler{h.Handler.WithGroup(name)}
+}
+
+var indonesian = map[string]string{
+	// Library log messages
+	"Applying migration":                            "Menerapkan migrasi",
+	"Connected to server":                           "Terhubung ke server",
+	"Failed to inspect the server":                  "Gagal memeriksa server",
+	"Migrations applied successfully":               "Migrasi berhasil diterapkan",
+	"Rolling back migration":                        "Me-rollback migrasi",
+	"Rollback successful":                           "Rollback berhasil",
+	"Baselining migration":                          "Menandai migrasi sebagai baseline",
+	"Executing statement":                           "Menjalankan statement",
+	"Reconciled squashed migration":                 "Migrasi hasil squash direkonsiliasi",
+	"Dropping invalid index left by a failed build": "Menghapus indeks tidak valid sisa build yang gagal",
+	"failed to look up the migration lock holder":   "gagal mencari pemegang lock migrasi",
+	"failed to release migration lock":              "gagal melepas lock migrasi",
+	"failed to record migration failure":            "gagal mencatat kegagalan migrasi",
+
+	// CLI messages
+	"usage: %s":                                    "penggunaan: %s",
+	"expected key=value, got %q":                   "format harus key=value, didapat %q",
+	"unsupported language %q":                      "bahasa %q tidak didukung",
+	"--verbose and --quiet are mutually exclusive": "--verbose dan --quiet tidak dapat digunakan bersamaan",
+	"failed to load config":                        "gagal memuat konfigurasi",
+	"Created migration file":                       "Berkas migrasi dibuat",
+	"Squashed migrations":                          "Migrasi digabungkan",
+	"missing DATABASE_URL or --dsn flag":           "DATABASE_URL atau flag --dsn belum diisi",
+	"%s is not allowed with --read-only":           "%s tidak diizinkan dengan --read-only",
+	"DB connect error":                             "gagal terhubung ke database",
+	"No migrations to rollback":                    "Tidak ada migrasi untuk di-rollback",
+	"Baseline complete":                            "Baseline selesai",
+	"unknown plan format %q":                       "format plan %q tidak dikenal",
+	"drift replays migrations and needs --scratch-dsn when running with --read-only": "drift menjalankan ulang migrasi dan membutuhkan --scratch-dsn saat berjalan dengan --read-only",
+	"Waiting for the database":                                                                           "Menunggu database",
+	"Database is ready":                                                                                  "Database siap",
+	"--rds-iam needs the host and user in the DSN":                                                       "--rds-iam membutuhkan host dan user di DSN",
+	"--rds-iam needs an AWS region; set --aws-region or AWS_REGION":                                      "--rds-iam membutuhkan region AWS; isi --aws-region atau AWS_REGION",
+	"invalid Cloud SQL instance %q, expected project:region:instance":                                    "instance Cloud SQL %q tidak valid, format yang diharapkan project:region:instance",
+	"Cloud SQL instance %s has no %s IP address":                                                         "instance Cloud SQL %s tidak memiliki alamat IP %s",
+	"pg_dump can't connect through --cloudsql-instance; run it against the Cloud SQL Auth Proxy":         "pg_dump tidak dapat terhubung melalui --cloudsql-instance; jalankan melalui Cloud SQL Auth Proxy",
+	"--rds-iam and --cloudsql-instance are mutually exclusive":                                           "--rds-iam dan --cloudsql-instance tidak dapat digunakan bersamaan",
+	"--vault-path needs VAULT_ADDR":                                                                      "--vault-path membutuhkan VAULT_ADDR",
+	"--vault-path needs VAULT_TOKEN or a vault login":                                                    "--vault-path membutuhkan VAULT_TOKEN atau vault login",
+	"Vault secret %s has no dsn; set the host and database with --dsn":                                   "secret Vault %s tidak memiliki dsn; isi host dan database dengan --dsn",
+	"Vault secret %s has no dsn, url or password":                                                        "secret Vault %s tidak memiliki dsn, url atau password",
+	"Failed to renew Vault lease":                                                                        "Gagal memperpanjang lease Vault",
+	"Renewed Vault lease":                                                                                "Lease Vault diperpanjang",
+	"Vault lease is close to its max TTL and can't be renewed further":                                   "Lease Vault mendekati TTL maksimum dan tidak dapat diperpanjang lagi",
+	"unsupported sslmode %q, expected one of %s":                                                         "sslmode %q tidak didukung, pilih salah satu dari %s",
+	"sslmode disable turns TLS off; remove --sslrootcert, --sslcert and --sslkey or choose another mode": "sslmode disable mematikan TLS; hapus --sslrootcert, --sslcert dan --sslkey atau pilih mode lain",
+	"--sslcert and --sslkey must be set together":                                                        "--sslcert dan --sslkey harus diisi bersamaan",
+	"sslrootcert %s contains no PEM certificate":                                                         "sslrootcert %s tidak berisi sertifikat PEM",
+	"sslcert %s and sslkey %s don't form a key pair: %s":                                                 "sslcert %s dan sslkey %s bukan pasangan kunci: %s",
+	"sslkey %s is readable by group or others; run chmod 600 %s":                                         "sslkey %s dapat dibaca oleh grup atau pengguna lain; jalankan chmod 600 %s",
+	"%s file %s does not exist":                                                                          "berkas %s %s tidak ada",
+	"the Cloud SQL connector sets up TLS itself; remove the sslmode and certificate settings":            "konektor Cloud SQL mengatur TLS sendiri; hapus pengaturan sslmode dan sertifikat",
+	"no tenant schemas found":                                                                            "tidak ada skema tenant yang ditemukan",
+	"Tenant failed":                                                                                      "Tenant gagal",
+	"Tenant":                                                                                             "Tenant",
+	"Applied":                                                                                            "Diterapkan",
+	"Error":                                                                                              "Galat",
+	"ok":                                                                                                 "ok",
+	"skipped":                                                                                            "dilewati",
+	"failed":                                                                                             "gagal",
+	"%d of %d succeeded, %d failed, %d skipped":                                                          "%d dari %d berhasil, %d gagal, %d dilewati",
+	"%d of %d %s(s) failed":                                                                              "%d dari %d %s gagal",
+	"--expect-plan can't be combined with tenants or shards":                                             "--expect-plan tidak dapat digabungkan dengan tenant atau shard",
+	"tenants and shards can't be combined":                                                               "tenant dan shard tidak dapat digabungkan",
+	"shards connect with their DSNs and can't use --cloudsql-instance":                                   "shard terhubung dengan DSN masing-masing dan tidak dapat memakai --cloudsql-instance",
+	"shard %d needs a name and a dsn":                                                                    "shard %d memerlukan name dan dsn",
+	"duplicate shard %q":                                                                                 "shard %q duplikat",
+	"Shard failed":                                                                                       "Shard gagal",
+	"Shard":                                                                                              "Shard",
+	"--limit must not be negative":                                                                       "--limit tidak boleh negatif",
+	"Limit reached, migrations still pending":                                                            "Batas tercapai, masih ada migrasi tertunda",
+	"Roll back %d migration(s)?":                                                                         "Rollback %d migrasi?",
+	"Recorded validation checksums":                                                                      "Checksum validasi dicatat",
+	"golang-migrate table %s not found":                                                                  "tabel golang-migrate %s tidak ditemukan",
+	"golang-migrate marks version %d dirty; resolve it with `migrate force` before importing": "golang-migrate menandai versi %d dirty; selesaikan dengan `migrate force` sebelum mengimpor",
+	"Imported migration files":                                         "Berkas migrasi diimpor",
+	"No migration files to import":                                     "Tidak ada berkas migrasi untuk diimpor",
+	"Renamed golang-migrate table":                                     "Tabel golang-migrate diganti nama",
+	"No history to import":                                             "Tidak ada riwayat untuk diimpor",
+	"Imported history":                                                 "Riwayat diimpor",
+	"unsupported tool %q, expected golang-migrate or goose":            "alat %q tidak didukung, seharusnya golang-migrate atau goose",
+	"goose table %s not found":                                         "tabel goose %s tidak ditemukan",
+	"squash doesn't support Flyway migrations":                         "squash tidak mendukung migrasi Flyway",
+	"Version gap in migration history":                                 "Celah versi dalam riwayat migrasi",
+	"WARNING: %d version gap(s), files may have been lost in a merge:": "PERINGATAN: %d celah versi, file mungkin hilang saat merge:",
+	"%d_%s is applied but its file is missing":                         "%d_%s sudah diterapkan tetapi filenya tidak ada",
+	"%d_%s was never applied, but later migrations were":               "%d_%s tidak pernah diterapkan, tetapi migrasi setelahnya sudah",
+	"--fake can't be combined with tenants, shards or --expect-plan":   "--fake tidak dapat digabungkan dengan tenant, shard, atau --expect-plan",
+	"Marked migrations as applied":                                     "Migrasi ditandai sudah diterapkan",
+	"--backup can't be combined with shards":                           "--backup tidak dapat digabungkan dengan shard",
+	"No pending migrations, skipping backup":                           "Tidak ada migrasi yang tertunda, backup dilewati",
+	"Backup written":                                                   "Backup ditulis",
+	"Atomic run rolled back":                                           "Proses atomik dibatalkan",
+	"Duration":                                                         "Durasi",
+	"unknown history format %q":                                        "format riwayat %q tidak dikenal",
+	"No migration history":                                             "Tidak ada riwayat migrasi",
+	"Migration History:":                                               "Riwayat Migrasi:",
+	"Time":                                                             "Waktu",
+	"Action":                                                           "Aksi",
+	"Outcome":                                                          "Hasil",
+	"User":                                                             "Pengguna",
+	"by %s@%s":                                                         "oleh %s@%s",
+	"not recorded":                                                     "tidak tercatat",
+	"diff doesn't support Flyway migrations":                           "diff tidak mendukung migrasi Flyway",
+	"diff needs both --from and --to":                                  "diff membutuhkan --from dan --to",
+	"No schema differences":                                            "Tidak ada perbedaan skema",
+	"Flyway migrations have no down section":                           "Migrasi Flyway tidak memiliki bagian down",
+	"migration %d not found":                                           "migrasi %d tidak ditemukan",
+	"Wrote down section":                                               "Bagian down ditulis",
+	"--interval must be positive":                                      "--interval harus positif",
+	"Watching for migration changes":                                   "Memantau perubahan migrasi",
+	"Migration files changed":                                          "File migrasi berubah",
+	"Watch run failed":                                                 "Penerapan saat memantau gagal",
+	"Applied migration was edited; roll it back with down before changing it": "Migrasi yang sudah diterapkan diubah; batalkan dengan down sebelum mengubahnya",
+	"Stopped watching":                                              "Berhenti memantau",
+	"Roll back all %d applied migration(s)?":                        "Batalkan semua %d migrasi yang sudah diterapkan?",
+	"%s is protected; %s needs --allow-protected":                   "%s dilindungi; %s membutuhkan --allow-protected",
+	"%s is protected. Type its name to run %s:":                     "%s dilindungi. Ketik namanya untuk menjalankan %s:",
+	"%s must be typed to confirm, rerun in an interactive terminal": "%s harus diketik untuk konfirmasi, jalankan ulang di terminal interaktif",
+	"Plan SQL written":                                              "SQL rencana ditulis",
+	"Migration script written":                                      "Skrip migrasi ditulis",
+	"Retrying migration after transient error":                      "Mengulang migrasi setelah galat sementara",
+	"--parallel must not be negative":                               "--parallel tidak boleh negatif",
+	"Applying migrations in parallel":                               "Menerapkan migrasi secara paralel",
+	"Deferring migration left out by tag filter":                    "Menunda migrasi yang dikecualikan oleh filter tag",
+	"Applying repeatable migration":                                 "Menerapkan migrasi repeatable",
+	"Pre-flight checks passed":                                      "Pemeriksaan pra-jalan lolos",
+	"No pre-flight checks configured":                               "Tidak ada pemeriksaan pra-jalan yang dikonfigurasi",
+	"Batch applied":                                                 "Batch diterapkan",
+	"Migration still running":                                       "Migrasi masih berjalan",
+	"Executed statement":                                            "Pernyataan dieksekusi",
+	"Statement failed":                                              "Pernyataan gagal",
+	"--echo-sql and --quiet are mutually exclusive":                 "--echo-sql dan --quiet tidak dapat digunakan bersamaan",
+	"--plain and --output plain are mutually exclusive":             "--plain dan --output plain tidak dapat digunakan bersamaan",
+	"unknown output %q, want text or plain":                         "output %q tidak dikenal, gunakan text atau plain",
+	"IGNORING CHECKSUM MISMATCHES: applied migration files changed, proceeding anyway": "CHECKSUM YANG TIDAK COCOK DIABAIKAN: file migrasi yang sudah diterapkan berubah, tetap dilanjutkan",
+	"Checksum mismatch ignored":                      "Checksum yang tidak cocok diabaikan",
+	"set VISUAL or EDITOR to open the new migration": "atur VISUAL atau EDITOR untuk membuka migrasi baru",
+	"editor %s failed":                               "editor %s gagal",
+	"--utc and --local are mutually exclusive":       "--utc dan --local tidak dapat digunakan bersamaan",
+	"--component needs components in the config":     "--component memerlukan components di konfigurasi",
+	"component %d needs a name and a dir":            "component %d memerlukan name dan dir",
+	"duplicate component %q":                         "component %q duplikat",
+	"unknown component %q":                           "component %q tidak dikenal",
+	"Component failed":                               "Komponen gagal",
+	"Component":                                      "Komponen",
+	"dir can't be combined with components, each component has its own":                  "dir tidak dapat digabungkan dengan components, setiap komponen memiliki dir sendiri",
+	"%s works on one component, select it with --component":                              "%s bekerja pada satu komponen, pilih dengan --component",
+	"several components can't be combined with tenants, shards, --expect-plan or --fake": "beberapa komponen tidak dapat digabungkan dengan tenant, shard, --expect-plan atau --fake",
+	"invalid source %q": "source %q tidak valid",
+	"unsupported source %q, expected s3://bucket/prefix, gs://bucket/prefix, git+https://host/repo.git#ref:path or an https:// manifest": "source %q tidak didukung, seharusnya s3://bucket/prefix, gs://bucket/prefix, git+https://host/repo.git#ref:path atau manifest https://",
+	"no migration files found at %s":                                      "tidak ada file migrasi di %s",
+	"Fetched migrations":                                                  "Migrasi diambil",
+	"invalid file name %q in source":                                      "nama file %q di source tidak valid",
+	"%s writes migration files and can't be used with a source":           "%s menulis file migrasi dan tidak dapat digunakan dengan source",
+	"a source replaces --dir and components":                              "source menggantikan --dir dan components",
+	"invalid git ref %q":                                                  "ref git %q tidak valid",
+	"from %s":                                                             "dari %s",
+	"manifest %s is larger than %d bytes":                                 "manifest %s lebih besar dari %d byte",
+	"invalid manifest %s":                                                 "manifest %s tidak valid",
+	"checksum mismatch for %s: the manifest has %s, the download %s":      "checksum tidak cocok untuk %s: manifest %s, unduhan %s",
+	"watch runs unsigned edits and can't be used with signature":          "watch menjalankan perubahan yang belum ditandatangani dan tidak bisa dipakai dengan signature",
+	"signature needs one of keyring, cosign_key, or identity with issuer": "signature butuh salah satu dari keyring, cosign_key, atau identity dengan issuer",
+	"migrations in %s are not signed: %s is missing":                      "migrasi di %s tidak ditandatangani: %s tidak ada",
+	"%s was changed after it was signed":                                  "%s diubah setelah ditandatangani",
+	"files missing from the signed manifest of %s: %s":                    "file yang tidak ada di manifest bertanda tangan %s: %s",
+	"signed files missing from %s: %s":                                    "file bertanda tangan yang tidak ada di %s: %s",
+	"Migration signatures verified":                                       "Tanda tangan migrasi terverifikasi",
+	"signature of %s is not valid":                                        "tanda tangan %s tidak valid",
+	"failed to load env file":                                             "gagal memuat file env",
+	"--dsn and --dsn-file are mutually exclusive":                         "--dsn dan --dsn-file tidak dapat digunakan bersamaan",
+	"unknown driver %q, want pq or pgx":                                   "driver %q tidak dikenal, gunakan pq atau pgx",
+	"Schema written":                                                      "Skema ditulis",
+	"unknown command: %s":                                                 "perintah tidak dikenal: %s",
+	"Run matches plan":                                                    "Eksekusi sesuai dengan plan",
+	"Serving migration API":                                               "Menyajikan API migrasi",
+	"API request":                                                         "Permintaan API",
+	"serve requires an API token in --token-file or MIGO_API_TOKEN":       "serve membutuhkan token API di --token-file atau MIGO_API_TOKEN",
+	"Serving health endpoints":                                            "Menyajikan endpoint health",
+	"Run finished, serving health endpoints until terminated":             "Eksekusi selesai, endpoint health tetap disajikan hingga dihentikan",
+	"refusing to write --dsn into a service definition; use --dsn-file or DATABASE_URL in the environment file": "--dsn tidak akan ditulis ke definisi service; gunakan --dsn-file atau DATABASE_URL di file environment",
+	"installing services is not supported on %s; use --print":                                                   "pemasangan service tidak didukung di %s; gunakan --print",
+	"failed to write %s, run as root or use --print":                                                            "gagal menulis %s, jalankan sebagai root atau gunakan --print",
+	"failed to connect to the service manager, run as administrator or use --print":                             "gagal terhubung ke service manager, jalankan sebagai administrator atau gunakan --print",
+	"Installed systemd unit":                      "Unit systemd terpasang",
+	"Installed Windows service":                   "Service Windows terpasang",
+	"%s: confirmation required, rerun with --yes": "%s: konfirmasi diperlukan, jalankan ulang dengan --yes",
+	"aborted":       "dibatalkan",
+	"y":             "y",
+	"yes":           "ya",
+	"Overwrite %s?": "Timpa %s?",
+	"unknown team %q, expected one of the ownership teams in the config": "tim %q tidak dikenal, gunakan salah satu tim ownership di config",
+	"invalid SOURCE_DATE_EPOCH %q":                                       "SOURCE_DATE_EPOCH %q tidak valid",
+	"unsupported shell %q, expected bash, zsh or fish":                   "shell %q tidak didukung, gunakan bash, zsh atau fish",
+	"tui needs an interactive terminal":                                  "tui membutuhkan terminal interaktif",
+	"Failed: %s":                                                         "Gagal: %s",
+	"Done":                                                               "Selesai",
+	"Starting...":                                                        "Memulai...",
+	"Applying":                                                           "Menerapkan",
+	"Rolling back":                                                       "Me-rollback",
+	"Finished":                                                           "Selesai",
+	"%d is not applied":                                                  "%d belum diterapkan",
+	"Apply %d migration(s) up to %d?":                                    "Terapkan %d migrasi hingga %d?",
+	"Roll back %d migration(s) down to %d?":                              "Rollback %d migrasi hingga %d?",
+	"running, wait for it to finish":                                     "sedang berjalan, tunggu hingga selesai",
+	"up/down scroll, esc back":                                           "atas/bawah gulir, esc kembali",
+	"up/down select, enter SQL, u apply to, d roll back to, r refresh, q quit": "atas/bawah pilih, enter SQL, u terapkan hingga, d rollback hingga, r muat ulang, q keluar",
+	"invalid version %q":                         "versi %q tidak valid",
+	"No pending migrations":                      "Tidak ada migrasi yang tertunda",
+	"Plan: %d migration(s)":                      "Rencana: %d migrasi",
+	"transactional":                              "transaksional",
+	"no transaction":                             "tanpa transaksi",
+	"warning: %s":                                "peringatan: %s",
+	"No lint findings":                           "Tidak ada temuan lint",
+	"%d finding(s), %d error(s)":                 "%d temuan, %d error",
+	"lint failed with %d error(s)":               "lint gagal dengan %d error",
+	"No schema drift detected":                   "Tidak ada perbedaan skema",
+	"Schema drift detected (%d difference(s)):":  "Perbedaan skema terdeteksi (%d perbedaan):",
+	"defined by migrations, missing in database": "didefinisikan oleh migrasi, tidak ada di database",
+	"exists in database, not in migrations":      "ada di database, tidak ada di migrasi",
+	"expected":                                   "diharapkan",
+	"actual":                                     "aktual",
+	"schema drift detected in %d object(s)":      "perbedaan skema terdeteksi pada %d objek",
+	"Migration Info:":                            "Informasi Migrasi:",
+	"Repeatable Migrations:":                     "Migrasi Repeatable:",
+	"Version":                                    "Versi",
+	"Name":                                       "Nama",
+	"Valid":                                      "Valid",
+	"Applied At":                                 "Diterapkan Pada",
+	"YES":                                        "YA",
+	"NO":                                         "TIDAK",
+	"CHANGED":                                    "BERUBAH",
+	"WARNING: %d invalid index(es), likely left by failed concurrent builds:": "PERINGATAN: %d indeks tidak valid, kemungkinan sisa build konkuren yang gagal:",
+	"no migration builds this index; drop it manually":                        "tidak ada migrasi yang membuat indeks ini; hapus secara manual",
+	"built by %d_%s; dropped automatically when it is retried":                "dibuat oleh %d_%s; dihapus otomatis saat migrasi diulang",
+	"%s.%s on %s (%s)": "%s.%s pada %s (%s)",
+	"pending migrations do not match plan %s, nothing was applied:": "migrasi tertunda tidak sesuai dengan plan %s, tidak ada yang diterapkan:",
+	"applied migrations do not match plan %s:":                      "migrasi yang diterapkan tidak sesuai dengan plan %s:",
+	"planned, not run":                               "direncanakan, tidak dijalankan",
+	"not in plan":                                    "tidak ada di plan",
+	"%d: planned %s %s, got %s %s":                   "%d: direncanakan %s %s, didapat %s %s",
+	"migration file changed since the plan was made": "berkas migrasi berubah sejak plan dibuat",
+	"rendered SQL differs from the plan":             "SQL hasil render berbeda dari plan",
+	"runs in a different position than planned":      "dijalankan pada urutan yang berbeda dari rencana",
+}
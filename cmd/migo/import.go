@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bagastri07/migo"
+	"github.com/lib/pq"
+)
+
+// Flags of the import command.
+var (
+	importFrom      string
+	importTable     string
+	importFilesOnly bool
+)
+
+func importFlags(fs *flag.FlagSet) {
+	fs.StringVar(&importFrom, "from", "", "Directory of the migrations to import (default the migrations directory, converted in place)")
+	fs.StringVar(&importTable, "table", "", "Bookkeeping table of the other tool (default its own default)")
+	fs.BoolVar(&importFilesOnly, "files-only", false, "Only convert the files, without seeding the bookkeeping table")
+}
+
+// golangMigrateRenamed is where golang-migrate's schema_migrations table is
+// moved, since migo's bookkeeping table has the same name.
+const golangMigrateRenamed = "schema_migrations_golang_migrate"
+
+// importFiles converts the migration files of tool into dir.
+func importFiles(tool, dir string) error {
+	from := importFrom
+	if from == "" {
+		from = dir
+	}
+	var paths []string
+	var err error
+	switch tool {
+	case "golang-migrate":
+		paths, err = migo.ImportGolangMigrate(from, dir)
+	case "goose":
+		paths, err = migo.ImportGoose(from, dir)
+	default:
+		return errors.New(msg("unsupported tool %q, expected golang-migrate or goose", tool))
+	}
+	if errors.Is(err, migo.ErrNothingToImport) && !importFilesOnly {
+		// Already converted; an earlier run may have stopped before the history
+		slog.Info("No migration files to import", "from", from)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Imported migration files", "from", from, "dir", dir, "count", len(paths))
+	return nil
+}
+
+// importHistory seeds migo's bookkeeping table from the one of tool.
+func importHistory(ctx context.Context, db *sql.DB, m *migo.Migrator, tool string) error {
+	switch tool {
+	case "golang-migrate":
+		return importGolangMigrateHistory(ctx, db, m)
+	case "goose":
+		return importGooseHistory(ctx, db, m)
+	}
+	return nil
+}
+
+// importGolangMigrateHistory baselines every migration up to the version
+// golang-migrate recorded; its table only holds the latest version and
+// whether it is dirty. Its default table is also named schema_migrations,
+// so that one is renamed out of the way first.
+func importGolangMigrateHistory(ctx context.Context, db *sql.DB, m *migo.Migrator) error {
+	table := importTable
+	if table == "" || table == "schema_migrations" {
+		var foreign bool
+		err := db.QueryRowContext(ctx, `SELECT
+			EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'dirty')
+			AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'name')`).Scan(&foreign)
+		if err != nil {
+			return fmt.Errorf("failed to inspect schema_migrations: %w", err)
+		}
+		if foreign {
+			if _, err := db.ExecContext(ctx, `ALTER TABLE schema_migrations RENAME TO `+golangMigrateRenamed); err != nil {
+				return fmt.Errorf("failed to rename golang-migrate's schema_migrations: %w", err)
+			}
+			slog.Info("Renamed golang-migrate table", "from", "schema_migrations", "to", golangMigrateRenamed)
+		}
+		table = golangMigrateRenamed
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, quoteTable(table)).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New(msg("golang-migrate table %s not found", table))
+	}
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM `+quoteTable(table)+` LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("No history to import", "table", table)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	if dirty {
+		return errors.New(msg("golang-migrate marks version %d dirty; resolve it with `migrate force` before importing", version))
+	}
+	count, err := m.Baseline(ctx, version)
+	if err != nil {
+		return err
+	}
+	slog.Info("Imported history", "table", table, "version", version, "marked", count)
+	return nil
+}
+
+// importGooseHistory marks the versions goose_db_version records as
+// applied. The table logs every apply and rollback, so a version is applied
+// when its latest row says so; goose's initial version 0 has no file.
+func importGooseHistory(ctx context.Context, db *sql.DB, m *migo.Migrator) error {
+	table := importTable
+	if table == "" {
+		table = "goose_db_version"
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, quoteTable(table)).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New(msg("goose table %s not found", table))
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version_id FROM (
+			SELECT DISTINCT ON (version_id) version_id, is_applied FROM `+quoteTable(table)+` ORDER BY version_id, id DESC
+		) latest WHERE is_applied AND version_id > 0 ORDER BY version_id`)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+	var versions []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	if len(versions) == 0 {
+		slog.Info("No history to import", "table", table)
+		return nil
+	}
+	count, err := m.MarkApplied(ctx, versions...)
+	if err != nil {
+		return err
+	}
+	slog.Info("Imported history", "table", table, "version", versions[len(versions)-1], "marked", count)
+	return nil
+}
+
+// quoteTable quotes a table name that may be qualified with its schema.
+func quoteTable(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,992 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bagastri07/migo"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	// Under the Windows service manager, run() is driven by the service
+	// handler instead.
+	if isService, err := runService(); isService {
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err := run(context.Background()); err != nil {
+		if text := err.Error(); text != "" {
+			slog.Error(text)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+func run(ctx context.Context) (err error) {
+	setLogger(os.Stderr, slog.LevelInfo)
+	var dsn, dsnFile, envFile, configPath, metricsFile, pushgateway, metricsJob, otlpEndpoint, lang, output string
+	var notifyWebhook, notifySlack, environment, chdir, awsRegion, cloudSQLInstance, vaultPath, source string
+	var sslMode, sslRootCert, sslCert, sslKey string
+	var interpolate, tmpl, readOnly, verbose, quiet, echoSQL, wait, rdsIAMAuth, cloudSQLIAM, cloudSQLPrivateIP bool
+	var lockTimeout, waitTimeout, retryBackoff, progressInterval time.Duration
+	var retryAttempts int
+	vars := map[string]string{}
+	flag.StringVar(&dsn, "dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN (can use env DATABASE_URL, \"-\" reads stdin)")
+	flag.StringVar(&dsnFile, "dsn-file", "", "Read the PostgreSQL DSN from a file")
+	flag.StringVar(&sqlDriver, "driver", driverPQ, "Database driver: pq (lib/pq) or pgx (jackc/pgx)")
+	flag.StringVar(&envFile, "env-file", defaultEnvFile, "Set variables missing from the environment, such as DATABASE_URL, from this dotenv file if it exists; empty disables")
+	flag.StringVar(&sslMode, "sslmode", "", "TLS mode: disable, require, verify-ca or verify-full")
+	flag.StringVar(&sslRootCert, "sslrootcert", "", "CA certificates verifying the server (PEM)")
+	flag.StringVar(&sslCert, "sslcert", "", "Client certificate (PEM)")
+	flag.StringVar(&sslKey, "sslkey", "", "Key of the client certificate (PEM)")
+	flag.StringVar(&vaultPath, "vault-path", "", "Read database credentials from this Vault path, e.g. database/creds/migrator (uses VAULT_ADDR and VAULT_TOKEN)")
+	flag.BoolVar(&rdsIAMAuth, "rds-iam", false, "Authenticate to Amazon RDS with an IAM auth token instead of a password")
+	flag.StringVar(&awsRegion, "aws-region", "", "AWS region of the RDS instance or S3 bucket (defaults to the AWS configuration)")
+	flag.StringVar(&source, "source", "", "Fetch the migrations from this URL instead of --dir: s3://bucket/prefix, gs://bucket/prefix, git+https://host/repo.git#ref:path or an https:// manifest")
+	flag.StringVar(&cloudSQLInstance, "cloudsql-instance", "", "Connect to this Cloud SQL instance (project:region:instance) with the Cloud SQL connector")
+	flag.BoolVar(&cloudSQLIAM, "cloudsql-iam", false, "Log in to Cloud SQL with automatic IAM database authentication")
+	flag.BoolVar(&cloudSQLPrivateIP, "cloudsql-private-ip", false, "Connect to the private IP of the Cloud SQL instance")
+	flag.StringVar(&configPath, "config", defaultConfigPath, "Path to the config file")
+	flag.StringVar(&chdir, "chdir", "", "Change to this directory before doing anything else")
+	flag.StringVar(&lang, "lang", "", "Language of CLI messages: en or id (defaults to LANG)")
+	flag.BoolVar(&plainOutput, "plain", false, "Print reports as plain key=value lines, without tables or symbols")
+	flag.StringVar(&output, "output", "text", "Output of info and runs: text, or plain for one tab-separated record per line")
+	flag.BoolVar(&noColor, "no-color", false, "Don't color reports and logs (also NO_COLOR)")
+	flag.BoolVar(&verbose, "verbose", false, "Log every executed statement")
+	flag.BoolVar(&echoSQL, "echo-sql", false, "Log every statement of the migrations and hooks after it ran, with its duration")
+	flag.BoolVar(&quiet, "quiet", false, "Only log errors")
+	flag.BoolVar(&assumeYes, "yes", false, "Answer yes to every confirmation prompt")
+	flag.BoolVar(&assumeYes, "y", false, "Same as --yes")
+	flag.BoolVar(&allowProtected, "allow-protected", false, "Allow down, down-to and reset on protected environments and databases, after typing their name")
+	flag.BoolVar(&nonInteractive, "non-interactive", false, "Fail instead of prompting (implied when stdin is not a terminal)")
+	flag.BoolVar(&readOnly, "read-only", false, "Open a read-only connection; only inspection commands are allowed")
+	flag.StringVar(&metricsFile, "metrics-textfile", "", "Write Prometheus metrics of up/up-to/down to this file (textfile collector)")
+	flag.StringVar(&pushgateway, "metrics-pushgateway", "", "Push Prometheus metrics of up/up-to/down to this Pushgateway URL")
+	flag.StringVar(&metricsJob, "metrics-job", "migo", "Job name used when pushing metrics")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "Export traces of up/up-to/down to this OTLP/HTTP endpoint (also enabled by OTEL_EXPORTER_OTLP_ENDPOINT)")
+	flag.StringVar(&notifyWebhook, "notify-webhook", "", "POST a JSON summary of up/up-to/down runs to this URL")
+	flag.StringVar(&notifySlack, "notify-slack", "", "Post a summary of up/up-to/down runs to this Slack incoming webhook")
+	flag.StringVar(&environment, "environment", "", "Environment name included in notifications and checked against protected environments")
+	flag.BoolVar(&wait, "wait", false, "Retry the initial connection with backoff until the database is ready")
+	flag.DurationVar(&waitTimeout, "wait-timeout", time.Minute, "How long to retry the initial connection before failing, 0 waits forever (implies --wait)")
+	flag.DurationVar(&lockTimeout, "lock-timeout", 0, "How long to wait for the migration lock before failing, e.g. 30s (default wait forever)")
+	flag.DurationVar(&progressInterval, "progress-interval", migo.DefaultProgressInterval, "How often to log that a migration is still running, with its wait event; 0 disables")
+	flag.IntVar(&retryAttempts, "retry", 0, "Try a migration failing with a deadlock, lock timeout or serialization failure up to this many times")
+	flag.DurationVar(&retryBackoff, "retry-backoff", time.Second, "Wait before the first retry, doubled for every further one")
+	flag.BoolVar(&interpolate, "interpolate", false, "Expand ${VAR} environment references in migration files")
+	flag.BoolVar(&tmpl, "template", false, "Render migration files as Go templates")
+	var dirs, components []string
+	flag.Func("component", "Migrate only this component of the config's components (repeatable)", func(s string) error {
+		components = append(components, s)
+		return nil
+	})
+	flag.Func("dir", "Migrations directory (repeatable, merging the directories into one plan; defaults to dir in the config, then ./migrations)", func(s string) error {
+		dirs = append(dirs, s)
+		return nil
+	})
+	flag.Func("var", "Template variable as key=value (repeatable, implies --template)", func(s string) error {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok || k == "" {
+			return errors.New(msg("expected key=value, got %q", s))
+		}
+		vars[k] = v
+		return nil
+	})
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		return parseError(err)
+	}
+	if err := setLanguage(lang); err != nil {
+		return err
+	}
+	switch output {
+	case "text":
+	case "plain":
+		if plainOutput {
+			return errors.New(msg("--plain and --output plain are mutually exclusive"))
+		}
+		tabOutput = true
+	default:
+		return errors.New(msg("unknown output %q, want text or plain", output))
+	}
+	if chdir != "" {
+		if err := os.Chdir(chdir); err != nil {
+			return err
+		}
+	}
+	if envFile != "" {
+		if err := loadEnvFile(envFile, isFlagSet("env-file")); err != nil {
+			return fmt.Errorf("%s: %w", msg("failed to load env file"), err)
+		}
+		if !isFlagSet("dsn") {
+			dsn = os.Getenv("DATABASE_URL")
+		}
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case verbose && quiet:
+		return errors.New(msg("--verbose and --quiet are mutually exclusive"))
+	case echoSQL && quiet:
+		return errors.New(msg("--echo-sql and --quiet are mutually exclusive"))
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelError
+	}
+	detectColors()
+	setLogger(os.Stderr, level)
+
+	cfg, err := loadConfig(configPath, isFlagSet("config"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg("failed to load config"), err)
+	}
+	if isFlagSet("dsn") && dsnFile != "" {
+		return errors.New(msg("--dsn and --dsn-file are mutually exclusive"))
+	}
+	if dsn, err = resolveDSN(dsn, dsnFile); err != nil {
+		return err
+	}
+	if dsn == "" {
+		dsn = cfg.DSN
+	}
+	if !isFlagSet("driver") && cfg.Driver != "" {
+		sqlDriver = cfg.Driver
+	}
+	if sqlDriver != driverPQ && sqlDriver != driverPgx {
+		return errors.New(msg("unknown driver %q, want pq or pgx", sqlDriver))
+	}
+	redactor := migo.NewRedactor(append(cfg.shardDSNs(), dsn)...)
+	setLogger(redactor.Writer(os.Stderr), level)
+	selected, err := cfg.selectComponents(components)
+	if err != nil {
+		return err
+	}
+	var component string
+	if len(selected) > 0 {
+		if len(dirs) > 0 || len(cfg.Dir) > 0 {
+			return errors.New(msg("dir can't be combined with components, each component has its own"))
+		}
+		component, dirs = selected[0].Name, selected[0].Dir
+	}
+	dirs = cfg.migrationDirs(dirs)
+	migrationDir := dirs[0]
+	for k, v := range cfg.Vars {
+		if _, ok := vars[k]; !ok {
+			vars[k] = v
+		}
+	}
+
+	c, args, err := parseCommand(flag.Args())
+	if err != nil {
+		return err
+	}
+	clock, err := sourceDateClock()
+	if err != nil {
+		return err
+	}
+	cmd := c.name
+	multiComponent := len(selected) > 1
+	if multiComponent && cmd != "up" && cmd != "up-to" && cmd != "daemon" && cmd != "completion" {
+		return errors.New(msg("%s works on one component, select it with --component", cmd))
+	}
+
+	if source == "" {
+		source = cfg.Source
+	}
+	if source != "" {
+		if sourceWriters[cmd] || cmd == "gen-down" && genDownWrite {
+			return errors.New(msg("%s writes migration files and can't be used with a source", cmd))
+		}
+		if isFlagSet("dir") || len(selected) > 0 {
+			return errors.New(msg("a source replaces --dir and components"))
+		}
+	}
+
+	// CREATE command doesn't require DB
+	if cmd == "create" {
+		if createUTC && createLocal {
+			return errors.New(msg("--utc and --local are mutually exclusive"))
+		}
+		format := cfg.filenameFormat()
+		format.LocalTime = createLocal || cfg.Create.LocalTime && !createUTC
+		create := format.Create
+		if cfg.Flyway {
+			create = migo.CreateFlyway
+		}
+		path, err := create(migrationDir, args[0], clock)
+		if err != nil {
+			return err
+		}
+		slog.Info("Created migration file", "path", path)
+		fmt.Println(relativePath(path))
+		if createEdit || cfg.Create.Edit && interactive() {
+			return openEditor(path)
+		}
+		return nil
+	}
+
+	// DAEMON only writes service definitions
+	if cmd == "daemon" {
+		return daemonInstall(args, vars)
+	}
+
+	// COMPLETION only prints scripts, or the local versions for them
+	if cmd == "completion" {
+		return completion(args[0], cfg, dirs)
+	}
+
+	// A source is fetched once and read like the migrations directory
+	appliedBy := migo.DetectProvenance()
+	if source != "" {
+		dir, origin, cleanup, err := fetchSource(ctx, source, awsRegion)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		dirs, migrationDir = []string{dir}, dir
+		appliedBy.Source = origin
+	}
+
+	// Signed migrations are checked before anything runs them; serve checks
+	// them again before each run
+	var verifySigned func(context.Context) error
+	if cfg.Signature.enabled() && cmd == "watch" {
+		return errors.New(msg("watch runs unsigned edits and can't be used with signature"))
+	}
+	if cfg.Signature.enabled() && (migratingCommands[cmd] || signedCommands[cmd]) {
+		signed := dirs
+		if multiComponent {
+			signed = nil
+			for _, comp := range selected {
+				signed = append(signed, comp.Dir...)
+			}
+		}
+		verifySigned = func(ctx context.Context) error { return cfg.Signature.verify(ctx, signed) }
+		if err := verifySigned(ctx); err != nil {
+			return err
+		}
+	}
+
+	// SQUASH only rewrites files; databases are reconciled on their next run
+	if cmd == "squash" {
+		if cfg.Flyway {
+			return errors.New(msg("squash doesn't support Flyway migrations"))
+		}
+		from, err := parseVersion(args[0])
+		if err != nil {
+			return err
+		}
+		to, err := parseVersion(args[1])
+		if err != nil {
+			return err
+		}
+		name := ""
+		if len(args) > 2 {
+			name = args[2]
+		}
+		path, err := cfg.filenameFormat().Squash(migrationDir, from, to, name)
+		if err != nil {
+			return err
+		}
+		slog.Info("Squashed migrations", "path", path)
+		return nil
+	}
+
+	// DIFF connects to its own two databases and only writes a file
+	if cmd == "diff" {
+		if cfg.Flyway {
+			return errors.New(msg("diff doesn't support Flyway migrations"))
+		}
+		name := "schema_diff"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		setLogger(migo.NewRedactor(dsn, diffFrom, diffTo).Writer(os.Stderr), level)
+		return diff(ctx, cfg.filenameFormat(), migrationDir, name, clock)
+	}
+
+	// GEN-DOWN only reads, or fills in, a migration file
+	if cmd == "gen-down" {
+		if cfg.Flyway {
+			return errors.New(msg("Flyway migrations have no down section"))
+		}
+		version, err := parseVersion(args[0])
+		if err != nil {
+			return err
+		}
+		return genDown(cfg, dirs, version)
+	}
+
+	// IMPORT converts the files first; adopting the history needs the database
+	if cmd == "import" {
+		if err := importFiles(args[0], migrationDir); err != nil {
+			return err
+		}
+		if importFilesOnly {
+			return nil
+		}
+	}
+
+	// LINT without a database checks every migration file
+	if cmd == "lint" {
+		if lintAll || dsn == "" {
+			migrations, err := cfg.loadMigrations(dirs)
+			if err != nil {
+				return err
+			}
+			findings, err := migo.LintWithOwnership(migrations, cfg.Lint.Rules, cfg.Ownership)
+			if err != nil {
+				return err
+			}
+			return reportLint(findings)
+		}
+	}
+
+	if _, ok := cfg.Ownership[team]; team != "" && !ok {
+		return errors.New(msg("unknown team %q, expected one of the ownership teams in the config", team))
+	}
+
+	// The expected plan is loaded before connecting so bad input fails fast
+	var expected *expectation
+	if expectPlan != "" {
+		if expected, err = loadExpectation(expectPlan); err != nil {
+			return err
+		}
+	}
+
+	if vaultPath != "" {
+		var stop func()
+		if dsn, stop, err = vaultDSN(ctx, dsn, vaultPath); err != nil {
+			return err
+		}
+		defer stop()
+		redactor = migo.NewRedactor(append(cfg.shardDSNs(), dsn)...)
+		setLogger(redactor.Writer(os.Stderr), level)
+	}
+	sharded := (cmd == "up" || cmd == "up-to") && len(cfg.Shards) > 0
+	if dsn == "" && !sharded {
+		return errors.New(msg("missing DATABASE_URL or --dsn flag"))
+	}
+
+	env := environment
+	if env == "" {
+		env = cfg.Notify.Environment
+	}
+	protected, err := cfg.Protected.match(env, dsn, cloudSQLInstance)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(protected, cmd); err != nil {
+		return err
+	}
+	if readOnly && !inspectionCommands[cmd] {
+		return errors.New(msg("%s is not allowed with --read-only", cmd))
+	}
+	if rdsIAMAuth && cloudSQLInstance != "" {
+		return errors.New(msg("--rds-iam and --cloudsql-instance are mutually exclusive"))
+	}
+	if sharded && cloudSQLInstance != "" {
+		return errors.New(msg("shards connect with their DSNs and can't use --cloudsql-instance"))
+	}
+	tlsCfg := cfg.TLS
+	for dst, v := range map[*string]string{&tlsCfg.SSLMode: sslMode, &tlsCfg.SSLRootCert: sslRootCert, &tlsCfg.SSLCert: sslCert, &tlsCfg.SSLKey: sslKey} {
+		if v != "" {
+			*dst = v
+		}
+	}
+	if !tlsCfg.empty() && cloudSQLInstance != "" {
+		return errors.New(msg("the Cloud SQL connector sets up TLS itself; remove the sslmode and certificate settings"))
+	}
+
+	// connect opens and checks a connection to dsn with the connection
+	// flags applied. It also returns the DSN for external tools such as
+	// pg_dump.
+	connect := func(dsn string) (*sql.DB, func(context.Context) (string, error), error) {
+		var err error
+		if readOnly {
+			if dsn, err = setDSNParam(dsn, "default_transaction_read_only", "on"); err != nil {
+				return nil, nil, err
+			}
+		}
+		if !tlsCfg.empty() {
+			if dsn, err = tlsCfg.apply(dsn); err != nil {
+				return nil, nil, err
+			}
+		}
+		connDSN := func(context.Context) (string, error) { return dsn, nil }
+		var db *sql.DB
+		if rdsIAMAuth {
+			iam, err := newRDSIAM(ctx, dsn, awsRegion)
+			if err != nil {
+				return nil, nil, err
+			}
+			db, connDSN = sql.OpenDB(iam), iam.DSN
+		} else if cloudSQLInstance != "" {
+			c, err := newCloudSQL(ctx, dsn, cloudSQLInstance, cloudSQLIAM, cloudSQLPrivateIP)
+			if err != nil {
+				return nil, nil, err
+			}
+			db = sql.OpenDB(c)
+			connDSN = func(context.Context) (string, error) {
+				return "", errors.New(msg("pg_dump can't connect through --cloudsql-instance; run it against the Cloud SQL Auth Proxy"))
+			}
+		} else if db, err = openDB(dsn); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", msg("DB connect error"), err)
+		}
+		if err := ping(ctx, db, wait || isFlagSet("wait-timeout"), waitTimeout); err != nil {
+			db.Close()
+			return nil, nil, &exitError{code: exitConnection, err: fmt.Errorf("%s: %w", msg("DB connect error"), err)}
+		}
+		return db, connDSN, nil
+	}
+	var db *sql.DB
+	var connDSN func(context.Context) (string, error)
+	if !sharded {
+		if db, connDSN, err = connect(dsn); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	hooks, err := cfg.loadHooks()
+	if err != nil {
+		return err
+	}
+
+	var observers []func(migo.Event)
+	var mt *metrics
+	if (metricsFile != "" || pushgateway != "") && migratingCommands[cmd] {
+		mt = newMetrics()
+		observers = append(observers, mt.observe)
+	}
+	if tracingEnabled(otlpEndpoint) && migratingCommands[cmd] {
+		t, tErr := newTracer(ctx, otlpEndpoint, cmd)
+		if tErr != nil {
+			return tErr
+		}
+		observers = append(observers, t.observe)
+		defer func() {
+			if tErr := t.finish(err); tErr != nil {
+				slog.Error(tErr.Error())
+			}
+		}()
+	}
+	if expected != nil {
+		observers = append(observers, expected.observe)
+	}
+	if tabOutput && migratingCommands[cmd] {
+		observers = append(observers, printRunRecord)
+	}
+	var health *healthServer
+	if serveHealth != "" {
+		if health, err = startHealthServer(serveHealth); err != nil {
+			return err
+		}
+		defer health.close(ctx)
+		observers = append(observers, health.observe)
+	}
+	notify := cfg.Notify
+	for dst, v := range map[*string]string{&notify.Webhook: notifyWebhook, &notify.Slack: notifySlack, &notify.Environment: environment} {
+		if v != "" {
+			*dst = v
+		}
+	}
+	var report *notifier
+	if (notify.Webhook != "" || notify.Slack != "") && migratingCommands[cmd] {
+		report = newNotifier(notify, cmd)
+		observers = append(observers, report.observe)
+		defer func() {
+			if nErr := report.send(ctx, err, redactor); nErr != nil {
+				slog.Error(nErr.Error())
+			}
+		}()
+	}
+	var onEvent func(migo.Event)
+	if len(observers) > 0 {
+		onEvent = func(e migo.Event) {
+			for _, observe := range observers {
+				observe(e)
+			}
+		}
+	}
+
+	if upLimit < 0 {
+		return errors.New(msg("--limit must not be negative"))
+	}
+	if parallel < 0 {
+		return errors.New(msg("--parallel must not be negative"))
+	}
+	retry := migo.RetryPolicy{Attempts: cfg.Retry.Attempts, Backoff: cfg.Retry.Backoff, Codes: cfg.Retry.Codes}
+	if isFlagSet("retry") {
+		retry.Attempts = retryAttempts
+	}
+	if isFlagSet("retry-backoff") || retry.Backoff == 0 {
+		retry.Backoff = retryBackoff
+	}
+	if progressInterval == 0 {
+		progressInterval = -1 // migo.Options treats zero as the default
+	}
+	drv := cfg.driver(db).WithComponent(component)
+	opts := migo.Options{
+		Dir:         migrationDir,
+		Dirs:        dirs,
+		Logger:      slog.Default(),
+		Hooks:       hooks,
+		Interpolate: interpolate || cfg.Interpolate,
+		Template:    tmpl || cfg.Template || isFlagSet("var"),
+		Vars:        vars,
+		OnEvent:     onEvent,
+		Clock:       clock,
+		LockTimeout: lockTimeout,
+		Ownership:   cfg.Ownership,
+		Team:        team,
+		Limit:       upLimit,
+		Checksum:    cfg.Checksum,
+		Flyway:      cfg.Flyway,
+		StrictGaps:  strictGaps || cfg.StrictGaps,
+		Atomic:      atomicRun,
+		Retry:       retry,
+		Parallel:    parallel,
+		Tags:        tagFilter,
+		Preflight: migo.Preflight{
+			ServerVersion: cfg.Preflight.ServerVersion,
+			Extensions:    cfg.Preflight.Extensions,
+			Privileges:    cfg.Preflight.Privileges,
+			Database:      cfg.Preflight.Database,
+		},
+		ProgressInterval: progressInterval,
+		EchoSQL:          echoSQL,
+		IgnoreChecksum:   ignoreChecksum,
+		Filename:         cfg.filenameFormat(),
+		AppliedBy:        appliedBy,
+	}
+	m := migo.New(drv, opts)
+
+	if tenants == (TenantsConfig{}) {
+		tenants = cfg.Tenants
+	}
+	multiTenant := (cmd == "up" || cmd == "up-to") && tenants != (TenantsConfig{})
+	if (multiTenant || sharded) && expected != nil {
+		return errors.New(msg("--expect-plan can't be combined with tenants or shards"))
+	}
+	if multiTenant && sharded {
+		return errors.New(msg("tenants and shards can't be combined"))
+	}
+	if fake && (multiTenant || sharded || expected != nil) {
+		return errors.New(msg("--fake can't be combined with tenants, shards or --expect-plan"))
+	}
+	if takeBackup && sharded {
+		return errors.New(msg("--backup can't be combined with shards"))
+	}
+	if multiComponent && (multiTenant || sharded || expected != nil || fake) {
+		return errors.New(msg("several components can't be combined with tenants, shards, --expect-plan or --fake"))
+	}
+
+	switch cmd {
+	case "up", "up-to":
+		version := int64(math.MaxInt64)
+		if cmd == "up-to" {
+			if version, err = parseVersion(args[0]); err != nil {
+				return err
+			}
+		}
+		if takeBackup {
+			var path string
+			if path, err = backupBeforeUp(ctx, m, version, cfg, connDSN, multiTenant || multiComponent); err != nil {
+				break
+			}
+			if path != "" && report != nil {
+				report.summary.Backup = path
+			}
+		}
+		switch {
+		case sharded:
+			err = upShards(ctx, cfg, connect, opts, component, version)
+		case multiComponent:
+			err = upComponents(ctx, drv, opts, selected, version)
+		case multiTenant:
+			err = upTenants(ctx, drv, opts, tenants, version)
+		case fake:
+			err = fakeUp(ctx, m, version)
+		default:
+			err = upTo(ctx, m, version, expected)
+		}
+	case "up-by-one":
+		var version int64
+		if version, err = m.UpByOne(ctx); err == nil {
+			fmt.Println(version)
+		}
+		if errors.Is(err, migo.ErrNoPending) {
+			slog.Info("No pending migrations")
+			err = nil
+		}
+	case "down", "down-to", "reset":
+		// Rollbacks are previewed and confirmed first
+		var plan []migo.PlannedMigration
+		var rollBack func(context.Context) error
+		switch cmd {
+		case "down":
+			plan, err = m.PlanDownSteps(ctx, downSteps)
+			rollBack = func(ctx context.Context) error { return m.DownSteps(ctx, downSteps) }
+		case "down-to":
+			var version int64
+			if version, err = parseVersion(args[0]); err != nil {
+				return err
+			}
+			plan, err = m.PlanDownTo(ctx, version)
+			rollBack = func(ctx context.Context) error { return m.DownTo(ctx, version) }
+		case "reset":
+			plan, err = m.PlanReset(ctx)
+			rollBack = m.Reset
+		}
+		if err == nil {
+			showPlan(plan)
+			question := msg("Roll back %d migration(s)?", len(plan))
+			if cmd == "reset" {
+				question = msg("Roll back all %d applied migration(s)?", len(plan))
+			}
+			err = confirm(question)
+		}
+		if err == nil {
+			err = rollBack(ctx)
+		}
+		if errors.Is(err, migo.ErrNoRollback) {
+			slog.Info("No migrations to rollback")
+			err = nil
+		}
+	case "baseline":
+		var version int64
+		if version, err = parseVersion(args[0]); err != nil {
+			return err
+		}
+		var count int
+		count, err = m.Baseline(ctx, version)
+		if err == nil {
+			slog.Info("Baseline complete", "marked", count)
+		}
+	case "mark-applied":
+		versions := make([]int64, len(args))
+		for i, arg := range args {
+			if versions[i], err = parseVersion(arg); err != nil {
+				return err
+			}
+		}
+		var count int
+		count, err = m.MarkApplied(ctx, versions...)
+		if err == nil {
+			slog.Info("Marked migrations as applied", "marked", count)
+		}
+	case "plan":
+		if planFormat != "text" && planFormat != "json" {
+			return errors.New(msg("unknown plan format %q", planFormat))
+		}
+		var plan []migo.PlannedMigration
+		if len(args) > 0 {
+			var version int64
+			if version, err = parseVersion(args[0]); err != nil {
+				return err
+			}
+			plan, err = m.PlanTo(ctx, version)
+		} else {
+			plan, err = m.Plan(ctx)
+		}
+		if err == nil && planOutput != "" {
+			if err = writePlanSQLFile(planOutput, plan, hooks); err == nil {
+				slog.Info("Plan SQL written", "path", planOutput)
+			}
+		}
+		if err == nil {
+			if planFormat == "json" {
+				err = writePlanJSON(os.Stdout, plan)
+			} else {
+				showPlan(plan)
+			}
+			if err == nil {
+				err = reportGaps(ctx, m, planFormat == "json")
+			}
+			if err == nil && planCheck && len(plan) > 0 {
+				err = &exitError{code: exitPending}
+			}
+		}
+	case "script":
+		version := int64(math.MaxInt64)
+		if len(args) > 0 {
+			if version, err = parseVersion(args[0]); err != nil {
+				return err
+			}
+		}
+		err = writeScript(ctx, m, version)
+	case "lint":
+		var findings []migo.LintFinding
+		findings, err = m.Lint(ctx, cfg.Lint.Rules)
+		if err == nil {
+			err = reportLint(findings)
+		}
+	case "preflight":
+		if cfg.Preflight.empty() {
+			slog.Info("No pre-flight checks configured")
+			break
+		}
+		err = m.Preflight(ctx)
+	case "drift":
+		if scratchDSN != "" {
+			scratch, err := openDB(scratchDSN)
+			if err != nil {
+				return fmt.Errorf("%s: %w", msg("DB connect error"), err)
+			}
+			defer scratch.Close()
+			drv.Scratch = scratch
+		} else if readOnly {
+			return errors.New(msg("drift replays migrations and needs --scratch-dsn when running with --read-only"))
+		}
+		var items []migo.DriftItem
+		items, err = m.Drift(ctx, driftSchema)
+		if err == nil {
+			err = reportDrift(items)
+		}
+	case "schema":
+		path := schemaOutput
+		if path == "" {
+			path = cfg.Schema.File
+		}
+		if path == "" {
+			path = defaultSchemaFile
+		}
+		if err = dumpSchema(ctx, cfg.Schema.PgDump, connDSN, path); err == nil {
+			slog.Info("Schema written", "path", path)
+		}
+	case "import":
+		err = importHistory(ctx, db, m, args[0])
+	case "serve":
+		err = serve(ctx, drv, opts, protected, redactor, verifySigned)
+	case "watch":
+		err = watch(ctx, m, dirs)
+	case "tui":
+		err = tui(ctx, drv, opts)
+	case "history":
+		var version int64
+		if len(args) > 0 {
+			if version, err = parseVersion(args[0]); err != nil {
+				return err
+			}
+		}
+		var history []migo.HistoryEntry
+		if history, err = m.History(ctx); err == nil {
+			err = showHistory(os.Stdout, history, version)
+		}
+	case "info":
+		var infos []migo.MigrationInfo
+		infos, err = m.Info(ctx)
+		if err != nil {
+			break
+		}
+		var repeatables []migo.RepeatableInfo
+		if repeatables, err = m.Repeatables(ctx); err != nil {
+			break
+		}
+		var indexes []migo.InvalidIndex
+		indexes, err = m.InvalidIndexes(ctx)
+		if err == nil {
+			showMigrationInfo(infos)
+			showRepeatables(repeatables)
+			showInvalidIndexes(indexes)
+			err = reportGaps(ctx, m, false)
+		}
+	}
+
+	if health != nil {
+		health.finish(err)
+		if keepServing {
+			slog.Info("Run finished, serving health endpoints until terminated")
+			sig, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			<-sig.Done()
+			stop()
+		}
+	}
+
+	// Export metrics for failed runs too; those are the ones worth alerting on
+	if mt != nil {
+		// Pending is per database, schema and component, so it isn't
+		// reported for shards, tenants or several components. --limit cuts
+		// the plan, so count every pending migration.
+		all := opts
+		all.Limit = 0
+		if !sharded && !multiTenant && !multiComponent {
+			if plan, planErr := migo.New(drv, all).Plan(ctx); planErr == nil {
+				mt.pending = len(plan)
+			}
+		}
+		if metricsFile != "" {
+			if mErr := mt.writeTextfile(metricsFile); mErr != nil {
+				slog.Error(mErr.Error())
+			}
+		}
+		if pushgateway != "" {
+			if mErr := mt.push(ctx, pushgateway, metricsJob); mErr != nil {
+				slog.Error(mErr.Error())
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep the committed schema file in sync after the schema changed
+	if cfg.Schema.File != "" && migratingCommands[cmd] && !sharded {
+		if err := dumpSchema(ctx, cfg.Schema.PgDump, connDSN, cfg.Schema.File); err != nil {
+			return err
+		}
+		slog.Info("Schema written", "path", cfg.Schema.File)
+	}
+	return nil
+}
+
+// upTo applies migrations up to version. With an expectation, the pending
+// migrations must match the approved plan before anything runs, and the
+// migrations that ran must match it afterwards.
+func upTo(ctx context.Context, m *migo.Migrator, version int64, expected *expectation) error {
+	if expected == nil {
+		return m.UpTo(ctx, version)
+	}
+	plan, err := m.PlanTo(ctx, version)
+	if err != nil {
+		return err
+	}
+	if err := expected.check(plan); err != nil {
+		return err
+	}
+	if err := m.UpTo(ctx, version); err != nil {
+		return err
+	}
+	if err := expected.verify(); err != nil {
+		return err
+	}
+	slog.Info("Run matches plan", "plan", expected.path, "migrations", len(expected.ran))
+	return nil
+}
+
+// backupBeforeUp takes a backup when UpTo(version) has migrations to
+// apply and returns its path. The plan of every tenant or component isn't
+// known up front, so with several of them the backup is always taken.
+func backupBeforeUp(ctx context.Context, m *migo.Migrator, version int64, cfg *Config, connDSN func(context.Context) (string, error), several bool) (string, error) {
+	if !several {
+		plan, err := m.PlanTo(ctx, version)
+		if err != nil {
+			return "", err
+		}
+		if len(plan) == 0 {
+			slog.Info("No pending migrations, skipping backup")
+			return "", nil
+		}
+	}
+	path, err := backup(ctx, cfg.Backup, cfg.Schema.PgDump, connDSN)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("Backup written", "path", path)
+	return path, nil
+}
+
+// fakeUp records the versioned migrations UpTo(version) would apply as
+// applied, without executing them or running hooks. Repeatable migrations
+// stay pending.
+func fakeUp(ctx context.Context, m *migo.Migrator, version int64) error {
+	plan, err := m.PlanTo(ctx, version)
+	if err != nil {
+		return err
+	}
+	var versions []int64
+	for _, p := range plan {
+		if !p.Repeatable {
+			versions = append(versions, p.Version)
+		}
+	}
+	if len(versions) == 0 {
+		slog.Info("No pending migrations")
+		return nil
+	}
+	count, err := m.MarkApplied(ctx, versions...)
+	if err != nil {
+		return err
+	}
+	slog.Info("Marked migrations as applied", "marked", count)
+	return nil
+}
+
+// sourceDateClock returns a clock fixed at SOURCE_DATE_EPOCH when it is
+// set, so reproducible builds generate the same versions and timestamps.
+func sourceDateClock() (migo.Clock, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return migo.SystemClock, nil
+	}
+	secs, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return nil, errors.New(msg("invalid SOURCE_DATE_EPOCH %q", epoch))
+	}
+	return migo.FixedClock(time.Unix(secs, 0).UTC()), nil
+}
+
+// setLogger routes log output to w, dropping records below level.
+func setLogger(w io.Writer, level slog.Level) {
+	if colorLogs {
+		w = levelColors{w}
+	}
+	slog.SetDefault(slog.New(localizedHandler{slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})}))
+}
+
+// migratingCommands apply or roll back migrations.
+var migratingCommands = map[string]bool{
+	"up":        true,
+	"up-to":     true,
+	"up-by-one": true,
+	"down":      true,
+	"down-to":   true,
+	"reset":     true,
+}
+
+// inspectionCommands never write to the database and may run with
+// --read-only.
+var inspectionCommands = map[string]bool{
+	"info":      true,
+	"history":   true,
+	"plan":      true,
+	"script":    true,
+	"lint":      true,
+	"preflight": true,
+	"drift":     true,
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func parseVersion(s string) (int64, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New(msg("invalid version %q", s))
+	}
+	return v, nil
+}
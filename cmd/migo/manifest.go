@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxManifestSize bounds the manifest read into memory.
+const maxManifestSize = 16 << 20
+
+// manifestEntry is a line of a manifest: a file and its SHA-256.
+type manifestEntry struct {
+	path   string
+	sha256 string
+}
+
+// fetchManifest downloads the files listed in the manifest at u, an
+// https:// URL, into dir, checking each against its SHA-256. It returns
+// how many there were and the source pinned to the manifest's own SHA-256,
+// for the audit trail.
+func fetchManifest(ctx context.Context, u *url.URL, dir string) (int, string, error) {
+	resp, err := httpSourceGet(ctx, u)
+	if err != nil {
+		return 0, "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	resp.Body.Close()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+	}
+	if len(data) > maxManifestSize {
+		return 0, "", errors.New(msg("manifest %s is larger than %d bytes", u.Redacted(), maxManifestSize))
+	}
+	entries, err := parseManifest(data)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", msg("invalid manifest %s", u.Redacted()), err)
+	}
+	files := 0
+	for _, e := range entries {
+		if !isSourceFile(e.path) {
+			continue
+		}
+		fileURL := u.ResolveReference(&url.URL{Path: e.path})
+		resp, err := httpSourceGet(ctx, fileURL)
+		if err != nil {
+			return 0, "", err
+		}
+		err = writeSourceFile(dir, e.path, resp.Body, e.sha256)
+		resp.Body.Close()
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to download %s: %w", fileURL.Redacted(), err)
+		}
+		files++
+	}
+	if err := keepManifest(ctx, u, data, dir); err != nil {
+		return 0, "", err
+	}
+	sum := sha256.Sum256(data)
+	return files, sourceOrigin(u) + "#sha256=" + hex.EncodeToString(sum[:]), nil
+}
+
+// keepManifest writes the manifest into dir, along with its signature
+// published at u.sig when there is one, so a signature requirement can
+// check the files fetched.
+func keepManifest(ctx context.Context, u *url.URL, data []byte, dir string) error {
+	if err := writeSourceFile(dir, manifestFile, bytes.NewReader(data), ""); err != nil {
+		return err
+	}
+	sigURL := *u
+	sigURL.Path += ".sig"
+	sigURL.RawPath = ""
+	resp, err := httpSourceGet(ctx, &sigURL)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := writeSourceFile(dir, signatureFile, resp.Body, ""); err != nil {
+		return fmt.Errorf("failed to download %s: %w", sigURL.Redacted(), err)
+	}
+	return nil
+}
+
+// parseManifest parses a manifest in the format sha256sum prints, one
+// "<sha256>  <path>" line per file, paths relative to the manifest.
+// Blank lines and lines starting with # are skipped.
+func parseManifest(data []byte) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		// sha256sum marks files read in binary mode with '*'
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		name = strings.TrimPrefix(name, "./")
+		if b, err := hex.DecodeString(sum); !ok || err != nil || len(b) != sha256.Size || name == "" {
+			return nil, fmt.Errorf("line %d: expected \"<sha256>  <path>\"", n)
+		}
+		if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+			return nil, fmt.Errorf("line %d: invalid path %q", n, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("line %d: %s is listed twice", n, name)
+		}
+		seen[name] = true
+		entries = append(entries, manifestEntry{path: name, sha256: strings.ToLower(sum)})
+	}
+	return entries, sc.Err()
+}
+
+// httpSourceGet sends a GET request for u and returns the successful
+// response. Credentials in u are sent with basic authentication.
+func httpSourceGet(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &httpStatusError{url: u.Redacted(), status: resp.Status, code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// httpStatusError is a response of httpSourceGet other than 200 OK.
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("GET %s returned %s", e.url, e.status)
+}
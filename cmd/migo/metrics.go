@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bagastri07/migo"
+)
+
+// metrics collects the outcome of a run from migrator events and renders it
+// in the Prometheus text exposition format.
+type metrics struct {
+	applied   map[migo.Direction]int
+	failures  int
+	durations []durationSample
+	pending   int // -1 when unknown
+	success   bool
+	finished  time.Time
+}
+
+type durationSample struct {
+	direction migo.Direction
+	version   int64
+	name      string
+	seconds   float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{applied: map[migo.Direction]int{}, pending: -1}
+}
+
+func (mt *metrics) observe(e migo.Event) {
+	switch e.Kind {
+	case migo.EventMigrationFinished:
+		mt.applied[e.Direction]++
+		mt.durations = append(mt.durations, durationSample{e.Direction, e.Version, e.Name, e.Duration.Seconds()})
+	case migo.EventMigrationFailed:
+		mt.failures++
+		mt.durations = append(mt.durations, durationSample{e.Direction, e.Version, e.Name, e.Duration.Seconds()})
+	case migo.EventRunFinished:
+		mt.success = e.Err == nil
+		mt.finished = e.Time
+	}
+}
+
+func (mt *metrics) write(w io.Writer) {
+	fmt.Fprintln(w, "# HELP migrations_applied_total Migrations applied or rolled back by the last run.")
+	fmt.Fprintln(w, "# TYPE migrations_applied_total counter")
+	for _, dir := range []migo.Direction{migo.DirectionUp, migo.DirectionDown} {
+		fmt.Fprintf(w, "migrations_applied_total{direction=%q} %d\n", dir, mt.applied[dir])
+	}
+
+	fmt.Fprintln(w, "# HELP migration_failures_total Migrations that failed in the last run.")
+	fmt.Fprintln(w, "# TYPE migration_failures_total counter")
+	fmt.Fprintf(w, "migration_failures_total %d\n", mt.failures)
+
+	fmt.Fprintln(w, "# HELP migration_duration_seconds Time spent executing each migration of the last run.")
+	fmt.Fprintln(w, "# TYPE migration_duration_seconds gauge")
+	for _, d := range mt.durations {
+		fmt.Fprintf(w, "migration_duration_seconds{direction=%q,version=\"%d\",name=\"%s\"} %g\n", d.direction, d.version, escapeLabel(d.name), d.seconds)
+	}
+
+	if mt.pending >= 0 {
+		fmt.Fprintln(w, "# HELP pending_migrations Migrations not yet applied after the last run.")
+		fmt.Fprintln(w, "# TYPE pending_migrations gauge")
+		fmt.Fprintf(w, "pending_migrations %d\n", mt.pending)
+	}
+
+	success := 0
+	if mt.success {
+		success = 1
+	}
+	fmt.Fprintln(w, "# HELP migration_last_run_success Whether the last run succeeded.")
+	fmt.Fprintln(w, "# TYPE migration_last_run_success gauge")
+	fmt.Fprintf(w, "migration_last_run_success %d\n", success)
+	if !mt.finished.IsZero() {
+		fmt.Fprintln(w, "# HELP migration_last_run_timestamp_seconds When the last run finished.")
+		fmt.Fprintln(w, "# TYPE migration_last_run_timestamp_seconds gauge")
+		fmt.Fprintf(w, "migration_last_run_timestamp_seconds %d\n", mt.finished.Unix())
+	}
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// writeTextfile writes the metrics for node_exporter's textfile collector.
+// The file is renamed into place so the collector never reads a partial
+// file.
+func (mt *metrics) writeTextfile(path string) error {
+	var buf bytes.Buffer
+	mt.write(&buf)
+
+	if err := migo.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
+
+// push replaces the metrics of job on a Prometheus Pushgateway.
+func (mt *metrics) push(ctx context.Context, gateway, job string) error {
+	var buf bytes.Buffer
+	mt.write(&buf)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	url := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + job
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to push metrics: pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
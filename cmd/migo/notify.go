@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bagastri07/migo"
+)
+
+// runSummary is the JSON body posted to generic webhooks.
+type runSummary struct {
+	Environment string         `json:"environment,omitempty"`
+	Command     string         `json:"command"`
+	RunID       string         `json:"run_id,omitempty"`
+	Status      string         `json:"status"`     // "succeeded" or "failed"
+	Migrations  []string       `json:"migrations"` // applied or rolled back, as version_name
+	Failed      string         `json:"failed_migration,omitempty"`
+	DurationMS  int64          `json:"duration_ms"`
+	Error       string         `json:"error,omitempty"`
+	Backup      string         `json:"backup,omitempty"` // archive written by --backup before the run
+	Server      *serverSummary `json:"server,omitempty"`
+}
+
+// serverSummary is the server a run executed against.
+type serverSummary struct {
+	Version  string            `json:"version"`
+	Host     string            `json:"host"`
+	Database string            `json:"database"`
+	Settings map[string]string `json:"settings"`
+}
+
+// notifier builds a run summary from migrator events and posts it to the
+// configured webhooks.
+type notifier struct {
+	cfg     NotifyConfig
+	summary runSummary
+	start   time.Time
+}
+
+func newNotifier(cfg NotifyConfig, cmd string) *notifier {
+	return &notifier{
+		cfg:     cfg,
+		summary: runSummary{Environment: cfg.Environment, Command: cmd, Migrations: []string{}},
+		start:   time.Now(),
+	}
+}
+
+func (n *notifier) observe(e migo.Event) {
+	switch e.Kind {
+	case migo.EventRunStarted:
+		n.summary.RunID = e.RunID
+	case migo.EventMigrationFinished:
+		n.summary.Migrations = append(n.summary.Migrations, migrationLabel(e.Version, e.Name, e.Repeatable))
+	case migo.EventMigrationFailed:
+		n.summary.Failed = migrationLabel(e.Version, e.Name, e.Repeatable)
+	case migo.EventRunFinished:
+		if e.Server != nil {
+			n.summary.Server = &serverSummary{Version: e.Server.Version, Host: e.Server.Host, Database: e.Server.Database, Settings: e.Server.Settings}
+		}
+	}
+}
+
+// send posts the summary of a run that ended with err. Credentials are
+// redacted from the error text.
+func (n *notifier) send(ctx context.Context, err error, redactor *migo.Redactor) error {
+	s := n.summary
+	s.DurationMS = time.Since(n.start).Milliseconds()
+	s.Status = "succeeded"
+	if err != nil {
+		s.Status = "failed"
+		s.Error = redactor.Redact(err.Error())
+	} else if n.cfg.FailuresOnly {
+		return nil
+	}
+
+	var errs []string
+	if n.cfg.Webhook != "" {
+		if err := postJSON(ctx, n.cfg.Webhook, s); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if n.cfg.Slack != "" {
+		if err := postJSON(ctx, n.cfg.Slack, map[string]string{"text": slackText(s)}); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send notification: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func slackText(s runSummary) string {
+	var b strings.Builder
+	icon := ":white_check_mark:"
+	if s.Status == "failed" {
+		icon = ":x:"
+	}
+	fmt.Fprintf(&b, "%s `migo %s` %s", icon, s.Command, s.Status)
+	if s.Environment != "" {
+		fmt.Fprintf(&b, " on *%s*", s.Environment)
+	}
+	fmt.Fprintf(&b, " in %s", (time.Duration(s.DurationMS) * time.Millisecond).String())
+	if len(s.Migrations) > 0 {
+		fmt.Fprintf(&b, "\n%d migration(s): %s", len(s.Migrations), strings.Join(s.Migrations, ", "))
+	} else if s.Error == "" {
+		b.WriteString("\nNothing to do")
+	}
+	if s.Server != nil {
+		fmt.Fprintf(&b, "\nPostgreSQL %s at %s/%s", s.Server.Version, s.Server.Host, s.Server.Database)
+	}
+	if s.Backup != "" {
+		fmt.Fprintf(&b, "\nBackup: %s", s.Backup)
+	}
+	if s.Failed != "" {
+		fmt.Fprintf(&b, "\nFailed on %s", s.Failed)
+	}
+	if s.Error != "" {
+		fmt.Fprintf(&b, "\n```%s```", s.Error)
+	}
+	return b.String()
+}
+
+func postJSON(ctx context.Context, endpoint string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Webhook URLs embed their credentials; keep them out of the logs.
+		var uErr *url.Error
+		if errors.As(err, &uErr) {
+			return uErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// plainOutput makes reports print one key=value record per line, without
+// tables, rulers or symbols, for screen readers and basic terminals.
+var plainOutput bool
+
+// tabOutput is --output plain: one tab-separated record per line, led by
+// the kind of record, without headers or alignment, for grepping CI logs
+// and diffing one run against another.
+var tabOutput bool
+
+var tabEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// printTabs prints fields as a tab-separated record. Tabs and line breaks
+// in fields are escaped; empty fields become "-".
+func printTabs(fields ...any) {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		if parts[i] = tabEscaper.Replace(fmt.Sprint(f)); parts[i] == "" {
+			parts[i] = "-"
+		}
+	}
+	fmt.Println(strings.Join(parts, "\t"))
+}
+
+// migrationLabel names a migration in reports, e.g.
+// 20251108001546_create_users, or R__refresh_views for a repeatable one.
+func migrationLabel(version int64, name string, repeatable bool) string {
+	if repeatable {
+		return "R__" + name
+	}
+	return fmt.Sprintf("%d_%s", version, name)
+}
+
+// printRecord prints alternating keys and values as a key=value line,
+// quoting values the way slog's text handler does.
+func printRecord(pairs ...any) {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		v := fmt.Sprint(pairs[i+1])
+		if v == "" || strings.ContainsAny(v, " =\"\t\r\n") || !strconv.CanBackquote(v) {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, "%s=%s", pairs[i], v)
+	}
+	fmt.Println(b.String())
+}
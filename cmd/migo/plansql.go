@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bagastri07/migo"
+)
+
+// writePlanSQLFile writes the SQL of plan to path with writePlanSQL,
+// atomically so a failed run never leaves a partial file to review.
+func writePlanSQLFile(path string, plan []migo.PlannedMigration, hooks migo.Hooks) error {
+	var b strings.Builder
+	if err := writePlanSQL(&b, plan, hooks); err != nil {
+		return fmt.Errorf("failed to write plan SQL: %w", err)
+	}
+	if err := migo.WriteFileAtomic(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write plan SQL: %w", err)
+	}
+	return nil
+}
+
+// writePlanSQL writes the SQL of the migrations of plan and of the hooks,
+// in the order a run executes them. Each migration starts with a header
+// naming its version, and transactional ones are wrapped in BEGIN and
+// COMMIT the way they run. The timeouts set for -- +statement_timeout and
+// -- +lock_timeout and the repetitions of -- +batch migrations are left
+// out.
+func writePlanSQL(w io.Writer, plan []migo.PlannedMigration, hooks migo.Hooks) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- migo plan: %d migration(s)\n", len(plan))
+	section := func(header, sql string) {
+		if sql = strings.TrimSpace(sql); sql == "" {
+			return
+		}
+		if header != "" {
+			b.WriteString(header + "\n")
+		}
+		b.WriteString(sql)
+		if !strings.HasSuffix(sql, ";") {
+			b.WriteString(";")
+		}
+		b.WriteString("\n")
+	}
+	if len(plan) > 0 {
+		section("\n-- hook: before_all", hooks.BeforeAll)
+	}
+	for _, p := range plan {
+		mode := "transactional"
+		if !p.Transactional {
+			mode = "no transaction"
+		}
+		if p.Repeatable {
+			fmt.Fprintf(&b, "\n-- Repeatable: %s (%s, %s)\n", p.Name, p.Direction, mode)
+		} else {
+			fmt.Fprintf(&b, "\n-- Version %d: %s (%s, %s)\n", p.Version, p.Name, p.Direction, mode)
+		}
+		for _, warning := range p.Warnings {
+			b.WriteString("-- warning: " + warning + "\n")
+		}
+		if p.Transactional {
+			b.WriteString("BEGIN;\n")
+		}
+		section("-- hook: before_each", hooks.BeforeEach)
+		section("", p.SQL)
+		section("-- verify", p.Verify)
+		section("-- hook: after_each", hooks.AfterEach)
+		if p.Transactional {
+			b.WriteString("COMMIT;\n")
+		}
+	}
+	if len(plan) > 0 {
+		section("\n-- hook: after_all", hooks.AfterAll)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
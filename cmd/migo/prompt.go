@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// assumeYes and nonInteractive are set by the global --yes and
+// --non-interactive flags.
+var assumeYes, nonInteractive bool
+
+// interactive reports whether prompts can be answered: stdin must be a
+// terminal and --non-interactive must not be set, so pipelines never hang
+// waiting for input.
+func interactive() bool {
+	if nonInteractive {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// confirm asks question on stderr and returns an error unless it is
+// answered with yes. --yes answers every prompt; without a terminal the
+// prompt is an error instead.
+func confirm(question string) error {
+	if assumeYes {
+		return nil
+	}
+	if !interactive() {
+		return errors.New(msg("%s: confirmation required, rerun with --yes", question))
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return errors.New(msg("aborted"))
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes", msg("y"), msg("yes"):
+		return nil
+	}
+	return errors.New(msg("aborted"))
+}
+
+// confirmTyped asks question on stderr and returns an error unless want is
+// typed back. Unlike confirm, --yes doesn't answer it, so it always needs a
+// terminal.
+func confirmTyped(question, want string) error {
+	if !interactive() {
+		return errors.New(msg("%s must be typed to confirm, rerun in an interactive terminal", want))
+	}
+	fmt.Fprintf(os.Stderr, "%s ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != want {
+		return errors.New(msg("aborted"))
+	}
+	return nil
+}
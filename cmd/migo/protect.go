@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"path"
+	"slices"
+)
+
+// ProtectedConfig marks environments and databases, such as production,
+// that rolling back commands refuse to touch unless --allow-protected is
+// given and the name is typed at a prompt.
+type ProtectedConfig struct {
+	Environments []string `yaml:"environments"` // names given with --environment or notify.environment
+	Databases    []string `yaml:"databases"`    // host, host/dbname or Cloud SQL instance patterns, e.g. *.prod.internal
+}
+
+// allowProtected is set by the global --allow-protected flag.
+var allowProtected bool
+
+// destructiveCommands undo migrations or rewrite the history without
+// running them, and are refused on protected targets. The terminal UI can
+// roll back too; up and up-to only with --fake.
+var destructiveCommands = map[string]bool{
+	"down":         true,
+	"down-to":      true,
+	"reset":        true,
+	"tui":          true,
+	"baseline":     true,
+	"mark-applied": true,
+}
+
+// match returns the name of the protected environment or database the run
+// targets, or "" when it targets none.
+func (p ProtectedConfig) match(environment, dsn, instance string) (string, error) {
+	if environment != "" && slices.Contains(p.Environments, environment) {
+		return environment, nil
+	}
+	if len(p.Databases) == 0 {
+		return "", nil
+	}
+	var targets []string
+	if instance != "" {
+		targets = append(targets, instance)
+	}
+	if dsn != "" {
+		params, err := dsnParams(dsn)
+		if err != nil {
+			return "", err
+		}
+		if host := params["host"]; host != "" {
+			targets = append(targets, host, host+"/"+params["dbname"])
+		}
+	}
+	for _, pattern := range p.Databases {
+		for _, t := range targets {
+			if ok, _ := path.Match(pattern, t); ok {
+				return t, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkProtected refuses cmd when it is destructive and the run targets the
+// protected environment or database name, unless --allow-protected is set
+// and name is typed to confirm. --yes doesn't answer this prompt.
+func checkProtected(name, cmd string) error {
+	if fake && (cmd == "up" || cmd == "up-to") {
+		cmd += " --fake"
+	} else if !destructiveCommands[cmd] {
+		return nil
+	}
+	if name == "" {
+		return nil
+	}
+	if !allowProtected {
+		return errors.New(msg("%s is protected; %s needs --allow-protected", name, cmd))
+	}
+	return confirmTyped(msg("%s is protected. Type its name to run %s:", name, cmd), name)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body, signed into the token.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// rdsIAM connects to Amazon RDS with IAM database authentication. It is a
+// driver.Connector generating a fresh auth token for every new connection,
+// since tokens expire after 15 minutes. Credentials come from the default
+// AWS chain: environment, shared config, ECS task role or EKS web identity.
+type rdsIAM struct {
+	dsn      string
+	endpoint string // host:port the token is signed for
+	user     string
+	region   string
+	creds    aws.CredentialsProvider
+}
+
+// newRDSIAM prepares IAM authentication for dsn, which names the host,
+// port and database user but no password. region defaults to the one of
+// the AWS configuration.
+func newRDSIAM(ctx context.Context, dsn, region string) (*rdsIAM, error) {
+	params, err := dsnParams(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if params["host"] == "" || params["user"] == "" {
+		return nil, errors.New(msg("--rds-iam needs the host and user in the DSN"))
+	}
+	port := params["port"]
+	if port == "" {
+		port = "5432"
+	}
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New(msg("--rds-iam needs an AWS region; set --aws-region or AWS_REGION"))
+	}
+	return &rdsIAM{
+		dsn:      dsn,
+		endpoint: net.JoinHostPort(params["host"], port),
+		user:     params["user"],
+		region:   cfg.Region,
+		creds:    cfg.Credentials,
+	}, nil
+}
+
+// token returns a new auth token: a presigned rds-db:connect request with
+// the URL scheme stripped.
+func (r *rdsIAM) token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+r.endpoint+"/", nil)
+	if err != nil {
+		return "", err
+	}
+	q := req.URL.Query()
+	q.Set("Action", "connect")
+	q.Set("DBUser", r.user)
+	q.Set("X-Amz-Expires", "900")
+	req.URL.RawQuery = q.Encode()
+
+	creds, err := r.creds.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	signed, _, err := v4.NewSigner().PresignHTTP(ctx, creds, req, emptyPayloadHash, "rds-db", r.region, time.Now().UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign RDS auth token: %w", err)
+	}
+	return strings.TrimPrefix(signed, "https://"), nil
+}
+
+// DSN returns the DSN with a fresh token as the password, for external
+// tools such as pg_dump.
+func (r *rdsIAM) DSN(ctx context.Context) (string, error) {
+	token, err := r.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return setDSNCredentials(r.dsn, "", token)
+}
+
+func (r *rdsIAM) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := r.DSN(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newConnector(dsn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(ctx)
+}
+
+func (r *rdsIAM) Driver() driver.Driver {
+	return sqlDriverImpl()
+}
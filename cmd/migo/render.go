@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bagastri07/migo"
+	"golang.org/x/term"
+)
+
+// noColor is --no-color. Reports and logs are colored only on terminals,
+// and never with it, NO_COLOR, TERM=dumb, --plain or --output plain.
+var noColor bool
+
+var colorOutput, colorLogs bool // standard output and the logs on standard error
+
+// ANSI styles of the reports.
+const (
+	styleGreen  = "32"
+	styleYellow = "33"
+	styleRed    = "31"
+	styleDim    = "2"
+)
+
+// detectColors decides whether reports and logs are colored.
+func detectColors() {
+	enabled := func(f *os.File) bool {
+		return !noColor && !plainOutput && !tabOutput && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && term.IsTerminal(int(f.Fd()))
+	}
+	colorOutput, colorLogs = enabled(os.Stdout), enabled(os.Stderr)
+}
+
+// paint applies style to text when reports are colored.
+func paint(style, text string) string {
+	if !colorOutput || style == "" {
+		return text
+	}
+	return "\x1b[" + style + "m" + text + "\x1b[0m"
+}
+
+// cell is text painted and padded to width, which fmt would get wrong by
+// counting the escape codes.
+func cell(style, text string, width int) string {
+	return paint(style, text) + strings.Repeat(" ", max(width-utf8.RuneCountInString(text), 0))
+}
+
+// statusStyle colors a migration status: applied green, pending yellow,
+// failed or changed red.
+func statusStyle(status string) string {
+	switch status {
+	case migo.StatusApplied, migo.StatusBaseline:
+		return styleGreen
+	case "pending", migo.StatusDeferred:
+		return styleYellow
+	case migo.StatusFailed, migo.StatusDirty, "changed":
+		return styleRed
+	}
+	return styleDim
+}
+
+// levelColors colors the level of the log records written to w.
+type levelColors struct {
+	w io.Writer
+}
+
+var levelStyles = []struct {
+	level []byte
+	style string
+}{
+	{[]byte("level=DEBUG"), styleDim},
+	{[]byte("level=INFO"), styleGreen},
+	{[]byte("level=WARN"), styleYellow},
+	{[]byte("level=ERROR"), styleRed},
+}
+
+func (c levelColors) Write(p []byte) (int, error) {
+	out := p
+	for _, l := range levelStyles {
+		if i := bytes.Index(p, l.level); i >= 0 {
+			out = slices.Concat(p[:i], []byte("\x1b["+l.style+"m"), l.level, []byte("\x1b[0m"), p[i+len(l.level):])
+			break
+		}
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func showPlan(plan []migo.PlannedMigration) {
+	if plainOutput {
+		for _, p := range plan {
+			printRecord("direction", p.Direction, "version", p.Version, "name", p.Name, "repeatable", p.Repeatable, "transactional", p.Transactional)
+			for _, w := range p.Warnings {
+				printRecord("version", p.Version, "warning", w)
+			}
+		}
+		printRecord("pending", len(plan))
+		return
+	}
+	if len(plan) == 0 {
+		fmt.Println(msg("No pending migrations"))
+		return
+	}
+
+	fmt.Println(msg("Plan: %d migration(s)", len(plan)))
+	for _, p := range plan {
+		mode := msg("transactional")
+		if !p.Transactional {
+			mode = msg("no transaction")
+		}
+		style := styleYellow
+		if p.Direction == migo.DirectionDown {
+			style = styleRed
+		}
+		fmt.Printf("  %s %s (%s)\n", cell(style, string(p.Direction), 4), migrationLabel(p.Version, p.Name, p.Repeatable), mode)
+		for _, w := range p.Warnings {
+			fmt.Println("       " + paint(styleYellow, msg("warning: %s", w)))
+		}
+	}
+}
+
+// reportLint prints findings and fails when any of them is an error, so
+// lint can gate CI.
+func reportLint(findings []migo.LintFinding) error {
+	errorsFound := 0
+	for _, f := range findings {
+		if plainOutput {
+			printRecord("file", f.Migration.Path, "line", f.Line, "severity", f.Severity, "rule", f.Rule, "message", f.Message)
+		} else {
+			style := styleYellow
+			if f.Severity == migo.SeverityError {
+				style = styleRed
+			}
+			fmt.Printf("%s:%d: %s [%s] %s\n", f.Migration.Path, f.Line, paint(style, string(f.Severity)), f.Rule, f.Message)
+		}
+		if f.Severity == migo.SeverityError {
+			errorsFound++
+		}
+	}
+	if plainOutput {
+		printRecord("findings", len(findings), "errors", errorsFound)
+	} else if len(findings) == 0 {
+		fmt.Println(msg("No lint findings"))
+	} else {
+		fmt.Println(msg("%d finding(s), %d error(s)", len(findings), errorsFound))
+	}
+	if errorsFound > 0 {
+		return errors.New(msg("lint failed with %d error(s)", errorsFound))
+	}
+	return nil
+}
+
+// reportDrift prints the differences and fails when there are any.
+func reportDrift(items []migo.DriftItem) error {
+	if plainOutput {
+		for _, d := range items {
+			printRecord("kind", d.Kind, "object", d.Object, "expected", d.Expected, "actual", d.Actual)
+		}
+		printRecord("drift", len(items))
+		if len(items) > 0 {
+			return errors.New(msg("schema drift detected in %d object(s)", len(items)))
+		}
+		return nil
+	}
+	if len(items) == 0 {
+		fmt.Println(msg("No schema drift detected"))
+		return nil
+	}
+
+	fmt.Println(msg("Schema drift detected (%d difference(s)):", len(items)))
+	for _, d := range items {
+		switch d.Kind {
+		case migo.DriftMissing:
+			fmt.Printf("  %s %s (%s)\n", paint(styleRed, "-"), d.Object, msg("defined by migrations, missing in database"))
+		case migo.DriftUnexpected:
+			fmt.Printf("  %s %s (%s)\n", paint(styleYellow, "+"), d.Object, msg("exists in database, not in migrations"))
+		case migo.DriftChanged:
+			fmt.Printf("  %s %s\n      %-10s %s\n      %-10s %s\n", paint(styleYellow, "~"), d.Object, msg("expected")+":", d.Expected, msg("actual")+":", d.Actual)
+		}
+	}
+	return errors.New(msg("schema drift detected in %d object(s)", len(items)))
+}
+
+func showMigrationInfo(infos []migo.MigrationInfo) {
+	if tabOutput {
+		for _, i := range infos {
+			status, valid, appliedAt, durationMS := "pending", "no", "", ""
+			if i.Record != nil {
+				status, valid = i.Record.Status, "yes"
+				if !i.Valid() {
+					valid = "changed"
+				}
+				appliedAt = i.Record.AppliedAt.UTC().Format(time.RFC3339)
+				if i.Record.Duration > 0 {
+					durationMS = strconv.FormatInt(i.Record.Duration.Milliseconds(), 10)
+				}
+			}
+			printTabs("migration", i.Version, i.Name, status, valid, appliedAt, durationMS)
+		}
+		return
+	}
+	if plainOutput {
+		for _, i := range infos {
+			status, valid, appliedAt, durationMS := "pending", "no", "", ""
+			if i.Record != nil {
+				status, valid = i.Record.Status, "yes"
+				if !i.Valid() {
+					valid = "changed"
+				}
+				appliedAt = i.Record.AppliedAt.Format(time.RFC3339)
+				if i.Record.Duration > 0 {
+					durationMS = strconv.FormatInt(i.Record.Duration.Milliseconds(), 10)
+				}
+			}
+			fields := []any{"version", i.Version, "name", i.Name, "status", status, "valid", valid, "applied_at", appliedAt, "duration_ms", durationMS}
+			if infoVerbose {
+				var by migo.Provenance
+				if i.Record != nil {
+					by = i.Record.AppliedBy
+				}
+				fields = append(fields, "applied_by", by.User, "host", by.Host, "ci_job_url", by.CIJobURL, "migo_version", by.Version, "source", by.Source)
+			}
+			printRecord(fields...)
+		}
+		return
+	}
+	fmt.Println(msg("Migration Info:"))
+	fmt.Println("-----------------------------------------------------------------------------------------")
+	fmt.Printf("%-16s %-25s %-10s %-8s %-20s %-10s\n", msg("Version"), msg("Name"), msg("Status"), msg("Valid"), msg("Applied At"), msg("Duration"))
+	fmt.Println("-----------------------------------------------------------------------------------------")
+
+	for _, i := range infos {
+		valid, validStyle := msg("NO"), styleDim
+		status := "pending"
+		appliedAt := "-"
+		duration := "-"
+		if i.Record != nil {
+			if i.Valid() {
+				valid, validStyle = msg("YES"), styleGreen
+			} else {
+				valid, validStyle = msg("CHANGED"), styleRed
+			}
+			status = i.Record.Status
+			appliedAt = i.Record.AppliedAt.Format("2006-01-02 15:04:05")
+			if i.Record.Duration > 0 {
+				duration = i.Record.Duration.Round(time.Millisecond).String()
+			}
+		}
+		fmt.Printf("%-16d %-25s %s %s %-20s %-10s\n", i.Version, i.Name, cell(statusStyle(status), status, 10), cell(validStyle, valid, 8), appliedAt, duration)
+		if infoVerbose && i.Record != nil {
+			showProvenance(i.Record.AppliedBy)
+		}
+	}
+	fmt.Println("-----------------------------------------------------------------------------------------")
+}
+
+// showRepeatables prints the state of the repeatable migrations, if there
+// are any.
+func showRepeatables(infos []migo.RepeatableInfo) {
+	status := func(i migo.RepeatableInfo) string {
+		switch {
+		case i.Record == nil:
+			return "pending"
+		case i.Pending():
+			return "changed"
+		}
+		return "applied"
+	}
+	if plainOutput || tabOutput {
+		for _, i := range infos {
+			appliedAt, durationMS := "", ""
+			if i.Record != nil {
+				appliedAt = i.Record.AppliedAt.Format(time.RFC3339)
+				if tabOutput {
+					appliedAt = i.Record.AppliedAt.UTC().Format(time.RFC3339)
+				}
+				if i.Record.Duration > 0 {
+					durationMS = strconv.FormatInt(i.Record.Duration.Milliseconds(), 10)
+				}
+			}
+			if tabOutput {
+				printTabs("repeatable", i.Name, status(i), appliedAt, durationMS)
+			} else {
+				printRecord("repeatable", i.Name, "status", status(i), "applied_at", appliedAt, "duration_ms", durationMS)
+			}
+		}
+		return
+	}
+	if len(infos) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(msg("Repeatable Migrations:"))
+	fmt.Println("-----------------------------------------------------------------------------------------")
+	fmt.Printf("%-42s %-10s %-20s %-10s\n", msg("Name"), msg("Status"), msg("Applied At"), msg("Duration"))
+	fmt.Println("-----------------------------------------------------------------------------------------")
+	for _, i := range infos {
+		appliedAt, duration := "-", "-"
+		if i.Record != nil {
+			appliedAt = i.Record.AppliedAt.Format("2006-01-02 15:04:05")
+			if i.Record.Duration > 0 {
+				duration = i.Record.Duration.Round(time.Millisecond).String()
+			}
+		}
+		fmt.Printf("%-42s %s %-20s %-10s\n", i.Name, cell(statusStyle(status(i)), status(i), 10), appliedAt, duration)
+	}
+	fmt.Println("-----------------------------------------------------------------------------------------")
+}
+
+// showProvenance prints who applied a migration below its info row.
+func showProvenance(by migo.Provenance) {
+	var parts []string
+	if by.User != "" || by.Host != "" {
+		parts = append(parts, msg("by %s@%s", by.User, by.Host))
+	}
+	if by.Version != "" {
+		parts = append(parts, "migo "+by.Version)
+	}
+	if by.CIJobURL != "" {
+		parts = append(parts, by.CIJobURL)
+	}
+	if by.Source != "" {
+		parts = append(parts, msg("from %s", by.Source))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, msg("not recorded"))
+	}
+	fmt.Println(strings.Repeat(" ", 17) + strings.Join(parts, ", "))
+}
+
+// reportGaps shows the gaps in the history after the output of info and
+// plan, or logs them when stdout is reserved for JSON.
+func reportGaps(ctx context.Context, m *migo.Migrator, logOnly bool) error {
+	gaps, err := m.Gaps(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case logOnly:
+		for _, g := range gaps {
+			slog.Warn("Version gap in migration history", "version", g.Version, "name", g.Name, "missing_file", g.Missing)
+		}
+	case plainOutput:
+		for _, g := range gaps {
+			printRecord("gap", g.Version, "name", g.Name, "missing_file", g.Missing)
+		}
+	case tabOutput:
+		for _, g := range gaps {
+			kind := "never_applied"
+			if g.Missing {
+				kind = "missing_file"
+			}
+			printTabs("gap", g.Version, g.Name, kind)
+		}
+	case len(gaps) > 0:
+		fmt.Println("\n" + paint(styleYellow, msg("WARNING: %d version gap(s), files may have been lost in a merge:", len(gaps))))
+		for _, g := range gaps {
+			if g.Missing {
+				fmt.Println("  " + msg("%d_%s is applied but its file is missing", g.Version, g.Name))
+			} else {
+				fmt.Println("  " + msg("%d_%s was never applied, but later migrations were", g.Version, g.Name))
+			}
+		}
+	}
+	return nil
+}
+
+func showInvalidIndexes(indexes []migo.InvalidIndex) {
+	if plainOutput || tabOutput {
+		for _, idx := range indexes {
+			migration := ""
+			if idx.Migration != nil {
+				migration = fmt.Sprintf("%d_%s", idx.Migration.Version, idx.Migration.Name)
+			}
+			if tabOutput {
+				printTabs("invalid_index", idx.Schema+"."+idx.Name, idx.Table, migration)
+			} else {
+				printRecord("invalid_index", idx.Schema+"."+idx.Name, "table", idx.Table, "migration", migration)
+			}
+		}
+		return
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	fmt.Println("\n" + paint(styleYellow, msg("WARNING: %d invalid index(es), likely left by failed concurrent builds:", len(indexes))))
+	for _, idx := range indexes {
+		owner := msg("no migration builds this index; drop it manually")
+		if idx.Migration != nil {
+			owner = msg("built by %d_%s; dropped automatically when it is retried", idx.Migration.Version, idx.Migration.Name)
+		}
+		fmt.Println("  " + msg("%s.%s on %s (%s)", idx.Schema, idx.Name, idx.Table, owner))
+	}
+}
+
+// printRunRecord prints the result of every migration of a run, and of
+// the run, as tab-separated records for --output plain.
+func printRunRecord(e migo.Event) {
+	outcome, errText := "ok", ""
+	if e.Err != nil {
+		outcome, errText = "failed", e.Err.Error()
+	}
+	switch e.Kind {
+	case migo.EventMigrationFinished, migo.EventMigrationFailed:
+		version := strconv.FormatInt(e.Version, 10)
+		if e.Repeatable {
+			version = "R"
+		}
+		printTabs(e.Direction, version, e.Name, outcome, e.Duration.Milliseconds(), e.Rows, errText)
+	case migo.EventRunFinished:
+		printTabs("run", e.Direction, outcome, e.Total, e.Duration.Milliseconds(), errText)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// s3Client reads objects from Amazon S3, or an S3-compatible store, with
+// requests signed with Signature Version 4. Credentials come from the
+// default AWS chain, as for --rds-iam.
+type s3Client struct {
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	region   string
+	endpoint string // AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, addressed path-style
+}
+
+// newS3 loads the AWS configuration. region defaults to the one of the
+// configuration, then us-east-1; S3 names the bucket's region when it is
+// another.
+func newS3(ctx context.Context, region string) (*s3Client, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	c := &s3Client{
+		creds:  cfg.Credentials,
+		signer: v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true }),
+		region: cfg.Region,
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.endpoint = os.Getenv("AWS_ENDPOINT_URL_S3"); c.endpoint == "" && cfg.BaseEndpoint != nil {
+		c.endpoint = *cfg.BaseEndpoint
+	}
+	return c, nil
+}
+
+// fetchS3 downloads the migration files under the prefix of u, an
+// s3://bucket/prefix URL, into dir and returns how many there were.
+func fetchS3(ctx context.Context, u *url.URL, region, dir string) (int, error) {
+	c, err := newS3(ctx, region)
+	if err != nil {
+		return 0, err
+	}
+	bucket, prefix := u.Host, strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	keys, err := c.list(ctx, bucket, prefix)
+	if err != nil {
+		return 0, err
+	}
+	files := 0
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if !isSourceFile(name) && !isSignedManifest(name) {
+			continue
+		}
+		resp, err := c.get(ctx, bucket, key, nil)
+		if err != nil {
+			return 0, err
+		}
+		err = writeSourceFile(dir, name, resp.Body, "")
+		resp.Body.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to download s3://%s/%s: %w", bucket, key, err)
+		}
+		if isSourceFile(name) {
+			files++
+		}
+	}
+	return files, nil
+}
+
+// list returns the keys of the objects in bucket starting with prefix.
+func (c *s3Client) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := c.get(ctx, bucket, "", query)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 listing of s3://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, o := range page.Contents {
+			keys = append(keys, o.Key)
+		}
+		if !page.IsTruncated {
+			return keys, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// get sends a signed GET request for key in bucket and returns the
+// successful response. A request sent to another region than the bucket's
+// is sent again to the region S3 names.
+func (c *s3Client) get(ctx context.Context, bucket, key string, query url.Values) (*http.Response, error) {
+	for redirected := false; ; redirected = true {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(bucket, key, query), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+		creds, err := c.creds.Retrieve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+		}
+		if err := c.signer.SignHTTP(ctx, creds, req, emptyPayloadHash, "s3", c.region, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("failed to sign S3 request: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("S3 request failed: %w", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if region := resp.Header.Get("X-Amz-Bucket-Region"); !redirected && c.endpoint == "" && region != "" && region != c.region {
+			c.region = region
+			continue
+		}
+		var e struct {
+			Code    string
+			Message string
+		}
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("S3 GET s3://%s/%s returned %s: %s: %s", bucket, key, resp.Status, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("S3 GET s3://%s/%s returned %s", bucket, key, resp.Status)
+	}
+}
+
+// url returns the URL of key in bucket: virtual-hosted on AWS, unless the
+// bucket name has dots that the certificate doesn't cover, and path-style
+// on a custom endpoint.
+func (c *s3Client) url(bucket, key string, query url.Values) string {
+	base, path := "https://"+bucket+".s3."+c.region+".amazonaws.com", "/"+s3Escape(key)
+	switch {
+	case c.endpoint != "":
+		base, path = strings.TrimSuffix(c.endpoint, "/"), "/"+bucket+path
+	case strings.Contains(bucket, "."):
+		base, path = "https://s3."+c.region+".amazonaws.com", "/"+bucket+path
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return base + path
+}
+
+// s3Escape percent-encodes key the way Signature Version 4 expects,
+// everything but unreserved characters and slashes.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', strings.IndexByte("-._~/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bagastri07/migo"
+)
+
+const defaultSchemaFile = "schema.sql"
+
+// volatileDumpLines change between otherwise identical dumps and would make
+// the committed schema file noisy to review.
+var volatileDumpLines = []string{
+	"-- Dumped from database version",
+	"-- Dumped by pg_dump version",
+	`\restrict `,
+	`\unrestrict `,
+}
+
+// dumpSchema writes the schema-only DDL of the database to path using
+// pg_dump. Credentials are passed through the environment so they don't
+// show up in process listings.
+func dumpSchema(ctx context.Context, pgDump string, connDSN func(context.Context) (string, error), path string) error {
+	dsn, err := connDSN(ctx)
+	if err != nil {
+		return err
+	}
+	env, err := pgEnv(dsn)
+	if err != nil {
+		return err
+	}
+	if pgDump == "" {
+		pgDump = "pg_dump"
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, pgDump, "--schema-only", "--no-owner", "--no-privileges")
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_dump failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(stdout.String(), "\n") {
+		if !hasAnyPrefix(line, volatileDumpLines) {
+			out.WriteString(line)
+		}
+	}
+
+	if err := migo.WriteFileAtomic(path, []byte(out.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write schema file: %w", err)
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
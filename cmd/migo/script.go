@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/bagastri07/migo"
+)
+
+// writeScript writes the migrations pending up to version as a standalone
+// SQL script to the --output file, or to standard output. The file is
+// written atomically, so a failure never leaves a partial script to run.
+func writeScript(ctx context.Context, m *migo.Migrator, version int64) error {
+	if scriptOutput == "" {
+		_, err := m.Script(ctx, os.Stdout, version)
+		return err
+	}
+	var buf bytes.Buffer
+	n, err := m.Script(ctx, &buf, version)
+	if err != nil {
+		return err
+	}
+	if err := migo.WriteFileAtomic(scriptOutput, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write migration script: %w", err)
+	}
+	slog.Info("Migration script written", "path", scriptOutput, "count", n)
+	return nil
+}
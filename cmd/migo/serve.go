@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bagastri07/migo"
+)
+
+// apiServer exposes the migrator over HTTP for deployment services. Runs
+// are serialized: a run requested while another one is in progress is
+// rejected instead of queued.
+type apiServer struct {
+	drv       *migo.Postgres
+	opts      migo.Options
+	token     string
+	protected string         // protected environment or database; rollbacks are refused
+	redactor  *migo.Redactor // masks credentials driver errors may echo
+
+	// verifySigned, when set, checks the signed migrations before each
+	// run, since the files are read again from disk every time.
+	verifySigned func(context.Context) error
+
+	running sync.Mutex
+}
+
+var serveAddr, serveTokenFile string
+
+func serveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	fs.StringVar(&serveTokenFile, "token-file", "", "File containing the API bearer token (default env MIGO_API_TOKEN)")
+}
+
+// serve runs `migo serve [--addr :8080] [--token-file path]` until it is
+// terminated. The bearer token comes from --token-file or MIGO_API_TOKEN.
+// verifySigned, when not nil, is checked before every run. Errors are
+// returned to clients through redactor.
+func serve(ctx context.Context, drv *migo.Postgres, opts migo.Options, protected string, redactor *migo.Redactor, verifySigned func(context.Context) error) error {
+	token := os.Getenv("MIGO_API_TOKEN")
+	if serveTokenFile != "" {
+		data, err := os.ReadFile(serveTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return errors.New(msg("serve requires an API token in --token-file or MIGO_API_TOKEN"))
+	}
+
+	s := &apiServer{drv: drv, opts: opts, token: token, protected: protected, redactor: redactor, verifySigned: verifySigned}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.auth(s.status))
+	mux.HandleFunc("GET /history", s.auth(s.history))
+	mux.HandleFunc("POST /up", s.auth(s.up))
+	mux.HandleFunc("POST /down", s.auth(s.down))
+	srv := &http.Server{Addr: serveAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	slog.Info("Serving migration API", "addr", serveAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *apiServer) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		slog.Info("API request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		next(w, r)
+	}
+}
+
+type migrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	Valid     bool       `json:"valid"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type invalidIndexStatus struct {
+	Index     string `json:"index"`
+	Table     string `json:"table"`
+	Migration string `json:"migration,omitempty"`
+}
+
+func (s *apiServer) status(w http.ResponseWriter, r *http.Request) {
+	m := migo.New(s.drv, s.opts)
+	infos, err := m.Info(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": s.redactor.Redact(err.Error())})
+		return
+	}
+	indexes, err := m.InvalidIndexes(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": s.redactor.Redact(err.Error())})
+		return
+	}
+
+	resp := struct {
+		Migrations     []migrationStatus    `json:"migrations"`
+		Pending        int                  `json:"pending"`
+		InvalidIndexes []invalidIndexStatus `json:"invalid_indexes"`
+	}{Migrations: []migrationStatus{}, InvalidIndexes: []invalidIndexStatus{}}
+	for _, i := range infos {
+		st := migrationStatus{Version: i.Version, Name: i.Name, Status: "pending"}
+		if i.Record != nil {
+			st.Status, st.Valid, st.AppliedAt = i.Record.Status, i.Valid(), &i.Record.AppliedAt
+		}
+		if !(i.Record != nil && i.Record.Done()) {
+			resp.Pending++
+		}
+		resp.Migrations = append(resp.Migrations, st)
+	}
+	for _, idx := range indexes {
+		st := invalidIndexStatus{Index: idx.Schema + "." + idx.Name, Table: idx.Table}
+		if idx.Migration != nil {
+			st.Migration = fmt.Sprintf("%d_%s", idx.Migration.Version, idx.Migration.Name)
+		}
+		resp.InvalidIndexes = append(resp.InvalidIndexes, st)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *apiServer) history(w http.ResponseWriter, r *http.Request) {
+	records, err := s.drv.Records(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": s.redactor.Redact(err.Error())})
+		return
+	}
+	type entry struct {
+		Version    int64     `json:"version"`
+		Name       string    `json:"name"`
+		Checksum   string    `json:"checksum"`
+		Status     string    `json:"status"`
+		AppliedAt  time.Time `json:"applied_at"`
+		DurationMS int64     `json:"duration_ms,omitempty"`
+	}
+	history := []entry{}
+	for _, rec := range records {
+		history = append(history, entry{rec.Version, rec.Name, rec.Checksum, rec.Status, rec.AppliedAt, rec.Duration.Milliseconds()})
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// up applies pending migrations, up to the "to" query parameter when set.
+func (s *apiServer) up(w http.ResponseWriter, r *http.Request) {
+	version := int64(math.MaxInt64)
+	if to := r.URL.Query().Get("to"); to != "" {
+		v, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid version %q", to)})
+			return
+		}
+		version = v
+	}
+	s.run(w, r, func(ctx context.Context, m *migo.Migrator) error { return m.UpTo(ctx, version) })
+}
+
+func (s *apiServer) down(w http.ResponseWriter, r *http.Request) {
+	if s.protected != "" {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": s.protected + " is protected; rollbacks are disabled"})
+		return
+	}
+	s.run(w, r, func(ctx context.Context, m *migo.Migrator) error {
+		if err := m.Down(ctx); !errors.Is(err, migo.ErrNoRollback) {
+			return err
+		}
+		return nil
+	})
+}
+
+// run executes a run and reports the migrations it applied or rolled back.
+// The run is detached from the request, so a client disconnecting doesn't
+// abort a migration halfway.
+func (s *apiServer) run(w http.ResponseWriter, r *http.Request, fn func(context.Context, *migo.Migrator) error) {
+	if !s.running.TryLock() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "a run is already in progress"})
+		return
+	}
+	defer s.running.Unlock()
+
+	if s.verifySigned != nil {
+		if err := s.verifySigned(r.Context()); err != nil {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": s.redactor.Redact(err.Error())})
+			return
+		}
+	}
+
+	migrations := []string{}
+	opts := s.opts
+	opts.OnEvent = func(e migo.Event) {
+		if s.opts.OnEvent != nil {
+			s.opts.OnEvent(e)
+		}
+		if e.Kind == migo.EventMigrationFinished {
+			migrations = append(migrations, migrationLabel(e.Version, e.Name, e.Repeatable))
+		}
+	}
+	start := time.Now()
+	err := fn(context.WithoutCancel(r.Context()), migo.New(s.drv, opts))
+
+	resp := map[string]any{
+		"status":      "succeeded",
+		"migrations":  migrations,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	code := http.StatusOK
+	if err != nil {
+		resp["status"], resp["error"] = "failed", s.redactor.Redact(err.Error())
+		code = http.StatusInternalServerError
+	}
+	writeJSON(w, code, resp)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/bagastri07/migo"
+)
+
+// runService reports false: only Windows has a service manager that needs
+// a handler.
+func runService() (bool, error) {
+	return false, nil
+}
+
+const systemdDir = "/etc/systemd/system"
+
+func installService(name, exe string, args []string, print bool) error {
+	unit := systemdUnit(name, exe, args)
+	if print {
+		fmt.Print(unit)
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return errors.New(msg("installing services is not supported on %s; use --print", runtime.GOOS))
+	}
+
+	path := filepath.Join(systemdDir, name+".service")
+	if _, err := os.Stat(path); err == nil {
+		if err := confirm(msg("Overwrite %s?", path)); err != nil {
+			return err
+		}
+	}
+	if err := migo.WriteFileAtomic(path, []byte(unit), 0644); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%s: %w", msg("failed to write %s, run as root or use --print", path), err)
+		}
+		return err
+	}
+	if out, err := exec.Command("systemctl", "daemon-reload").CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl daemon-reload failed: %v: %s", err, out)
+	}
+	slog.Info(msg("Installed systemd unit"), "path", path, "start", "systemctl enable --now "+name)
+	return nil
+}
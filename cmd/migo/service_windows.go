@@ -0,0 +1,82 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// runService runs migo under the Windows service manager when it was
+// started by it, stopping the command when the service is stopped.
+func runService() (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	h := &serviceHandler{}
+	if err := svc.Run("migo", h); err != nil {
+		return true, err
+	}
+	return true, h.err
+}
+
+type serviceHandler struct {
+	err error
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- run(ctx) }()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			h.err = err
+			if err != nil {
+				slog.Error(err.Error())
+				return false, uint32(exitCode(err))
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+func installService(name, exe string, args []string, print bool) error {
+	if print {
+		fmt.Printf("sc.exe create %s start= auto binPath= \"%s %s\"\n", name, exe, strings.Join(args, " "))
+		return nil
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg("failed to connect to the service manager, run as administrator or use --print"), err)
+	}
+	defer m.Disconnect()
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "migo database migrations (" + name + ")",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", name, err)
+	}
+	defer s.Close()
+	slog.Info(msg("Installed Windows service"), "name", name, "start", "sc.exe start "+name)
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The signed manifest at the root of a migrations directory: the SHA-256
+// of every migration file, as sha256sum prints them, and its detached
+// signature.
+const (
+	manifestFile  = "SHA256SUMS"
+	signatureFile = manifestFile + ".sig"
+)
+
+// SignatureConfig requires every migrations directory to carry a signed
+// manifest listing its migration files before they are run. The manifest
+// is checked with gpgv against Keyring, or with cosign against CosignKey
+// or the keyless Identity and Issuer.
+type SignatureConfig struct {
+	Keyring   string `yaml:"keyring"`    // GPG keyring of the trusted keys, as gpg --export writes it
+	CosignKey string `yaml:"cosign_key"` // cosign public key
+	Identity  string `yaml:"identity"`   // keyless signing: certificate identity, e.g. the CI workflow
+	Issuer    string `yaml:"issuer"`     // keyless signing: OIDC issuer of the identity
+}
+
+// signedCommands run the SQL of migration files, so a signature
+// requirement applies to them.
+var signedCommands = map[string]bool{"script": true, "serve": true, "tui": true}
+
+func (s SignatureConfig) enabled() bool {
+	return s != SignatureConfig{}
+}
+
+// verify checks the signed manifest of every dir.
+func (s SignatureConfig) verify(ctx context.Context, dirs []string) error {
+	methods := 0
+	for _, set := range []bool{s.Keyring != "", s.CosignKey != "", s.Identity != "" || s.Issuer != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods != 1 || (s.Identity == "") != (s.Issuer == "") {
+		return errors.New(msg("signature needs one of keyring, cosign_key, or identity with issuer"))
+	}
+	for _, dir := range dirs {
+		if err := s.verifyDir(ctx, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyDir checks the signature of the manifest of dir, then that the
+// migration files of dir are exactly those the manifest lists, unchanged.
+func (s SignatureConfig) verifyDir(ctx context.Context, dir string) error {
+	manifest, sig := filepath.Join(dir, manifestFile), filepath.Join(dir, signatureFile)
+	for _, path := range []string{manifest, sig} {
+		if _, err := os.Stat(path); err != nil {
+			return errors.New(msg("migrations in %s are not signed: %s is missing", dir, filepath.Base(path)))
+		}
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		return err
+	}
+	if err := s.verifySignature(ctx, manifest, sig); err != nil {
+		return err
+	}
+	entries, err := parseManifest(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg("invalid manifest %s", manifest), err)
+	}
+	listed := map[string]string{}
+	for _, e := range entries {
+		if isSourceFile(e.path) {
+			listed[e.path] = e.sha256
+		}
+	}
+
+	var unsigned []string
+	files := 0
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || d.IsDir() || !isSourceFile(filepath.ToSlash(rel)) {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		want, ok := listed[rel]
+		if !ok {
+			unsigned = append(unsigned, rel)
+			return nil
+		}
+		delete(listed, rel)
+		got, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return errors.New(msg("%s was changed after it was signed", p))
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(unsigned) > 0 {
+		return errors.New(msg("files missing from the signed manifest of %s: %s", dir, strings.Join(unsigned, ", ")))
+	}
+	if len(listed) > 0 {
+		missing := make([]string, 0, len(listed))
+		for p := range listed {
+			missing = append(missing, p)
+		}
+		slices.Sort(missing)
+		return errors.New(msg("signed files missing from %s: %s", dir, strings.Join(missing, ", ")))
+	}
+	slog.Info("Migration signatures verified", "dir", dir, "files", files)
+	return nil
+}
+
+// verifySignature checks sig, the detached signature of manifest, with
+// gpgv or cosign.
+func (s SignatureConfig) verifySignature(ctx context.Context, manifest, sig string) error {
+	var cmd *exec.Cmd
+	switch {
+	case s.Keyring != "":
+		keyring, err := filepath.Abs(s.Keyring) // gpgv looks up bare names in ~/.gnupg
+		if err != nil {
+			return err
+		}
+		cmd = exec.CommandContext(ctx, "gpgv", "--keyring", keyring, sig, manifest)
+	case s.CosignKey != "":
+		cmd = exec.CommandContext(ctx, "cosign", "verify-blob", "--key", s.CosignKey, "--bundle", sig, manifest)
+	default:
+		cmd = exec.CommandContext(ctx, "cosign", "verify-blob", "--certificate-identity", s.Identity, "--certificate-oidc-issuer", s.Issuer, "--bundle", sig, manifest)
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", msg("signature of %s is not valid", manifest), err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceWriters are the commands writing migration files, which a fetched
+// source can't take.
+var sourceWriters = map[string]bool{"create": true, "squash": true, "diff": true, "import": true, "watch": true}
+
+// fetchSource downloads the migrations published at source, e.g.
+// s3://bucket/migrations/, into a temporary directory standing in for the
+// migrations directory, and returns it with a function removing it. origin
+// is where the files came from, recorded with every migration applied:
+// source itself, or for git the commit its ref resolved to.
+func fetchSource(ctx context.Context, source, awsRegion string) (dir, origin string, cleanup func(), err error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%s: %w", msg("invalid source %q", source), err)
+	}
+	if dir, err = os.MkdirTemp("", "migo-source-"); err != nil {
+		return "", "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	origin = sourceOrigin(u)
+	var files int
+	switch {
+	case u.Scheme == "s3":
+		files, err = fetchS3(ctx, u, awsRegion, dir)
+	case u.Scheme == "gs":
+		files, err = fetchGCS(ctx, u, dir)
+	case strings.HasPrefix(u.Scheme, "git+"):
+		files, origin, err = fetchGit(ctx, u, dir)
+	case u.Scheme == "https":
+		files, origin, err = fetchManifest(ctx, u, dir)
+	default:
+		err = errors.New(msg("unsupported source %q, expected s3://bucket/prefix, gs://bucket/prefix, git+https://host/repo.git#ref:path or an https:// manifest", source))
+	}
+	if err == nil && files == 0 {
+		err = errors.New(msg("no migration files found at %s", sourceOrigin(u)))
+	}
+	if err != nil {
+		cleanup()
+		return "", "", nil, err
+	}
+	slog.Info("Fetched migrations", "source", origin, "files", files)
+	return dir, origin, cleanup, nil
+}
+
+// sourceOrigin returns u without credentials, for logs and the audit
+// trail.
+func sourceOrigin(u *url.URL) string {
+	c := *u
+	c.User = nil
+	return c.String()
+}
+
+// isSourceFile reports whether name, relative to the root of a source, is
+// a file worth fetching: a migration, compressed or not.
+func isSourceFile(name string) bool {
+	return strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql.gz")
+}
+
+// isSignedManifest reports whether name, relative to the root of a source,
+// is its signed manifest or the signature, fetched along with the
+// migrations without counting as one.
+func isSignedManifest(name string) bool {
+	return name == manifestFile || name == signatureFile
+}
+
+// writeSourceFile copies r to name, a slash-separated path relative to the
+// root of a source, under dir. Names escaping dir are refused. The file is
+// downloaded to a temporary file first and only renamed into place once
+// complete and, when sum isn't empty, matching that SHA-256, so a failed
+// or tampered download never leaves a file behind.
+func writeSourceFile(dir, name string, r io.Reader, sum string) error {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return errors.New(msg("invalid file name %q in source", name))
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); sum != "" && got != sum {
+		return errors.New(msg("checksum mismatch for %s: the manifest has %s, the download %s", name, sum, got))
+	}
+	return os.Rename(f.Name(), path)
+}
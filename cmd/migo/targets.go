@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bagastri07/migo"
+)
+
+// TenantsConfig selects the tenant schemas `up --tenants` migrates: the
+// schemas whose name is LIKE Pattern, or the names Query returns.
+type TenantsConfig struct {
+	Pattern string `yaml:"pattern"` // e.g. tenant_%
+	Query   string `yaml:"query"`   // e.g. SELECT schema_name FROM tenants WHERE active
+}
+
+// ShardConfig is a database `up` and `up-to` migrate when shards are
+// configured, in place of the --dsn database.
+type ShardConfig struct {
+	Name string `yaml:"name"`
+	DSN  string `yaml:"dsn"`
+}
+
+// ComponentConfig is an independently migrated component of a monorepo:
+// its migrations directories and the suffix of its bookkeeping tables.
+type ComponentConfig struct {
+	Name string  `yaml:"name"`
+	Dir  dirList `yaml:"dir"`
+}
+
+// targetResult is the outcome of a run against one tenant schema or shard.
+type targetResult struct {
+	name    string
+	applied int
+	err     error
+	skipped bool // not attempted after an earlier failure
+}
+
+// tenantSchemas returns the tenant schemas in a stable order.
+func tenantSchemas(ctx context.Context, db *sql.DB, cfg TenantsConfig) ([]string, error) {
+	query, args := cfg.Query, []any{}
+	if query == "" {
+		query, args = `SELECT nspname FROM pg_namespace WHERE nspname LIKE $1 ORDER BY nspname`, []any{cfg.Pattern}
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant schemas: %w", err)
+	}
+	defer rows.Close()
+	var schemas []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, fmt.Errorf("failed to list tenant schemas: %w", err)
+		}
+		schemas = append(schemas, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(schemas) == 0 {
+		return nil, errors.New(msg("no tenant schemas found"))
+	}
+	return schemas, nil
+}
+
+// upTenants applies the pending migrations up to version to every tenant
+// schema, each with its own bookkeeping table, and reports the outcome per
+// tenant. It stops at the first failing tenant unless --continue-on-error
+// is set.
+func upTenants(ctx context.Context, drv *migo.Postgres, opts migo.Options, cfg TenantsConfig, version int64) error {
+	schemas, err := tenantSchemas(ctx, drv.DB(), cfg)
+	if err != nil {
+		return err
+	}
+	results := make([]targetResult, len(schemas))
+	failed := false
+	for i, schema := range schemas {
+		results[i].name = schema
+		if failed && !continueOnError {
+			results[i].skipped = true
+			continue
+		}
+		o := targetOptions(opts, "tenant", schema, &results[i])
+		if results[i].err = migo.New(drv.WithSchema(schema), o).UpTo(ctx, version); results[i].err != nil {
+			slog.Error("Tenant failed", "tenant", schema, "err", results[i].err)
+			failed = true
+		}
+	}
+	return reportTargets(msg("Tenant"), "tenant", results)
+}
+
+// upShards applies the pending migrations up to version to every shard
+// and reports the outcome per shard. connect opens a shard the way the
+// --dsn database is opened, and component, when set, names the
+// bookkeeping tables. It stops at the first failing shard unless
+// --continue-on-error is set.
+func upShards(ctx context.Context, cfg *Config, connect func(string) (*sql.DB, func(context.Context) (string, error), error), opts migo.Options, component string, version int64) error {
+	shards := cfg.Shards
+	seen := make(map[string]bool, len(shards))
+	for i, s := range shards {
+		if s.Name == "" || s.DSN == "" {
+			return errors.New(msg("shard %d needs a name and a dsn", i+1))
+		}
+		if seen[s.Name] {
+			return errors.New(msg("duplicate shard %q", s.Name))
+		}
+		seen[s.Name] = true
+	}
+	results := make([]targetResult, len(shards))
+	failed := false
+	for i, s := range shards {
+		results[i].name = s.Name
+		if failed && !continueOnError {
+			results[i].skipped = true
+			continue
+		}
+		results[i].err = func() error {
+			db, _, err := connect(s.DSN)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			o := targetOptions(opts, "shard", s.Name, &results[i])
+			return migo.New(cfg.driver(db).WithComponent(component), o).UpTo(ctx, version)
+		}()
+		if results[i].err != nil {
+			slog.Error("Shard failed", "shard", s.Name, "err", results[i].err)
+			failed = true
+		}
+	}
+	return reportTargets(msg("Shard"), "shard", results)
+}
+
+// selectComponents returns the components named, in the order of the
+// config, or all of them when none is named.
+func (c *Config) selectComponents(names []string) ([]ComponentConfig, error) {
+	if len(names) > 0 && len(c.Components) == 0 {
+		return nil, errors.New(msg("--component needs components in the config"))
+	}
+	seen := make(map[string]bool, len(c.Components))
+	for i, comp := range c.Components {
+		if comp.Name == "" || len(comp.Dir) == 0 {
+			return nil, errors.New(msg("component %d needs a name and a dir", i+1))
+		}
+		if seen[comp.Name] {
+			return nil, errors.New(msg("duplicate component %q", comp.Name))
+		}
+		seen[comp.Name] = true
+	}
+	for _, name := range names {
+		if !seen[name] {
+			return nil, errors.New(msg("unknown component %q", name))
+		}
+	}
+	if len(names) == 0 {
+		return c.Components, nil
+	}
+	var selected []ComponentConfig
+	for _, comp := range c.Components {
+		if slices.Contains(names, comp.Name) {
+			selected = append(selected, comp)
+		}
+	}
+	return selected, nil
+}
+
+// upComponents applies the pending migrations up to version of every
+// component, each with its own bookkeeping tables, and reports the outcome
+// per component. It stops at the first failing component unless
+// --continue-on-error is set.
+func upComponents(ctx context.Context, drv *migo.Postgres, opts migo.Options, components []ComponentConfig, version int64) error {
+	results := make([]targetResult, len(components))
+	failed := false
+	for i, comp := range components {
+		results[i].name = comp.Name
+		if failed && !continueOnError {
+			results[i].skipped = true
+			continue
+		}
+		o := targetOptions(opts, "component", comp.Name, &results[i])
+		o.Dir, o.Dirs = comp.Dir[0], comp.Dir
+		if results[i].err = migo.New(drv.WithComponent(comp.Name), o).UpTo(ctx, version); results[i].err != nil {
+			slog.Error("Component failed", "component", comp.Name, "err", results[i].err)
+			failed = true
+		}
+	}
+	return reportTargets(msg("Component"), "component", results)
+}
+
+// targetOptions returns opts for a run against one target: logs carry the
+// target under key and finished migrations are counted in r.
+func targetOptions(opts migo.Options, key, name string, r *targetResult) migo.Options {
+	o := opts
+	o.Logger = opts.Logger.With(key, name)
+	o.OnEvent = func(e migo.Event) {
+		if e.Kind == migo.EventMigrationFinished {
+			r.applied++
+		}
+		if opts.OnEvent != nil {
+			opts.OnEvent(e)
+		}
+	}
+	return o
+}
+
+// reportTargets prints the outcome per target and returns an error naming
+// how many failed. title heads the table and key names the target in
+// plain output.
+func reportTargets(title, key string, results []targetResult) error {
+	failed, skipped := 0, 0
+	for _, r := range results {
+		switch {
+		case r.skipped:
+			skipped++
+		case r.err != nil:
+			failed++
+		}
+	}
+	if plainOutput {
+		for _, r := range results {
+			status, errText := "ok", ""
+			switch {
+			case r.skipped:
+				status = "skipped"
+			case r.err != nil:
+				status, errText = "failed", r.err.Error()
+			}
+			printRecord(key, r.name, "status", status, "applied", r.applied, "error", errText)
+		}
+		printRecord("targets", len(results), "failed", failed, "skipped", skipped)
+	} else {
+		fmt.Printf("%-30s %-8s %-8s %s\n", title, msg("Status"), msg("Applied"), msg("Error"))
+		fmt.Println("------------------------------------------------------------------------------")
+		for _, r := range results {
+			status, style, errText := msg("ok"), styleGreen, ""
+			switch {
+			case r.skipped:
+				status, style = msg("skipped"), styleYellow
+			case r.err != nil:
+				status, style, errText = msg("failed"), styleRed, r.err.Error()
+			}
+			fmt.Println(strings.TrimRight(fmt.Sprintf("%-30s %s %-8d %s", r.name, cell(style, status, 8), r.applied, errText), " "))
+		}
+		fmt.Println("------------------------------------------------------------------------------")
+		fmt.Println(msg("%d of %d succeeded, %d failed, %d skipped", len(results)-failed-skipped, len(results), failed, skipped))
+	}
+	if failed > 0 {
+		return errors.New(msg("%d of %d %s(s) failed", failed, len(results), key))
+	}
+	return nil
+}
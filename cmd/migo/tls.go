@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// sslModes are the sslmode values lib/pq supports.
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// TLSConfig sets the TLS parameters of the connection, so they don't have
+// to be assembled into the DSN by hand. Empty fields leave the DSN alone.
+type TLSConfig struct {
+	SSLMode     string `yaml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert"` // CA certificates verifying the server
+	SSLCert     string `yaml:"sslcert"`     // client certificate
+	SSLKey      string `yaml:"sslkey"`      // key of the client certificate
+}
+
+func (t TLSConfig) empty() bool {
+	return t == TLSConfig{}
+}
+
+// validate checks the settings and their files before connecting, since
+// lib/pq reports missing or unreadable files with little context.
+func (t TLSConfig) validate() error {
+	if t.SSLMode != "" && !slices.Contains(sslModes, t.SSLMode) {
+		return errors.New(msg("unsupported sslmode %q, expected one of %s", t.SSLMode, strings.Join(sslModes, ", ")))
+	}
+	if t.SSLMode == "disable" && (t.SSLRootCert != "" || t.SSLCert != "" || t.SSLKey != "") {
+		return errors.New(msg("sslmode disable turns TLS off; remove --sslrootcert, --sslcert and --sslkey or choose another mode"))
+	}
+	if (t.SSLCert == "") != (t.SSLKey == "") {
+		return errors.New(msg("--sslcert and --sslkey must be set together"))
+	}
+
+	if t.SSLRootCert != "" {
+		data, err := readTLSFile("sslrootcert", t.SSLRootCert)
+		if err != nil {
+			return err
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			return errors.New(msg("sslrootcert %s contains no PEM certificate", t.SSLRootCert))
+		}
+	}
+	if t.SSLCert != "" {
+		if _, err := readTLSFile("sslcert", t.SSLCert); err != nil {
+			return err
+		}
+		if _, err := readTLSFile("sslkey", t.SSLKey); err != nil {
+			return err
+		}
+		if _, err := tls.LoadX509KeyPair(t.SSLCert, t.SSLKey); err != nil {
+			return errors.New(msg("sslcert %s and sslkey %s don't form a key pair: %s", t.SSLCert, t.SSLKey, err))
+		}
+		// lib/pq refuses keys readable by others, like libpq.
+		if info, err := os.Stat(t.SSLKey); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			return errors.New(msg("sslkey %s is readable by group or others; run chmod 600 %s", t.SSLKey, t.SSLKey))
+		}
+	}
+	return nil
+}
+
+// readTLSFile reads the file of a TLS setting, naming the setting when it
+// can't.
+func readTLSFile(setting, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, errors.New(msg("%s file %s does not exist", setting, path))
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", setting, err)
+	}
+	return data, nil
+}
+
+// apply validates t and sets its parameters on dsn.
+func (t TLSConfig) apply(dsn string) (string, error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+	params := []struct{ key, value string }{
+		{"sslmode", t.SSLMode},
+		{"sslrootcert", t.SSLRootCert},
+		{"sslcert", t.SSLCert},
+		{"sslkey", t.SSLKey},
+	}
+	var err error
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		if dsn, err = setDSNParam(dsn, p.key, p.value); err != nil {
+			return "", err
+		}
+	}
+	return dsn, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bagastri07/migo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingEnabled reports whether an OTLP endpoint was configured by flag or
+// by the standard OpenTelemetry environment variables.
+func tracingEnabled(endpoint string) bool {
+	return endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// tracer records a span per command with a child span per migration, built
+// from migrator events. When TRACEPARENT is set, e.g. by a traced deploy
+// pipeline, the command span joins that trace.
+type tracer struct {
+	tp        *sdktrace.TracerProvider
+	tr        trace.Tracer
+	ctx       context.Context
+	run       trace.Span
+	migration trace.Span
+}
+
+func newTracer(ctx context.Context, endpoint, cmd string) (*tracer, error) {
+	var opts []otlptracehttp.Option
+	if endpoint != "" {
+		// Like OTEL_EXPORTER_OTLP_ENDPOINT, a base URL gets the traces path.
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+		}
+		if strings.Trim(u.Path, "/") == "" {
+			u.Path = "/v1/traces"
+		}
+		opts = append(opts, otlptracehttp.WithEndpointURL(u.String()))
+	}
+	exp, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "migo")),
+		resource.WithFromEnv(), // OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+
+	parent := propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	})
+	t := &tracer{tp: tp, tr: tp.Tracer("github.com/bagastri07/migo")}
+	t.ctx, t.run = t.tr.Start(parent, "migo "+cmd, trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("migo.command", cmd),
+	))
+	return t, nil
+}
+
+func (t *tracer) observe(e migo.Event) {
+	switch e.Kind {
+	case migo.EventRunStarted:
+		t.run.SetAttributes(attribute.String("migo.direction", string(e.Direction)), attribute.Int("migo.total", e.Total), attribute.String("migo.run_id", e.RunID))
+	case migo.EventMigrationStarted:
+		_, t.migration = t.tr.Start(t.ctx, "migration "+migrationLabel(e.Version, e.Name, e.Repeatable),
+			trace.WithTimestamp(e.Time),
+			trace.WithAttributes(
+				attribute.Int64("migo.version", e.Version),
+				attribute.String("migo.name", e.Name),
+				attribute.String("migo.direction", string(e.Direction)),
+			))
+	case migo.EventMigrationFinished, migo.EventMigrationFailed:
+		if t.migration == nil {
+			return
+		}
+		t.migration.SetAttributes(
+			attribute.Int64("migo.duration_ms", e.Duration.Milliseconds()),
+			attribute.Int64("migo.rows_affected", e.Rows),
+		)
+		if e.Err != nil {
+			t.migration.RecordError(e.Err)
+			t.migration.SetStatus(codes.Error, e.Err.Error())
+		}
+		t.migration.End(trace.WithTimestamp(e.Time))
+		t.migration = nil
+	case migo.EventRunFinished:
+		if e.Server == nil {
+			return
+		}
+		t.run.SetAttributes(
+			attribute.String("db.system.version", e.Server.Version),
+			attribute.String("server.address", e.Server.Host),
+			attribute.String("db.namespace", e.Server.Database),
+		)
+		for name, value := range e.Server.Settings {
+			t.run.SetAttributes(attribute.String("migo.setting."+name, value))
+		}
+	}
+}
+
+// finish ends the command span and flushes all spans to the exporter.
+func (t *tracer) finish(err error) error {
+	if err != nil {
+		t.run.RecordError(err)
+		t.run.SetStatus(codes.Error, err.Error())
+	}
+	t.run.End()
+	if err := t.tp.Shutdown(context.WithoutCancel(t.ctx)); err != nil {
+		return fmt.Errorf("failed to export traces: %w", err)
+	}
+	return nil
+}
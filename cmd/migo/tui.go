@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bagastri07/migo"
+	"golang.org/x/term"
+)
+
+// Keys understood by the terminal UI.
+const (
+	keyUp = iota + 1
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyEnter
+	keyEscape
+	keyInterrupt
+)
+
+// tuiScreen is the state of `migo tui`: the migration list, the SQL view of
+// the selected migration and the progress of a running apply or rollback.
+type tuiScreen struct {
+	drv  *migo.Postgres
+	opts migo.Options
+
+	infos    []migo.MigrationInfo
+	selected int
+	offset   int  // first visible row of the list or the SQL view
+	viewing  bool // showing the SQL of the selected migration
+	pending  func() error
+	question string
+	running  bool
+	done     chan error // receives the result of a run
+	status   string
+	width    int
+	height   int
+}
+
+// tui runs the interactive terminal UI until it is quit. Migrations run on
+// their own Migrator whose events drive the progress line, and library logs
+// are discarded so they don't tear the screen.
+func tui(ctx context.Context, drv *migo.Postgres, opts migo.Options) error {
+	if !interactive() || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New(msg("tui needs an interactive terminal"))
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan int)
+	go readKeys(keys)
+
+	events := make(chan migo.Event, 16)
+	opts.Logger = slog.New(slog.DiscardHandler)
+	opts.OnEvent = func(e migo.Event) { events <- e }
+
+	s := &tuiScreen{drv: drv, opts: opts, done: make(chan error, 1)}
+	s.refresh(ctx)
+	for {
+		s.draw()
+		select {
+		case e := <-events:
+			s.progress(e)
+		case err := <-s.done:
+			s.running = false
+			switch {
+			case errors.Is(err, migo.ErrNoRollback):
+				s.status = msg("No migrations to rollback")
+			case err != nil:
+				s.status = msg("Failed: %s", err)
+			default:
+				s.status = msg("Done")
+			}
+			s.refresh(ctx)
+		case k := <-keys:
+			// A run is never abandoned halfway; quitting waits for it.
+			if s.running {
+				continue
+			}
+			if k == keyInterrupt || (k == 'q' && !s.viewing && s.question == "") {
+				return nil
+			}
+			if s.question != "" {
+				run := s.pending
+				s.question, s.pending = "", nil
+				if k == 'y' {
+					s.start(run)
+				}
+				continue
+			}
+			s.key(ctx, k)
+		}
+	}
+}
+
+// key handles a key pressed while no run or question is in progress.
+func (s *tuiScreen) key(ctx context.Context, k int) {
+	page := max(s.height-4, 1)
+	if s.viewing {
+		switch k {
+		case keyUp, 'k':
+			s.offset = max(s.offset-1, 0)
+		case keyDown, 'j':
+			s.offset++
+		case keyPageUp:
+			s.offset = max(s.offset-page, 0)
+		case keyPageDown:
+			s.offset += page
+		case keyEscape, keyEnter, 'q':
+			s.viewing, s.offset = false, 0
+		}
+		return
+	}
+
+	switch k {
+	case keyUp, 'k':
+		s.selected = max(s.selected-1, 0)
+	case keyDown, 'j':
+		s.selected = min(s.selected+1, len(s.infos)-1)
+	case keyPageUp:
+		s.selected = max(s.selected-page, 0)
+	case keyPageDown:
+		s.selected = min(s.selected+page, len(s.infos)-1)
+	case keyEnter:
+		if len(s.infos) > 0 {
+			s.viewing, s.offset = true, 0
+		}
+	case 'r':
+		s.refresh(ctx)
+		s.status = ""
+	case 'u':
+		if len(s.infos) > 0 {
+			s.confirmUp(ctx)
+		}
+	case 'd':
+		if len(s.infos) > 0 {
+			s.confirmDown(ctx)
+		}
+	}
+}
+
+// confirmUp asks to apply the pending migrations up to the selected one.
+func (s *tuiScreen) confirmUp(ctx context.Context) {
+	target := s.infos[s.selected].Version
+	m := migo.New(s.drv, s.opts)
+	plan, err := m.PlanTo(ctx, target)
+	if err != nil {
+		s.status = msg("Failed: %s", err)
+		return
+	}
+	if len(plan) == 0 {
+		s.status = msg("No pending migrations")
+		return
+	}
+	s.ask(msg("Apply %d migration(s) up to %d?", len(plan), target), func() error {
+		return m.UpTo(context.WithoutCancel(ctx), target)
+	})
+}
+
+// confirmDown asks to roll back the applied migrations newer than or equal
+// to the selected one, newest first.
+func (s *tuiScreen) confirmDown(ctx context.Context) {
+	target := s.infos[s.selected].Version
+	count := 0
+	for _, i := range s.infos {
+		if i.Version >= target && i.Record != nil && i.Record.Status == migo.StatusApplied {
+			count++
+		}
+	}
+	if count == 0 {
+		s.status = msg("%d is not applied", target)
+		return
+	}
+	s.ask(msg("Roll back %d migration(s) down to %d?", count, target), func() error {
+		return migo.New(s.drv, s.opts).DownSteps(context.WithoutCancel(ctx), count)
+	})
+}
+
+// ask shows question and starts run once it is answered with y. --yes
+// skips the question.
+func (s *tuiScreen) ask(question string, run func() error) {
+	if assumeYes {
+		s.start(run)
+		return
+	}
+	s.question, s.pending = question, run
+}
+
+func (s *tuiScreen) start(run func() error) {
+	s.running = true
+	s.status = msg("Starting...")
+	go func() { s.done <- run() }()
+}
+
+func (s *tuiScreen) progress(e migo.Event) {
+	switch e.Kind {
+	case migo.EventMigrationStarted:
+		verb := msg("Applying")
+		if e.Direction == migo.DirectionDown {
+			verb = msg("Rolling back")
+		}
+		s.status = fmt.Sprintf("%s %d/%d: %s", verb, e.Index, e.Total, migrationLabel(e.Version, e.Name, e.Repeatable))
+	case migo.EventMigrationFinished:
+		s.status = fmt.Sprintf("%s %d/%d: %s (%s)", msg("Finished"), e.Index, e.Total, migrationLabel(e.Version, e.Name, e.Repeatable), e.Duration.Round(time.Millisecond))
+		for i := range s.infos {
+			if s.infos[i].Version == e.Version && !e.Repeatable {
+				s.infos[i].Record = &migo.Record{Version: e.Version, Name: e.Name, Status: migo.StatusApplied, Checksum: s.infos[i].Checksum}
+				if e.Direction == migo.DirectionDown {
+					s.infos[i].Record = nil
+				}
+			}
+		}
+	case migo.EventMigrationFailed:
+		s.status = msg("Failed: %s", e.Err)
+	}
+}
+
+func (s *tuiScreen) refresh(ctx context.Context) {
+	infos, err := migo.New(s.drv, s.opts).Info(ctx)
+	if err != nil {
+		s.status = msg("Failed: %s", err)
+		return
+	}
+	s.infos = infos
+	s.selected = min(s.selected, max(len(infos)-1, 0))
+}
+
+// draw repaints the whole screen. The terminal is in raw mode, so lines end
+// with \r\n.
+func (s *tuiScreen) draw() {
+	s.width, s.height = 80, 24
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		s.width, s.height = w, h
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	// line writes text cut to the screen width, wrapped in the SGR style.
+	line := func(style, text string) {
+		if r := []rune(text); len(r) > s.width {
+			text = string(r[:s.width])
+		}
+		if style != "" {
+			text = "\x1b[" + style + "m" + text + "\x1b[0m"
+		}
+		b.WriteString(text + "\r\n")
+	}
+	rows := max(s.height-4, 1)
+
+	if s.viewing {
+		i := s.infos[s.selected]
+		line("1", fmt.Sprintf("%d_%s", i.Version, i.Name))
+		text := "-- +up\n" + i.UpSQL
+		if i.VerifySQL != "" {
+			text += "\n-- +verify\n" + i.VerifySQL
+		}
+		body := strings.Split(text+"\n-- +down\n"+i.DownSQL, "\n")
+		s.offset = min(s.offset, max(len(body)-rows, 0))
+		for _, l := range body[s.offset:min(s.offset+rows, len(body))] {
+			line("", strings.ReplaceAll(l, "\t", "    "))
+		}
+	} else {
+		line("1", fmt.Sprintf("%-16s %-30s %-10s %-8s", msg("Version"), msg("Name"), msg("Status"), msg("Valid")))
+		if s.selected < s.offset {
+			s.offset = s.selected
+		}
+		if s.selected >= s.offset+rows {
+			s.offset = s.selected - rows + 1
+		}
+		for n := s.offset; n < min(s.offset+rows, len(s.infos)); n++ {
+			i := s.infos[n]
+			status, valid := "pending", ""
+			if i.Record != nil {
+				status, valid = i.Record.Status, msg("YES")
+				if !i.Valid() {
+					valid = msg("CHANGED")
+				}
+			}
+			style := ""
+			if n == s.selected {
+				style = "7"
+			}
+			line(style, fmt.Sprintf("%-16d %-30s %-10s %-8s", i.Version, i.Name, status, valid))
+		}
+	}
+
+	b.WriteString(fmt.Sprintf("\x1b[%d;1H", s.height-1))
+	switch {
+	case s.question != "":
+		line("1", s.question+" [y/N]")
+	default:
+		line("", s.status)
+	}
+	switch {
+	case s.running:
+		b.WriteString(msg("running, wait for it to finish"))
+	case s.viewing:
+		b.WriteString(msg("up/down scroll, esc back"))
+	default:
+		b.WriteString(msg("up/down select, enter SQL, u apply to, d roll back to, r refresh, q quit"))
+	}
+	fmt.Print(b.String())
+}
+
+// readKeys sends the keys read from stdin to keys. Escape sequences are
+// decoded for the arrow and page keys; other bytes are sent as read.
+func readKeys(keys chan<- int) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			keys <- keyInterrupt
+			return
+		}
+		switch seq := string(buf[:n]); seq {
+		case "\x1b[A", "\x1bOA":
+			keys <- keyUp
+		case "\x1b[B", "\x1bOB":
+			keys <- keyDown
+		case "\x1b[5~":
+			keys <- keyPageUp
+		case "\x1b[6~":
+			keys <- keyPageDown
+		case "\r", "\n":
+			keys <- keyEnter
+		case "\x1b":
+			keys <- keyEscape
+		case "\x03":
+			keys <- keyInterrupt
+		default:
+			if n == 1 {
+				keys <- int(buf[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultSecret is the part of a Vault read response migo uses.
+type vaultSecret struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"` // seconds
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+}
+
+// vaultClient talks to the Vault HTTP API at VAULT_ADDR with VAULT_TOKEN,
+// or the token the vault CLI stored in ~/.vault-token.
+type vaultClient struct {
+	addr, token, namespace string
+	client                 *http.Client
+}
+
+func newVaultClient() (*vaultClient, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return nil, errors.New(msg("--vault-path needs VAULT_ADDR"))
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			data, _ := os.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if token == "" {
+		return nil, errors.New(msg("--vault-path needs VAULT_TOKEN or a vault login"))
+	}
+	return &vaultClient{addr: addr, token: token, namespace: os.Getenv("VAULT_NAMESPACE"), client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (v *vaultClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(data, &e)
+		return fmt.Errorf("vault %s %s returned %s: %s", method, path, resp.Status, strings.Join(e.Errors, "; "))
+	}
+	return json.Unmarshal(data, out)
+}
+
+// vaultDSN reads path from Vault and returns dsn with its credentials:
+// username and password as issued by the database secrets engine, or a
+// password or whole dsn/url stored in a KV secret. Renewable leases are
+// renewed until the returned stop function is called, so credentials
+// outlive their TTL during long runs.
+func vaultDSN(ctx context.Context, dsn, path string) (string, func(), error) {
+	v, err := newVaultClient()
+	if err != nil {
+		return "", nil, err
+	}
+	var secret vaultSecret
+	if err := v.do(ctx, http.MethodGet, path, nil, &secret); err != nil {
+		return "", nil, err
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = inner // KV version 2
+	}
+	field := func(name string) string {
+		s, _ := data[name].(string)
+		return s
+	}
+
+	switch {
+	case field("dsn") != "":
+		dsn = field("dsn")
+	case field("url") != "":
+		dsn = field("url")
+	case field("password") != "":
+		if dsn == "" {
+			return "", nil, errors.New(msg("Vault secret %s has no dsn; set the host and database with --dsn", path))
+		}
+		if dsn, err = setDSNCredentials(dsn, field("username"), field("password")); err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, errors.New(msg("Vault secret %s has no dsn, url or password", path))
+	}
+
+	stop := func() {}
+	if secret.Renewable && secret.LeaseID != "" && secret.LeaseDuration > 0 {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		go v.renew(ctx, secret)
+		stop = cancel
+	}
+	return dsn, stop, nil
+}
+
+// renew renews the lease of secret when two thirds of its duration have
+// passed, until ctx is done or Vault refuses to extend it.
+func (v *vaultClient) renew(ctx context.Context, secret vaultSecret) {
+	ttl := time.Duration(secret.LeaseDuration) * time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ttl * 2 / 3):
+		}
+		var renewed vaultSecret
+		err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]any{"lease_id": secret.LeaseID, "increment": secret.LeaseDuration}, &renewed)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Failed to renew Vault lease", "lease_id", secret.LeaseID, "err", err)
+			}
+			return
+		}
+		slog.Debug("Renewed Vault lease", "lease_id", secret.LeaseID, "ttl", time.Duration(renewed.LeaseDuration)*time.Second)
+		if renewed.LeaseDuration <= 0 {
+			return
+		}
+		if renewed.LeaseDuration < secret.LeaseDuration/3 {
+			slog.Warn("Vault lease is close to its max TTL and can't be renewed further", "lease_id", secret.LeaseID, "ttl", time.Duration(renewed.LeaseDuration)*time.Second)
+		}
+		ttl = time.Duration(renewed.LeaseDuration) * time.Second
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// Backoff between connection attempts with --wait.
+const (
+	waitInitialDelay = 250 * time.Millisecond
+	waitMaxDelay     = 5 * time.Second
+)
+
+// ping checks the connection to db. With wait it retries connection errors
+// that can go away on their own, doubling the delay between attempts, until
+// timeout passes; a timeout of 0 waits forever.
+func ping(ctx context.Context, db *sql.DB, wait bool, timeout time.Duration) error {
+	err := db.PingContext(ctx)
+	if err == nil || !wait || !transientConnectError(err) {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	delay := waitInitialDelay
+	for attempt := 2; ; attempt++ {
+		slog.Info("Waiting for the database", "attempt", attempt-1, "retry_in", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		if err = db.PingContext(ctx); err == nil {
+			slog.Info("Database is ready", "attempts", attempt, "waited", time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+		if ctx.Err() != nil || !transientConnectError(err) {
+			return err
+		}
+		delay = min(delay*2, waitMaxDelay)
+	}
+}
+
+// transientConnectError reports whether err is a connection failure worth
+// retrying while the server starts: refused or dropped connections and
+// "the database system is starting up". Rejected logins and missing
+// databases are not retried.
+func transientConnectError(err error) bool {
+	var pgErr interface{ SQLState() string }
+	var netErr net.Error
+	switch {
+	case errors.As(err, &pgErr):
+		code := pgErr.SQLState()
+		return strings.HasPrefix(code, "08") || code == "57P03"
+	case errors.As(err, &netErr), errors.Is(err, driver.ErrBadConn):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bagastri07/migo"
+)
+
+var (
+	watchInterval time.Duration
+	watchDebounce time.Duration
+)
+
+func watchFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&watchInterval, "interval", 500*time.Millisecond, "How often to look for changed migration files")
+	fs.DurationVar(&watchDebounce, "debounce", 300*time.Millisecond, "How long files must stay unchanged before they are applied")
+}
+
+// watch applies the pending migrations of dirs, then again whenever their
+// files change, until interrupted. Failed runs are logged and the next
+// change is retried, so a typo doesn't end the session.
+func watch(ctx context.Context, m *migo.Migrator, dirs []string) error {
+	if watchInterval <= 0 {
+		return errors.New(msg("--interval must be positive"))
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	apply := func() {
+		if err := m.Up(ctx); err != nil && ctx.Err() == nil {
+			var cErr *migo.ChecksumError
+			if errors.As(err, &cErr) {
+				slog.Error("Applied migration was edited; roll it back with down before changing it", "error", err)
+			} else {
+				slog.Error("Watch run failed", "error", err)
+			}
+		}
+	}
+
+	slog.Info("Watching for migration changes", "dir", strings.Join(dirs, ","))
+	seen, _ := dirFingerprint(dirs)
+	apply()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped watching")
+			return nil
+		case <-ticker.C:
+		}
+		current, err := dirFingerprint(dirs)
+		if err != nil || current == seen {
+			continue
+		}
+		// Editors save in several steps; wait for the files to settle.
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Stopped watching")
+				return nil
+			case <-time.After(watchDebounce):
+			}
+			settled, err := dirFingerprint(dirs)
+			if err != nil || settled == current {
+				break
+			}
+			current = settled
+		}
+		seen = current
+		slog.Info("Migration files changed")
+		apply()
+	}
+}
+
+// dirFingerprint describes the names, sizes and modification times of the
+// .sql and .sql.gz files in dirs and their subdirectories, so any change
+// to them changes it.
+func dirFingerprint(dirs []string) (string, error) {
+	var parts []string
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if d.IsDir() || !strings.HasSuffix(d.Name(), ".sql") && !strings.HasSuffix(d.Name(), ".sql.gz") {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				parts = append(parts, fmt.Sprintf("%s:%d:%d", p, info.Size(), info.ModTime().UnixNano()))
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, "\n"), nil
+}
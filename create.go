@@ -0,0 +1,100 @@
+package migo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const migrationTemplate = `-- +up
+-- SQL statements for migration UP go here
+
+-- +down
+-- SQL statements for migration DOWN go here
+`
+
+const flywayTemplate = `-- SQL statements for the migration go here
+`
+
+// Create writes a new, empty migration file named after the current time
+// in UTC into dir and returns its path. A version another file in dir
+// already has is bumped by a second.
+func Create(dir, name string) (string, error) {
+	return CreateWithClock(dir, name, SystemClock)
+}
+
+// CreateWithClock is Create with the version taken from clock.
+func CreateWithClock(dir, name string, clock Clock) (string, error) {
+	return FilenameFormat{}.Create(dir, name, clock)
+}
+
+// Create is CreateWithClock for a file named f. Sequential versions
+// follow the latest migration in dir.
+func (f FilenameFormat) Create(dir, name string, clock Clock) (string, error) {
+	return f.create(dir, name, clock, migrationTemplate)
+}
+
+// CreateFlyway is CreateWithClock for Flyway migrations: it writes
+// V<version>__<name>.sql, whose whole content is the up section.
+func CreateFlyway(dir, name string, clock Clock) (string, error) {
+	return FilenameFormat{Pattern: "V{version}__{name}.sql"}.create(dir, name, clock, flywayTemplate)
+}
+
+// create writes content to a new migration called name in dir, with a
+// version no other file in dir has, and returns its path.
+func (f FilenameFormat) create(dir, name string, clock Clock, content string) (string, error) {
+	parse, err := f.parser()
+	if err != nil {
+		return "", err
+	}
+	taken, err := versionsIn(dir, parse)
+	if err != nil {
+		return "", err
+	}
+	version := f.nextVersion(clock, taken)
+	return createFile(filepath.Join(dir, f.filename(version, strings.ReplaceAll(name, " ", "_"))), content)
+}
+
+// versionsIn returns the versions of the migration files in dir and its
+// subdirectories that parse accepts.
+func versionsIn(dir string, parse func(filename string) (int64, string, error)) (map[int64]bool, error) {
+	files, err := migrationFiles(os.DirFS(dir), ".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	taken := make(map[int64]bool, len(files))
+	for _, p := range files {
+		if v, _, err := parse(strings.TrimSuffix(path.Base(p), gzipSuffix)); err == nil {
+			taken[v] = true
+		}
+	}
+	return taken, nil
+}
+
+// createFile creates path with content, failing if it exists.
+func createFile(path, content string) (string, error) {
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create migrations directory: %w", err)
+	}
+
+	// O_EXCL keeps concurrent invocations from clobbering each other's file
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create migration file: %w", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to create migration file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to create migration file: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,113 @@
+package migo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DependencyViolation is a "-- +depends_on" declaration a plan would
+// break.
+type DependencyViolation struct {
+	Version   int64 // the migration declaring the dependency
+	Name      string
+	DependsOn int64
+	Reason    string // what is wrong with DependsOn, e.g. "is applied after it"
+}
+
+// DependencyError is returned by Up, UpTo, Down, their variants and the
+// plans when the run would apply a migration before one it depends on, or
+// roll back a migration another applied one depends on.
+type DependencyError struct {
+	Violations []DependencyViolation
+}
+
+func (e *DependencyError) Error() string {
+	var b strings.Builder
+	b.WriteString("migration dependencies not satisfied:")
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "\n  %d_%s\n    └─ depends on %d, which %s", v.Version, v.Name, v.DependsOn, v.Reason)
+	}
+	return b.String()
+}
+
+// checkDependencies verifies the dependencies of the migrations plan
+// applies or rolls back, given the history in records.
+func checkDependencies(migrations []*Migration, records map[int64]Record, plan []PlannedMigration) error {
+	files := make(map[int64]*Migration, len(migrations))
+	for _, m := range migrations {
+		files[m.Version] = m
+		for _, v := range m.Squashes {
+			files[v] = m
+		}
+	}
+	position := make(map[int64]int, len(plan))
+	for i, p := range plan {
+		if !p.Repeatable {
+			position[p.Version] = i
+		}
+	}
+	resolve := func(v int64) int64 {
+		if m, ok := files[v]; ok {
+			return m.Version // squashed versions live on in their squash
+		}
+		return v
+	}
+
+	var violations []DependencyViolation
+	for i, p := range plan {
+		if p.Direction == DirectionDown {
+			// Applied migrations depending on p must be rolled back first.
+			for _, m := range migrations {
+				r, ok := records[m.Version]
+				if !ok || !r.Done() || !slices.ContainsFunc(m.DependsOn, func(v int64) bool { return resolve(v) == p.Version }) {
+					continue
+				}
+				switch j, planned := position[m.Version]; {
+				case !planned:
+					violations = append(violations, DependencyViolation{m.Version, m.Name, p.Version, "this rollback removes while it stays applied"})
+				case j > i:
+					violations = append(violations, DependencyViolation{m.Version, m.Name, p.Version, "is rolled back before it, as it has a higher version"})
+				}
+			}
+			continue
+		}
+		if p.Repeatable {
+			continue // runs after every versioned migration
+		}
+
+		for _, dep := range p.migration.DependsOn {
+			v := resolve(dep)
+			j, planned := position[v]
+			var reason string
+			switch {
+			case v == p.Version && len(p.migration.Squashes) > 0:
+				continue // a dependency inside the squashed range, met by its order
+			case v == p.Version:
+				reason = "is the migration itself"
+			case records[v].Done() || records[dep].Done():
+				continue
+			case planned && j < i:
+				continue
+			case planned:
+				reason = "is applied after it, as it has a higher version"
+			case files[v] == nil:
+				reason = "has no migration file and was never applied"
+			default:
+				reason = "is not applied and not part of this run"
+			}
+			violations = append(violations, DependencyViolation{p.Version, p.Name, dep, reason})
+		}
+	}
+	if len(violations) > 0 {
+		return &DependencyError{Violations: violations}
+	}
+	return nil
+}
+
+// dependsOnAny reports whether m depends on one of the migrations of plan.
+func dependsOnAny(m *Migration, plan []PlannedMigration) bool {
+	return slices.ContainsFunc(plan, func(p PlannedMigration) bool {
+		return slices.Contains(m.DependsOn, p.Version) || slices.ContainsFunc(p.migration.Squashes, func(v int64) bool { return slices.Contains(m.DependsOn, v) })
+	})
+}
@@ -0,0 +1,301 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SchemaDiff is the difference between the schemas of two databases,
+// with the DDL turning one into the other. The DDL is a starting point to
+// review, not a guaranteed-correct migration: renames show up as a drop
+// and a create, and data is not carried over.
+type SchemaDiff struct {
+	Items []DriftItem // Expected is the target's definition, Actual the source's
+	Up    []string    // statements turning the source schema into the target
+	Down  []string    // statements turning the target schema back
+}
+
+// Empty reports whether the schemas are the same.
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Items) == 0
+}
+
+// Migration returns the content of a migration file applying the diff.
+func (d *SchemaDiff) Migration() string {
+	var b strings.Builder
+	b.WriteString("-- Generated by migo diff; review before applying.\n-- +up\n")
+	for _, s := range d.Up {
+		b.WriteString(s + "\n")
+	}
+	b.WriteString("\n-- +down\n")
+	for _, s := range d.Down {
+		b.WriteString(s + "\n")
+	}
+	return b.String()
+}
+
+// DiffSchemas compares the tables, columns, indexes and constraints of
+// schema in from and to, and returns the DDL making from match to. Both
+// databases are only read.
+func DiffSchemas(ctx context.Context, from, to *sql.DB, schema string) (*SchemaDiff, error) {
+	src, err := snapshotDB(ctx, from, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect source schema %s: %w", schema, err)
+	}
+	dst, err := snapshotDB(ctx, to, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect target schema %s: %w", schema, err)
+	}
+	items := compareSchemas(dst.objects, src.objects)
+	return &SchemaDiff{
+		Items: items,
+		Up:    diffStatements(items, src, dst),
+		Down:  diffStatements(compareSchemas(src.objects, dst.objects), dst, src),
+	}, nil
+}
+
+// CreateDiff writes a new migration file applying d into dir, named like
+// CreateWithClock, and returns its path.
+func CreateDiff(dir, name string, clock Clock, d *SchemaDiff) (string, error) {
+	return FilenameFormat{}.CreateDiff(dir, name, clock, d)
+}
+
+// CreateDiff is the package's CreateDiff for a file named f.
+func (f FilenameFormat) CreateDiff(dir, name string, clock Clock, d *SchemaDiff) (string, error) {
+	return f.create(dir, name, clock, d.Migration())
+}
+
+// schemaSnapshot is a snapshotSchema with the column order, which the
+// definitions leave out so drift ignores it, but CREATE TABLE needs.
+type schemaSnapshot struct {
+	objects   map[string]string
+	positions map[string]int // "column t.c" → attnum
+}
+
+func snapshotDB(ctx context.Context, db *sql.DB, schema string) (schemaSnapshot, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return schemaSnapshot{}, err
+	}
+	defer tx.Rollback()
+
+	objects, err := snapshotSchema(ctx, tx, schema, (&Postgres{}).bookkeepingTables())
+	if err != nil {
+		return schemaSnapshot{}, err
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT 'column ' || c.relname || '.' || a.attname, a.attnum
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped`, schema)
+	if err != nil {
+		return schemaSnapshot{}, err
+	}
+	defer rows.Close()
+	positions := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var pos int
+		if err := rows.Scan(&key, &pos); err != nil {
+			return schemaSnapshot{}, err
+		}
+		positions[key] = pos
+	}
+	return schemaSnapshot{objects, positions}, rows.Err()
+}
+
+// constraintBacked reports whether index is the index of a primary key,
+// unique or exclusion constraint in objects, which the constraint creates
+// and drops itself.
+func constraintBacked(objects map[string]string, index string) bool {
+	for key := range objects {
+		if c, ok := strings.CutPrefix(key, "constraint "); ok {
+			if _, name, _ := strings.Cut(c, "."); name == index {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// diffStatements returns the DDL turning src into dst, where items compare
+// dst as expected against src as actual. Drops come first, foreign keys
+// before what they reference, then creates, foreign keys last.
+func diffStatements(items []DriftItem, src, dst schemaSnapshot) []string {
+	newTables, droppedTables := map[string]bool{}, map[string]bool{}
+	for _, it := range items {
+		if t, ok := strings.CutPrefix(it.Object, "table "); ok {
+			newTables[t] = it.Kind == DriftMissing
+			droppedTables[t] = it.Kind == DriftUnexpected
+		}
+	}
+
+	var fkDrops, drops, columnDrops, tableDrops []string
+	var tableCreates, creates, constraintAdds, fkAdds, indexCreates []string
+	for _, it := range items {
+		kind, obj, _ := strings.Cut(it.Object, " ")
+		table, name, _ := strings.Cut(obj, ".")
+		gone := it.Kind == DriftUnexpected || it.Kind == DriftChanged
+		added := it.Kind == DriftMissing || it.Kind == DriftChanged
+		switch kind {
+		case "table":
+			if it.Kind == DriftMissing {
+				tableCreates = append(tableCreates, createTable(table, dst))
+			} else {
+				tableDrops = append(tableDrops, fmt.Sprintf("DROP TABLE %s;", sqlIdent(table)))
+			}
+
+		case "column":
+			switch {
+			case it.Kind == DriftMissing && !newTables[table]:
+				creates = append(creates, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", sqlIdent(table), sqlIdent(name), columnDef(table, name, it.Expected)))
+			case it.Kind == DriftUnexpected && !droppedTables[table]:
+				columnDrops = append(columnDrops, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", sqlIdent(table), sqlIdent(name)))
+			case it.Kind == DriftChanged:
+				creates = append(creates, alterColumn(table, name, it.Actual, it.Expected)...)
+			}
+
+		case "constraint":
+			// Column definitions carry NOT NULL, which PostgreSQL 18 also
+			// lists as constraints.
+			fk := strings.HasPrefix(it.Actual, "FOREIGN KEY") || strings.HasPrefix(it.Expected, "FOREIGN KEY")
+			if gone && !strings.HasPrefix(it.Actual, "NOT NULL ") && (fk || !droppedTables[table]) {
+				stmt := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", sqlIdent(table), sqlIdent(name))
+				if fk {
+					fkDrops = append(fkDrops, stmt)
+				} else {
+					drops = append(drops, stmt)
+				}
+			}
+			if added && !strings.HasPrefix(it.Expected, "NOT NULL ") {
+				stmt := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;", sqlIdent(table), sqlIdent(name), it.Expected)
+				if strings.HasPrefix(it.Expected, "FOREIGN KEY") {
+					fkAdds = append(fkAdds, stmt)
+				} else {
+					constraintAdds = append(constraintAdds, stmt)
+				}
+			}
+
+		case "index":
+			if gone && !constraintBacked(src.objects, obj) {
+				if m := reIndexTable.FindStringSubmatch(it.Actual); m == nil || !droppedTables[strings.Trim(m[1], `"`)] {
+					drops = append(drops, fmt.Sprintf("DROP INDEX %s;", sqlIdent(obj)))
+				}
+			}
+			if added && !constraintBacked(dst.objects, obj) {
+				indexCreates = append(indexCreates, it.Expected+";")
+			}
+		}
+	}
+	return slices.Concat(fkDrops, drops, columnDrops, tableDrops, tableCreates, creates, constraintAdds, fkAdds, indexCreates)
+}
+
+// createTable returns the CREATE TABLE of table in s, with its columns in
+// their original order. Constraints and indexes are added separately.
+func createTable(table string, s schemaSnapshot) string {
+	var columns []string
+	for key := range s.objects {
+		if c, ok := strings.CutPrefix(key, "column "); ok && strings.HasPrefix(c, table+".") {
+			columns = append(columns, key)
+		}
+	}
+	slices.SortFunc(columns, func(a, b string) int { return s.positions[a] - s.positions[b] })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %s (", sqlIdent(table))
+	for i, key := range columns {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		name := strings.TrimPrefix(key, "column "+table+".")
+		fmt.Fprintf(&b, "\n    %s %s", sqlIdent(name), columnDef(table, name, s.objects[key]))
+	}
+	b.WriteString("\n);")
+	return b.String()
+}
+
+var serialTypes = map[string]string{"integer": "serial", "bigint": "bigserial", "smallint": "smallserial"}
+
+// columnDef returns def for a new column, turning the sequence default of
+// a serial column back into serial so the sequence is created with it.
+func columnDef(table, column, def string) string {
+	typ, notNull, dflt := splitColumnDef(def)
+	if serial, ok := serialTypes[typ]; ok && dflt == fmt.Sprintf("nextval('%s_%s_seq'::regclass)", table, column) {
+		return serial
+	}
+	if notNull {
+		typ += " NOT NULL"
+	}
+	if dflt != "" {
+		typ += " DEFAULT " + dflt
+	}
+	return typ
+}
+
+// splitColumnDef splits a column definition of snapshotSchema into its
+// type, nullability and default.
+func splitColumnDef(def string) (typ string, notNull bool, dflt string) {
+	def, dflt, _ = strings.Cut(def, " DEFAULT ")
+	typ, notNull = strings.CutSuffix(def, " NOT NULL")
+	return typ, notNull, dflt
+}
+
+// alterColumn returns the statements changing column from the definition
+// from to to.
+func alterColumn(table, column, from, to string) []string {
+	fromType, fromNotNull, fromDefault := splitColumnDef(from)
+	toType, toNotNull, toDefault := splitColumnDef(to)
+	alter := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", sqlIdent(table), sqlIdent(column))
+
+	var stmts []string
+	if fromDefault != toDefault && fromDefault != "" {
+		stmts = append(stmts, alter+"DROP DEFAULT;")
+	}
+	if fromType != toType {
+		stmts = append(stmts, fmt.Sprintf("%sTYPE %s USING %s::%s;", alter, toType, sqlIdent(column), toType))
+	}
+	if fromDefault != toDefault && toDefault != "" {
+		stmts = append(stmts, alter+"SET DEFAULT "+toDefault+";")
+	}
+	switch {
+	case toNotNull && !fromNotNull:
+		stmts = append(stmts, alter+"SET NOT NULL;")
+	case fromNotNull && !toNotNull:
+		stmts = append(stmts, alter+"DROP NOT NULL;")
+	}
+	return stmts
+}
+
+var reSimpleIdent = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// reservedWords are the PostgreSQL keywords that can't be used as table or
+// column names without quoting.
+var reservedWords = wordSet(`all analyse analyze and any array as asc asymmetric authorization
+	binary both case cast check collate collation column concurrently constraint create cross
+	current_catalog current_date current_role current_schema current_time current_timestamp
+	current_user default deferrable desc distinct do else end except false fetch for foreign
+	freeze from full grant group having ilike in initially inner intersect into is isnull join
+	lateral leading left like limit localtime localtimestamp natural not notnull null offset on
+	only or order outer overlaps placing primary references returning right select session_user
+	similar some symmetric system_user table tablesample then to trailing true union unique user
+	using variadic verbose when where window with`)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// sqlIdent quotes name when it isn't usable as a bare identifier.
+func sqlIdent(name string) string {
+	if reSimpleIdent.MatchString(name) && !reservedWords[name] {
+		return name
+	}
+	return quoteIdent(name)
+}
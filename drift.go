@@ -0,0 +1,207 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DriftKind classifies a difference between the live schema and the schema
+// produced by the migrations.
+type DriftKind string
+
+const (
+	DriftMissing    DriftKind = "missing"    // defined by migrations, absent from the database
+	DriftUnexpected DriftKind = "unexpected" // present in the database, not defined by migrations
+	DriftChanged    DriftKind = "changed"    // present in both with different definitions
+)
+
+// DriftItem is a schema object that was changed out-of-band.
+type DriftItem struct {
+	Kind     DriftKind
+	Object   string // e.g. "column users.email"
+	Expected string // definition produced by the migrations
+	Actual   string // definition found in the database
+}
+
+// DriftDetector is implemented by drivers that can compare a live schema
+// against the migrations that were applied to it.
+type DriftDetector interface {
+	Drift(ctx context.Context, schema string, migrations []*Migration) ([]DriftItem, error)
+}
+
+// Drift replays the applied migrations onto a scratch schema and reports
+// the tables, columns, indexes and constraints of schema that differ.
+func (mg *Migrator) Drift(ctx context.Context, schema string) ([]DriftItem, error) {
+	dd, ok := mg.drv.(DriftDetector)
+	if !ok {
+		return nil, errors.New("driver does not support drift detection")
+	}
+
+	migrations, records, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+	for _, m := range migrations {
+		if r, ok := records[m.Version]; ok && r.Status == StatusApplied {
+			if !checksumMatches(r, m) {
+				return nil, checksumError(m)
+			}
+			applied = append(applied, m)
+		}
+	}
+	return dd.Drift(ctx, schema, applied)
+}
+
+// Concurrent index operations can't run inside the replay transaction and
+// produce the same objects without the keyword.
+var reReplayConcurrently = regexp.MustCompile(`(?i)\b(INDEX)\s+CONCURRENTLY\b`)
+
+// Drift replays migrations onto a scratch schema inside a transaction that
+// is always rolled back, so nothing is left behind. The replay runs on
+// Scratch when set and on the live database otherwise. Migrations must not
+// qualify object names with a schema for the replay to be meaningful.
+func (p *Postgres) Drift(ctx context.Context, schema string, migrations []*Migration) ([]DriftItem, error) {
+	// Snapshot the live schema before the replay can touch anything.
+	live, err := p.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	actual, err := snapshotSchema(ctx, live, schema, p.bookkeepingTables())
+	live.Rollback()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect schema %s: %w", schema, err)
+	}
+
+	replay := p.db
+	if p.Scratch != nil {
+		replay = p.Scratch
+	}
+	tx, err := replay.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	scratch := fmt.Sprintf("migo_drift_%d", time.Now().UnixNano())
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE SCHEMA %s; SET LOCAL search_path TO %s`, scratch, scratch)); err != nil {
+		return nil, fmt.Errorf("failed to create scratch schema: %w", err)
+	}
+	for _, m := range migrations {
+		for _, stmt := range splitStatements(m.UpSQL) {
+			query := reReplayConcurrently.ReplaceAllString(stmt.SQL, "$1")
+			if m.BatchSize > 0 {
+				query = strings.ReplaceAll(query, BatchPlaceholder, strconv.Itoa(m.BatchSize))
+			}
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return nil, fmt.Errorf("failed to replay migration %d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+	}
+
+	expected, err := snapshotSchema(ctx, tx, scratch, p.bookkeepingTables())
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect scratch schema: %w", err)
+	}
+	return compareSchemas(expected, actual), nil
+}
+
+// bookkeepingTables returns the names of the tables p keeps its
+// bookkeeping in, which schema snapshots leave out. Flyway's own table is
+// left out too.
+func (p *Postgres) bookkeepingTables() []string {
+	return []string{
+		p.relname("schema_migrations"),
+		p.relname("schema_migrations_history"),
+		p.relname("schema_repeatable_migrations"),
+		p.relname("flyway_schema_history"),
+		"flyway_schema_history",
+	}
+}
+
+// snapshotSchema returns the definitions of the tables, columns, indexes and
+// constraints of schema keyed by object, with schema qualifiers removed so
+// snapshots of different schemas compare equal. The tables named in
+// exclude are left out.
+func snapshotSchema(ctx context.Context, tx *sql.Tx, schema string, exclude []string) (map[string]string, error) {
+	names := make([]string, len(exclude))
+	for i, t := range exclude {
+		names[i] = sqlLiteral(t)
+	}
+	notExcluded := "NOT IN (" + strings.Join(names, ", ") + ")"
+	queries := []string{
+		`SELECT 'table ' || c.relname, ''
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p') AND c.relname ` + notExcluded,
+
+		`SELECT 'column ' || c.relname || '.' || a.attname,
+			format_type(a.atttypid, a.atttypmod)
+			|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+			|| COALESCE(' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p') AND c.relname ` + notExcluded + `
+			AND a.attnum > 0 AND NOT a.attisdropped`,
+
+		`SELECT 'index ' || indexname, indexdef
+		FROM pg_indexes
+		WHERE schemaname = $1 AND tablename ` + notExcluded,
+
+		`SELECT 'constraint ' || c.relname || '.' || k.conname, pg_get_constraintdef(k.oid)
+		FROM pg_constraint k
+		JOIN pg_class c ON c.oid = k.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname ` + notExcluded,
+	}
+
+	objects := make(map[string]string)
+	for _, q := range queries {
+		rows, err := tx.QueryContext(ctx, q, schema)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var key, def string
+			if err := rows.Scan(&key, &def); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			objects[key] = strings.ReplaceAll(def, schema+".", "")
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+func compareSchemas(expected, actual map[string]string) []DriftItem {
+	var items []DriftItem
+	for obj, want := range expected {
+		got, ok := actual[obj]
+		switch {
+		case !ok:
+			items = append(items, DriftItem{Kind: DriftMissing, Object: obj, Expected: want})
+		case got != want:
+			items = append(items, DriftItem{Kind: DriftChanged, Object: obj, Expected: want, Actual: got})
+		}
+	}
+	for obj, got := range actual {
+		if _, ok := expected[obj]; !ok {
+			items = append(items, DriftItem{Kind: DriftUnexpected, Object: obj, Actual: got})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Object < items[j].Object })
+	return items
+}
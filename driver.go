@@ -0,0 +1,62 @@
+package migo
+
+import "context"
+
+// Execer is the set of operations a Migrator performs on a database
+// session or inside a transaction.
+type Execer interface {
+	// Exec runs one or more SQL statements.
+	Exec(ctx context.Context, query string) error
+	// SaveRecord inserts or replaces the bookkeeping row for r.Version.
+	SaveRecord(ctx context.Context, r Record) error
+	// DeleteRecord removes the bookkeeping row for version.
+	DeleteRecord(ctx context.Context, version int64) error
+}
+
+// RowsExecer is implemented by Execers that can report how many rows a
+// statement affected.
+type RowsExecer interface {
+	ExecRows(ctx context.Context, query string) (int64, error)
+}
+
+// Verifier is implemented by Execers that can check the "-- +verify"
+// queries of a migration.
+type Verifier interface {
+	// Verify runs query, which returns a single boolean column, and
+	// reports whether its first row is true. No rows and NULL are false.
+	Verify(ctx context.Context, query string) (bool, error)
+}
+
+// Tx is a database transaction.
+type Tx interface {
+	Execer
+	Commit() error
+	Rollback() error
+}
+
+// Session is a single database connection. A run executes all of its
+// migrations on one session, so session settings made by hooks stay in
+// effect for the whole run.
+type Session interface {
+	Execer
+	Begin(ctx context.Context) (Tx, error)
+	Close() error
+}
+
+// Driver is the database backend a Migrator runs against.
+type Driver interface {
+	// Init creates the bookkeeping table if it doesn't exist yet.
+	Init(ctx context.Context) error
+	// Records returns the bookkeeping rows. A database that was never
+	// initialized has none.
+	Records(ctx context.Context) ([]Record, error)
+	// Session opens a dedicated connection.
+	Session(ctx context.Context) (Session, error)
+}
+
+// Locker is implemented by drivers that can serialize concurrent runs.
+// Migrators hold the lock for the duration of every writing operation.
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
@@ -0,0 +1,80 @@
+package migo
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrChecksumMismatch is matched by errors.Is for a ChecksumError.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrLockHeld is returned when the migration lock could not be acquired
+	// before the context expired because another runner holds it.
+	ErrLockHeld = errors.New("migration lock is held by another runner")
+	// ErrVerifyFailed is wrapped in the MigrationError of a "-- +verify"
+	// query that didn't return true.
+	ErrVerifyFailed = errors.New("verify query did not return true")
+	// ErrIrreversible is matched by errors.Is for an IrreversibleError.
+	ErrIrreversible = errors.New("irreversible migration")
+)
+
+// ChecksumError reports an applied migration whose file changed afterwards.
+type ChecksumError struct {
+	Version int64
+	Name    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch detected for version %d_%s — migration file changed after apply", e.Version, e.Name)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// IrreversibleError is returned by Down, DownTo, Reset and their plans
+// when the rollback includes a migration marked "-- +irreversible". Nothing
+// was rolled back.
+type IrreversibleError struct {
+	Version int64
+	Name    string
+}
+
+func (e *IrreversibleError) Error() string {
+	return fmt.Sprintf("irreversible migration %d_%s can't be rolled back — it is marked '-- +irreversible'", e.Version, e.Name)
+}
+
+func (e *IrreversibleError) Is(target error) bool {
+	return target == ErrIrreversible
+}
+
+// MigrationError reports the statement of a migration that failed.
+type MigrationError struct {
+	Version    int64
+	Name       string
+	Repeatable bool // Version is zero
+	Direction  Direction
+	Path       string
+	Line       int    // line of the failing statement in the file, 0 if unknown
+	Statement  string // the failing statement, empty if unknown
+	Err        error
+}
+
+func (e *MigrationError) Error() string {
+	verb := "apply"
+	if e.Direction == DirectionDown {
+		verb = "rollback"
+	}
+	what := fmt.Sprintf("migration %d_%s", e.Version, e.Name)
+	if e.Repeatable {
+		what = "repeatable migration " + e.Name
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("failed to %s %s at %s:%d: %v", verb, what, e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("failed to %s %s: %v", verb, what, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,39 @@
+package migo
+
+import "time"
+
+// EventKind identifies what an Event reports.
+type EventKind string
+
+const (
+	EventRunStarted        EventKind = "run_started"        // before the first migration of a run
+	EventMigrationStarted  EventKind = "migration_started"  // before a migration executes
+	EventMigrationFinished EventKind = "migration_finished" // after a migration was applied or rolled back
+	EventMigrationFailed   EventKind = "migration_failed"   // after a migration failed; Err is set
+	EventRunFinished       EventKind = "run_finished"       // after the run ended; Err is set on failure
+)
+
+// Event reports the progress of an Up or Down run.
+type Event struct {
+	Kind       EventKind
+	RunID      string // identifies the run, shared by all its events
+	Direction  Direction
+	Version    int64 // zero for run events and repeatable migrations
+	Name       string
+	Repeatable bool
+	Index      int // 1-based position of the migration in the run
+	Total      int // number of migrations in the run
+	Duration   time.Duration
+	Rows       int64       // rows affected by the migration, when the driver reports it
+	Server     *ServerInfo // server of the run, on EventRunFinished when the session reports it
+	Err        error
+	Time       time.Time
+}
+
+func (mg *Migrator) emit(e Event) {
+	if mg.opts.OnEvent == nil {
+		return
+	}
+	e.Time = mg.now()
+	mg.opts.OnEvent(e)
+}
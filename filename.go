@@ -0,0 +1,105 @@
+package migo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultFilenamePattern names migrations <version>_<name>.sql, e.g.
+// 20251108001546_create_users.sql.
+const DefaultFilenamePattern = "{version}_{name}.sql"
+
+// timestampVersion is the layout of the versions Create takes from the
+// clock.
+const timestampVersion = "20060102150405"
+
+// FilenameFormat describes how migration files are named, so migo can
+// follow the convention of an existing repository. The zero value is
+// migo's own: timestamp versions and DefaultFilenamePattern.
+//
+// The package functions, such as LoadMigrations and Create, use the zero
+// value; the methods of the same names use f.
+type FilenameFormat struct {
+	// Pattern places {version} and {name} in the file name, e.g.
+	// "{version}__{name}.sql" or "V{version}-{name}.sql". It must end in
+	// .sql. Defaults to DefaultFilenamePattern.
+	Pattern string
+	// Width, above zero, makes Create number migrations one after the
+	// latest instead of using a timestamp, zero-padded to Width digits,
+	// e.g. 000042 for 6.
+	Width int
+	// LocalTime makes timestamp versions use the local time instead of
+	// UTC.
+	LocalTime bool
+}
+
+func (f FilenameFormat) pattern() string {
+	if f.Pattern == "" {
+		return DefaultFilenamePattern
+	}
+	return f.Pattern
+}
+
+// parser returns a function parsing the version and the name out of
+// the file names of f.
+func (f FilenameFormat) parser() (func(filename string) (int64, string, error), error) {
+	pattern := f.pattern()
+	if strings.Count(pattern, "{version}") != 1 || strings.Count(pattern, "{name}") != 1 {
+		return nil, fmt.Errorf("invalid filename pattern %q: it needs {version} and {name} once each", pattern)
+	}
+	if !strings.HasSuffix(pattern, ".sql") || strings.ContainsAny(pattern, `/\`) {
+		return nil, fmt.Errorf("invalid filename pattern %q: it must be a file name ending in .sql", pattern)
+	}
+	if f.Width < 0 {
+		return nil, fmt.Errorf("invalid filename width %d", f.Width)
+	}
+	versionGroup := 1
+	if strings.Index(pattern, "{name}") < strings.Index(pattern, "{version}") {
+		versionGroup = 2
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{version}"), `(\d+)`, 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{name}"), `([^.]+)`, 1)
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, err
+	}
+	return func(filename string) (int64, string, error) {
+		matches := re.FindStringSubmatch(filename)
+		if len(matches) != 3 {
+			if f.Pattern == "" {
+				return 0, "", fmt.Errorf("invalid filename: %s", filename)
+			}
+			return 0, "", fmt.Errorf("invalid filename: %s doesn't match %s", filename, f.Pattern)
+		}
+		return parseInt64(matches[versionGroup]), matches[3-versionGroup], nil
+	}, nil
+}
+
+// filename names the migration version name.
+func (f FilenameFormat) filename(version, name string) string {
+	return strings.NewReplacer("{version}", version, "{name}", name).Replace(f.pattern())
+}
+
+// nextVersion returns the version of a new migration, given the versions
+// taken by existing files: the time of clock, a second later for every
+// version taken, or one after the latest when f is sequential.
+func (f FilenameFormat) nextVersion(clock Clock, taken map[int64]bool) string {
+	if f.Width > 0 {
+		var latest int64
+		for v := range taken {
+			latest = max(latest, v)
+		}
+		return fmt.Sprintf("%0*d", f.Width, latest+1)
+	}
+	t := clock.Now().UTC()
+	if f.LocalTime {
+		t = t.Local()
+	}
+	for taken[parseInt64(t.Format(timestampVersion))] {
+		t = t.Add(time.Second)
+	}
+	return t.Format(timestampVersion)
+}
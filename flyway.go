@@ -0,0 +1,337 @@
+package migo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// flywayPattern matches Flyway's versioned (V), undo (U) and repeatable (R)
+// file names, e.g. V1__create_users.sql.
+var flywayPattern = regexp.MustCompile(`^([VUR])([^_]*)__(.+)\.sql$`)
+
+// LoadFlywayMigrations parses the Flyway migrations in dir, ordered by
+// version. V<version>__<description>.sql is the up section of its version
+// and the matching U<version>__<description>.sql undo file, if any, the
+// down section. As with Flyway, statements using CONCURRENTLY make the
+// migration run outside a transaction; migo directives apply as well.
+// Checksums are Flyway's CRC32, so rows Flyway recorded validate. Versions
+// must be integers. Repeatable R__ files are left to
+// loadFlywayRepeatables.
+func LoadFlywayMigrations(dir string) ([]*Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	undo := map[int64]string{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		matches := flywayPattern.FindStringSubmatch(e.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid Flyway filename: %s", e.Name())
+		}
+		if matches[1] == "R" {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Flyway filename: %s: only integer versions are supported", e.Name())
+		}
+		content, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if matches[1] == "U" {
+			undo[version] = string(content)
+			continue
+		}
+
+		text := string(content)
+		leading := len(text) - len(strings.TrimLeft(text, " \t\r\n"))
+		m := &Migration{
+			Version:       version,
+			Name:          matches[3],
+			Path:          path,
+			UpSQL:         strings.TrimSpace(text),
+			Transactional: true,
+			Checksum:      flywayChecksum(content),
+			upLine:        1 + strings.Count(text[:leading], "\n"),
+		}
+		if err := m.parseDirectives(text); err != nil {
+			return nil, err
+		}
+		for _, stmt := range splitStatements(text) {
+			if reConcurrently.MatchString(stmt.code) {
+				m.Transactional = false
+			}
+		}
+		migrations = append(migrations, m)
+	}
+
+	for _, m := range migrations {
+		if down, ok := undo[m.Version]; ok {
+			m.DownSQL = strings.TrimSpace(down)
+			m.downLine = 1 + strings.Count(down[:len(down)-len(strings.TrimLeft(down, " \t\r\n"))], "\n")
+			delete(undo, m.Version)
+		}
+	}
+	for v := range undo {
+		return nil, fmt.Errorf("Flyway undo migration for version %d has no versioned migration", v)
+	}
+
+	if err := sortMigrations(migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// loadFlywayRepeatables parses the repeatable R__<description>.sql
+// migrations in dir, ordered by description as Flyway applies them.
+func loadFlywayRepeatables(dir string) ([]*Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var repeatables []*Migration
+	for _, e := range entries {
+		matches := flywayPattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || matches == nil || matches[1] != "R" {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		content, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		m, err := newRepeatable(matches[3], path, string(content), flywayChecksum(content))
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range splitStatements(m.UpSQL) {
+			if reConcurrently.MatchString(stmt.code) {
+				m.Transactional = false
+			}
+		}
+		repeatables = append(repeatables, m)
+	}
+	slices.SortFunc(repeatables, func(a, b *Migration) int { return strings.Compare(a.Name, b.Name) })
+	return repeatables, nil
+}
+
+// flywayChecksum is Flyway's checksum: the CRC32 of the file's lines
+// without their line breaks or a byte order mark, as a signed integer.
+func flywayChecksum(content []byte) string {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	crc := crc32.NewIEEE()
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	scanner.Split(scanFlywayLines)
+	for scanner.Scan() {
+		crc.Write(scanner.Bytes())
+	}
+	return strconv.Itoa(int(int32(crc.Sum32())))
+}
+
+// scanFlywayLines splits lines on \n, \r or \r\n, like Java's readLine.
+func scanFlywayLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF {
+				return 0, nil, nil // a \n may follow
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// baselineView marks the migrations up to the latest StatusBaseline row as
+// skipped in memory. The tool that recorded the baseline considers them
+// done without rows of their own.
+func baselineView(migrations []*Migration, records map[int64]Record) {
+	var baseline *Record
+	for _, r := range records {
+		if r.Status == StatusBaseline && (baseline == nil || r.Version > baseline.Version) {
+			baseline = &r
+		}
+	}
+	if baseline == nil {
+		return
+	}
+	for _, m := range migrations {
+		if m.Version > baseline.Version {
+			break
+		}
+		if r, ok := records[m.Version]; !ok || r.Status == StatusBaseline {
+			records[m.Version] = Record{
+				Version:   m.Version,
+				Name:      m.Name,
+				Checksum:  m.Checksum,
+				Status:    StatusSkipped,
+				AppliedAt: baseline.AppliedAt,
+			}
+		}
+	}
+}
+
+// WithFlywayHistory returns a Driver for the same database that keeps its
+// bookkeeping in Flyway's flyway_schema_history table, so Flyway and migo
+// see the same history. Use it with Options.Flyway.
+func (p *Postgres) WithFlywayHistory() *Postgres {
+	return &Postgres{db: p.db, Scratch: p.Scratch, schema: p.schema, component: p.component, flyway: true}
+}
+
+func (p *Postgres) initFlyway(ctx context.Context, e execer) error {
+	_, err := e.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+p.table()+` (
+			installed_rank INT NOT NULL PRIMARY KEY,
+			version VARCHAR(50),
+			description VARCHAR(200) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			script VARCHAR(1000) NOT NULL,
+			checksum INTEGER,
+			installed_by VARCHAR(100) NOT NULL,
+			installed_on TIMESTAMP NOT NULL DEFAULT now(),
+			execution_time INTEGER NOT NULL,
+			success BOOLEAN NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS flyway_schema_history_s_idx ON `+p.table()+` (success);
+	`)
+	return err
+}
+
+// flywayRecords reads the latest row of every version. A failed row is a
+// dirty migration, as Flyway refuses to continue past it, and a successful
+// undo means the version is no longer applied.
+func (p *Postgres) flywayRecords(ctx context.Context) ([]Record, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT ON (version) version, description, checksum, type, success, installed_on, execution_time
+		FROM `+p.table()+` WHERE version IS NOT NULL AND type <> 'DELETE'
+		ORDER BY version, installed_rank DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var version, description, kind string
+		var checksum sql.NullInt32
+		var success bool
+		var installedOn time.Time
+		var executionTime int64
+		if err := rows.Scan(&version, &description, &checksum, &kind, &success, &installedOn, &executionTime); err != nil {
+			return nil, err
+		}
+		v, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("flyway_schema_history version %q is not an integer", version)
+		}
+		if kind == "UNDO_SQL" && success {
+			continue
+		}
+		r := Record{Version: v, Name: strings.ReplaceAll(description, " ", "_"), Status: StatusApplied, AppliedAt: installedOn, Duration: time.Duration(executionTime) * time.Millisecond}
+		if checksum.Valid {
+			r.Checksum = strconv.Itoa(int(checksum.Int32))
+		}
+		switch {
+		case kind == "BASELINE":
+			r.Status = StatusBaseline
+		case !success:
+			r.Status = StatusDirty
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// saveFlywayRecord replaces the rows of r.Version by one for r. Flyway has
+// no row for migrations that still have to run, so failed and deferred
+// migrations only lose their rows.
+func (p pgExecer) saveFlywayRecord(ctx context.Context, r Record) error {
+	version := strconv.FormatInt(r.Version, 10)
+	if _, err := p.e.ExecContext(ctx, `DELETE FROM `+p.table+` WHERE version = $1`, version); err != nil {
+		return err
+	}
+	if r.Status == StatusFailed || r.Status == StatusDeferred {
+		return nil
+	}
+	var checksum any
+	if c, err := strconv.ParseInt(r.Checksum, 10, 32); err == nil {
+		checksum = c
+	}
+	_, err := p.e.ExecContext(ctx, `INSERT INTO `+p.table+` (installed_rank, version, description, type, script, checksum, installed_by, installed_on, execution_time, success)
+		SELECT COALESCE(MAX(installed_rank), 0) + 1, $1, $2, 'SQL', $3, $4, current_user, $5, $6, $7 FROM `+p.table,
+		version, strings.ReplaceAll(r.Name, "_", " "), fmt.Sprintf("V%s__%s.sql", version, r.Name), checksum, r.AppliedAt, r.Duration.Milliseconds(), r.Status != StatusDirty)
+	return err
+}
+
+// flywayRepeatableRecords reads the latest successful row of every
+// repeatable migration, which Flyway records without a version.
+func (p *Postgres) flywayRepeatableRecords(ctx context.Context) ([]RepeatableRecord, error) {
+	var exists bool
+	if err := p.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, p.table()).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT ON (description) description, checksum, installed_on, execution_time
+		FROM `+p.table()+` WHERE version IS NULL AND type = 'SQL' AND success
+		ORDER BY description, installed_rank DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []RepeatableRecord
+	for rows.Next() {
+		var description string
+		var checksum sql.NullInt32
+		var executionTime int64
+		var r RepeatableRecord
+		if err := rows.Scan(&description, &checksum, &r.AppliedAt, &executionTime); err != nil {
+			return nil, err
+		}
+		r.Name = strings.ReplaceAll(description, " ", "_")
+		if checksum.Valid {
+			r.Checksum = strconv.Itoa(int(checksum.Int32))
+		}
+		r.Duration = time.Duration(executionTime) * time.Millisecond
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// saveFlywayRepeatable appends a row for r, as Flyway does every time it
+// applies a repeatable migration.
+func (p pgExecer) saveFlywayRepeatable(ctx context.Context, r RepeatableRecord) error {
+	var checksum any
+	if c, err := strconv.ParseInt(r.Checksum, 10, 32); err == nil {
+		checksum = c
+	}
+	_, err := p.e.ExecContext(ctx, `INSERT INTO `+p.table+` (installed_rank, version, description, type, script, checksum, installed_by, installed_on, execution_time, success)
+		SELECT COALESCE(MAX(installed_rank), 0) + 1, NULL, $1, 'SQL', $2, $3, current_user, $4, $5, true FROM `+p.table,
+		strings.ReplaceAll(r.Name, "_", " "), fmt.Sprintf("R__%s.sql", r.Name), checksum, r.AppliedAt, r.Duration.Milliseconds())
+	return err
+}
@@ -0,0 +1,89 @@
+package migo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Gap is a hole in the history of a database, usually left by a bad merge:
+// a migration file older than the latest applied migration that never ran,
+// or an applied migration whose file is gone.
+type Gap struct {
+	Version int64
+	Name    string
+	Missing bool // applied, but its file is missing
+}
+
+func (g Gap) String() string {
+	if g.Missing {
+		return fmt.Sprintf("applied migration %d_%s has no file", g.Version, g.Name)
+	}
+	return fmt.Sprintf("migration %d_%s was never applied, but later migrations were", g.Version, g.Name)
+}
+
+// GapError is returned by Up, UpTo and the plans with Options.StrictGaps
+// when the history has gaps.
+type GapError struct {
+	Gaps []Gap
+}
+
+func (e *GapError) Error() string {
+	parts := make([]string, len(e.Gaps))
+	for i, g := range e.Gaps {
+		parts[i] = g.String()
+	}
+	return "version gaps in migration history: " + strings.Join(parts, "; ")
+}
+
+// Gaps returns the gaps between the applied versions and the migration
+// files, ordered by version.
+func (mg *Migrator) Gaps(ctx context.Context) ([]Gap, error) {
+	migrations, records, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return findGaps(migrations, records), nil
+}
+
+// checkGaps returns the gaps in the history, failing with a *GapError
+// under Options.StrictGaps.
+func (mg *Migrator) checkGaps(migrations []*Migration, records map[int64]Record) ([]Gap, error) {
+	gaps := findGaps(migrations, records)
+	if len(gaps) > 0 && mg.opts.StrictGaps {
+		return nil, &GapError{Gaps: gaps}
+	}
+	return gaps, nil
+}
+
+func findGaps(migrations []*Migration, records map[int64]Record) []Gap {
+	var latest int64
+	files := make(map[int64]bool, len(migrations))
+	for _, m := range migrations {
+		files[m.Version] = true
+	}
+
+	var gaps []Gap
+	for _, r := range records {
+		if !r.Done() {
+			continue
+		}
+		latest = max(latest, r.Version)
+		// A baseline recorded by another tool has no file of its own
+		if !files[r.Version] && r.Status != StatusBaseline {
+			gaps = append(gaps, Gap{Version: r.Version, Name: r.Name, Missing: true})
+		}
+	}
+	for _, m := range migrations {
+		if m.Version > latest {
+			break
+		}
+		// Deferred migrations were left out of earlier runs on purpose
+		if r, ok := records[m.Version]; !ok || !r.Done() && r.Status != StatusDeferred {
+			gaps = append(gaps, Gap{Version: m.Version, Name: m.Name})
+		}
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].Version < gaps[j].Version })
+	return gaps
+}
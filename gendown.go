@@ -0,0 +1,158 @@
+package migo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Patterns of the up statements GenerateDown can invert, matched against
+// the statement with comments removed.
+var (
+	reGenCreateTable = regexp.MustCompile(`(?i)^CREATE (?:(?:GLOBAL |LOCAL )?(?:TEMP |TEMPORARY |UNLOGGED ))?TABLE (IF NOT EXISTS )?([^\s(]+)`)
+	reGenCreateIndex = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (CONCURRENTLY )?(IF NOT EXISTS )?([^\s(]+) ON `)
+	reGenCreateOther = regexp.MustCompile(`(?i)^CREATE (SCHEMA|SEQUENCE|TYPE|EXTENSION|VIEW|MATERIALIZED VIEW|DOMAIN) (IF NOT EXISTS )?([^\s(;]+)`)
+	reGenTrigger     = regexp.MustCompile(`(?i)^CREATE (?:CONSTRAINT )?TRIGGER (\S+) .*? ON ([^\s(]+)`)
+	reGenAlterTable  = regexp.MustCompile(`(?i)^ALTER TABLE (IF EXISTS )?(?:ONLY )?([^\s(]+) (.+)$`)
+	reGenRenameTable = regexp.MustCompile(`(?i)^RENAME TO (\S+)$`)
+	reGenRenameCol   = regexp.MustCompile(`(?i)^RENAME (?:COLUMN )?(\S+) TO (\S+)$`)
+	reGenAddCol      = regexp.MustCompile(`(?i)^ADD (?:COLUMN )?(IF NOT EXISTS )?(\S+)`)
+	reGenAddNamed    = regexp.MustCompile(`(?i)^ADD CONSTRAINT (\S+)`)
+	reGenNotNull     = regexp.MustCompile(`(?i)^ALTER (?:COLUMN )?(\S+) (SET|DROP) NOT NULL$`)
+	reGenUnnamed     = regexp.MustCompile(`(?i)^ADD (?:PRIMARY KEY|UNIQUE|FOREIGN KEY|CHECK|EXCLUDE)\b`)
+)
+
+// GenerateDown drafts a down section for the up section of m: the inverse
+// of every statement it understands, newest first. Statements it can't
+// invert, such as data changes or drops, become TODO comments to fill in by
+// hand. The draft is meant for review, not to be trusted blindly.
+func GenerateDown(m *Migration) string {
+	stmts := splitStatements(m.UpSQL)
+	lines := make([]string, 0, len(stmts))
+	for i := len(stmts) - 1; i >= 0; i-- {
+		inverse, ok := invertStatement(stmts[i].code)
+		if !ok {
+			inverse = fmt.Sprintf("-- TODO: revert line %d: %s", m.upLine+stmts[i].Line-1, firstLine(stmts[i].SQL, 60))
+		}
+		lines = append(lines, inverse)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// invertStatement returns the statement undoing code.
+func invertStatement(code string) (string, bool) {
+	if m := reGenCreateTable.FindStringSubmatch(code); m != nil {
+		return "DROP TABLE " + ifExists(m[1]) + m[2] + ";", true
+	}
+	if m := reGenCreateIndex.FindStringSubmatch(code); m != nil {
+		return "DROP INDEX " + strings.ToUpper(m[1]) + ifExists(m[2]) + m[3] + ";", true
+	}
+	if m := reGenCreateOther.FindStringSubmatch(code); m != nil {
+		return "DROP " + strings.ToUpper(m[1]) + " " + ifExists(m[2]) + m[3] + ";", true
+	}
+	if m := reGenTrigger.FindStringSubmatch(code); m != nil {
+		return "DROP TRIGGER " + m[1] + " ON " + m[2] + ";", true
+	}
+	if m := reGenAlterTable.FindStringSubmatch(code); m != nil {
+		return invertAlterTable(m[1], m[2], m[3])
+	}
+	return "", false
+}
+
+// invertAlterTable undoes the comma-separated actions of an ALTER TABLE,
+// in reverse order. It fails if any action can't be undone.
+func invertAlterTable(ifExistsClause, table, actions string) (string, bool) {
+	prefix := "ALTER TABLE " + strings.ToUpper(ifExistsClause) + table + " "
+	if m := reGenRenameTable.FindStringSubmatch(actions); m != nil {
+		return "ALTER TABLE " + strings.ToUpper(ifExistsClause) + m[1] + " RENAME TO " + table + ";", true
+	}
+
+	parts := splitTopLevel(actions)
+	inverses := make([]string, 0, len(parts))
+	for i := len(parts) - 1; i >= 0; i-- {
+		a := parts[i]
+		var inverse string
+		if m := reGenRenameCol.FindStringSubmatch(a); m != nil {
+			inverse = "RENAME COLUMN " + m[2] + " TO " + m[1]
+		} else if m := reGenAddNamed.FindStringSubmatch(a); m != nil {
+			inverse = "DROP CONSTRAINT " + m[1]
+		} else if reGenUnnamed.MatchString(a) {
+			return "", false
+		} else if m := reGenAddCol.FindStringSubmatch(a); m != nil {
+			inverse = "DROP COLUMN " + ifExists(m[1]) + m[2]
+		} else if m := reGenNotNull.FindStringSubmatch(a); m != nil {
+			op := "DROP"
+			if strings.EqualFold(m[2], "DROP") {
+				op = "SET"
+			}
+			inverse = "ALTER COLUMN " + m[1] + " " + op + " NOT NULL"
+		} else {
+			return "", false
+		}
+		inverses = append(inverses, inverse)
+	}
+	return prefix + strings.Join(inverses, ", ") + ";", true
+}
+
+// ifExists returns the IF EXISTS matching an IF NOT EXISTS clause.
+func ifExists(ifNotExists string) string {
+	if ifNotExists == "" {
+		return ""
+	}
+	return "IF EXISTS "
+}
+
+// splitTopLevel splits s on the commas outside parentheses and quotes.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// firstLine returns the first line of s, shortened to at most n runes.
+func firstLine(s string, n int) string {
+	s, _, _ = strings.Cut(s, "\n")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "..."
+	}
+	return s
+}
+
+// WriteDown replaces the down section of m's file with down. It refuses to
+// overwrite a down section that already has statements. Rewriting a
+// migration that was applied changes its checksum.
+func WriteDown(m *Migration, down string) error {
+	if m.Irreversible {
+		return fmt.Errorf("migration %d_%s is marked '-- +irreversible'", m.Version, m.Name)
+	}
+	if len(splitStatements(m.DownSQL)) > 0 {
+		return fmt.Errorf("migration %d_%s already has a down section", m.Version, m.Name)
+	}
+	if strings.HasSuffix(m.Path, gzipSuffix) {
+		return fmt.Errorf("migration %d_%s is compressed; add the down section to the decompressed file", m.Version, m.Name)
+	}
+	content, err := readFile(m.Path)
+	if err != nil {
+		return err
+	}
+	up, _, _ := strings.Cut(string(content), "-- +down")
+	return WriteFileAtomic(m.Path, []byte(up+"-- +down\n"+down+"\n"), 0644)
+}
@@ -0,0 +1,38 @@
+package migo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gzipSuffix marks a gzip-compressed migration file, e.g.
+// 20250101000000_load_postcodes.sql.gz, for reference data too large to
+// keep as plain SQL. Its statements and checksum are those of the
+// decompressed SQL, so compressing a file doesn't change its checksum.
+const gzipSuffix = ".gz"
+
+// isSQLFile reports whether name is a migration file, .sql or .sql.gz.
+func isSQLFile(name string) bool {
+	return strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql"+gzipSuffix)
+}
+
+// decompress returns the SQL of the file name, decompressing content when
+// the file is gzip-compressed.
+func decompress(name string, content []byte) ([]byte, error) {
+	if !strings.HasSuffix(name, gzipSuffix) {
+		return content, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,154 @@
+package migo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// HistoryAction is what was done to a migration.
+type HistoryAction string
+
+const (
+	HistoryApply    HistoryAction = "apply"
+	HistoryRollback HistoryAction = "rollback"
+	HistoryMark     HistoryAction = "mark"   // recorded as applied without running, e.g. by Baseline
+	HistorySquash   HistoryAction = "squash" // rows of the squashed originals replaced
+	HistoryDefer    HistoryAction = "defer"  // left out of a run by Options.Tags
+
+	HistoryIgnoreChecksum HistoryAction = "ignore_checksum" // file changed after apply, run proceeded under Options.IgnoreChecksum
+)
+
+// Outcomes of history entries.
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+)
+
+// HistoryEntry is a row of the audit history. Unlike the bookkeeping rows,
+// entries are never updated or deleted, so rollbacks and failures stay on
+// record.
+type HistoryEntry struct {
+	ID       int64
+	Version  int64
+	Name     string
+	Action   HistoryAction
+	Outcome  string
+	Error    string // why it failed, empty on success
+	User     string // database user that ran it
+	At       time.Time
+	Duration time.Duration // zero for marks and squashes
+	Source   string        // where the migration files came from, see Provenance.Source
+}
+
+// HistoryWriter is implemented by Execers that keep an audit history.
+// Entries appended inside a transaction commit or roll back with it.
+type HistoryWriter interface {
+	AppendHistory(ctx context.Context, h HistoryEntry) error
+}
+
+// HistoryReader is implemented by drivers that keep an audit history.
+type HistoryReader interface {
+	// History returns every entry, oldest first. A database that was never
+	// initialized has none.
+	History(ctx context.Context) ([]HistoryEntry, error)
+}
+
+// History returns the audit history of the database, oldest first.
+func (mg *Migrator) History(ctx context.Context) ([]HistoryEntry, error) {
+	hr, ok := mg.drv.(HistoryReader)
+	if !ok {
+		return nil, errors.New("driver does not keep a migration history")
+	}
+	return hr.History(ctx)
+}
+
+// audit appends the outcome of action on m to the history through e, when
+// e keeps one. began is when the action started, zero for actions that
+// don't run any SQL of the migration.
+func (mg *Migrator) audit(ctx context.Context, e Execer, m *Migration, action HistoryAction, began time.Time, err error) error {
+	w, ok := e.(HistoryWriter)
+	if !ok {
+		return nil
+	}
+	h := HistoryEntry{Version: m.Version, Name: m.Name, Action: action, Outcome: OutcomeSucceeded, At: mg.now(), Source: mg.opts.AppliedBy.Source}
+	if !began.IsZero() {
+		h.Duration = h.At.Sub(began)
+	}
+	if err != nil {
+		h.Outcome, h.Error = OutcomeFailed, err.Error()
+	}
+	return w.AppendHistory(ctx, h)
+}
+
+// auditFailure records a failed action outside of its rolled back
+// transaction. Failing to do so is only logged, so the original error is
+// what the caller sees.
+func (mg *Migrator) auditFailure(ctx context.Context, sess Session, m *Migration, action HistoryAction, began time.Time, err error) {
+	if hErr := mg.audit(ctx, sess, m, action, began, err); hErr != nil {
+		mg.log().Error("failed to record migration history", "version", m.Version, "error", hErr)
+	}
+}
+
+// historyTable returns the audit history table's name, qualified with the
+// schema. Flyway mode keeps it too, as Flyway's table forgets undone
+// versions.
+func (p *Postgres) historyTable() string {
+	return p.qualify("schema_migrations_history")
+}
+
+func (p *Postgres) initHistory(ctx context.Context, e execer) error {
+	_, err := e.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+p.historyTable()+` (
+			id BIGSERIAL PRIMARY KEY,
+			version BIGINT NOT NULL,
+			name TEXT NOT NULL,
+			action TEXT NOT NULL,
+			outcome TEXT NOT NULL,
+			error TEXT,
+			db_user TEXT NOT NULL DEFAULT current_user,
+			occurred_at TIMESTAMP NOT NULL,
+			duration_ms BIGINT
+		);
+		ALTER TABLE `+p.historyTable()+` ADD COLUMN IF NOT EXISTS migration_source TEXT;
+	`)
+	return err
+}
+
+// History reports a missing table as an empty history, like Records.
+func (p *Postgres) History(ctx context.Context) ([]HistoryEntry, error) {
+	var exists bool
+	if err := p.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, p.historyTable()).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, version, name, action, outcome, COALESCE(error, ''), db_user, occurred_at, COALESCE(duration_ms, 0),
+		COALESCE(to_jsonb(h)->>'migration_source', '')
+		FROM `+p.historyTable()+` h ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var h HistoryEntry
+		var durationMS int64
+		if err := rows.Scan(&h.ID, &h.Version, &h.Name, &h.Action, &h.Outcome, &h.Error, &h.User, &h.At, &durationMS, &h.Source); err != nil {
+			return nil, err
+		}
+		h.Duration = time.Duration(durationMS) * time.Millisecond
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+func (p pgExecer) AppendHistory(ctx context.Context, h HistoryEntry) error {
+	_, err := p.e.ExecContext(ctx, `INSERT INTO `+p.history+` (version, name, action, outcome, error, occurred_at, duration_ms, migration_source)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, 0), NULLIF($8, ''))`,
+		h.Version, h.Name, string(h.Action), h.Outcome, h.Error, h.At, h.Duration.Milliseconds(), h.Source)
+	return err
+}
@@ -0,0 +1,58 @@
+package migo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultHooksDir is the directory LoadHooks is usually pointed at.
+const DefaultHooksDir = "./hooks"
+
+// Hooks holds SQL that runs around migrations, e.g. to SET lock_timeout,
+// refresh materialized views or bump a cache version. Empty hooks are
+// skipped.
+type Hooks struct {
+	BeforeAll  string // once before the first migration of a run, and on each parallel worker
+	AfterAll   string // once after the last migration of a run succeeded
+	BeforeEach string // before each migration, inside its transaction
+	AfterEach  string // after each migration, inside its transaction
+}
+
+// LoadHooks reads before_all.sql, after_all.sql, before_each.sql and
+// after_each.sql from dir. Missing files and a missing dir are not errors.
+func LoadHooks(dir string) (Hooks, error) {
+	var h Hooks
+	for name, dst := range map[string]*string{
+		"before_all.sql":  &h.BeforeAll,
+		"after_all.sql":   &h.AfterAll,
+		"before_each.sql": &h.BeforeEach,
+		"after_each.sql":  &h.AfterEach,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Hooks{}, err
+		}
+		*dst = string(data)
+	}
+	return h, nil
+}
+
+func (mg *Migrator) runHook(ctx context.Context, e Execer, name, sql string) error {
+	if isBlankSQL(sql) {
+		return nil
+	}
+	began := mg.now()
+	err := e.Exec(ctx, sql)
+	mg.echo(began, sql, err, "hook", name)
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
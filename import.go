@@ -0,0 +1,209 @@
+package migo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrNothingToImport is returned by the importers when the source
+// directory holds no migrations of the tool, e.g. because they were
+// already converted in place.
+var ErrNothingToImport = errors.New("no migrations to import")
+
+var golangMigratePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// reConcurrently matches statements PostgreSQL refuses to run inside a
+// transaction block, which golang-migrate runs fine as single-statement
+// files.
+var reConcurrently = regexp.MustCompile(`(?i)\bCONCURRENTLY\b`)
+
+// ImportGolangMigrate converts the golang-migrate migrations in from, pairs
+// of NNN_name.up.sql and NNN_name.down.sql, into migo files in dir and
+// returns their paths. Files using CONCURRENTLY are marked
+// "-- +notransaction". When from is dir, the converted originals are
+// removed. Existing migo files are never overwritten.
+func ImportGolangMigrate(from, dir string) ([]string, error) {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return nil, err
+	}
+
+	type pair struct{ version, name, up, down string }
+	pairs := map[string]*pair{}
+	var order []string
+	var originals []string
+	for _, e := range entries {
+		matches := golangMigratePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || matches == nil {
+			continue
+		}
+		data, err := readFile(filepath.Join(from, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		key := matches[1] + "_" + matches[2]
+		p, ok := pairs[key]
+		if !ok {
+			p = &pair{version: matches[1], name: strings.ReplaceAll(matches[2], ".", "_")}
+			pairs[key] = p
+			order = append(order, key)
+		}
+		if matches[3] == "up" {
+			p.up = string(data)
+		} else {
+			p.down = string(data)
+		}
+		originals = append(originals, filepath.Join(from, e.Name()))
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%w: no golang-migrate migrations in %s", ErrNothingToImport, from)
+	}
+	slices.Sort(order)
+
+	var files []importedFile
+	for _, key := range order {
+		p := pairs[key]
+		if p.up == "" {
+			return nil, fmt.Errorf("%s has a down migration but no up migration", key)
+		}
+		header := ""
+		for _, stmt := range splitStatements(p.up + ";\n" + p.down) {
+			if reConcurrently.MatchString(stmt.code) {
+				header = "-- +notransaction\n"
+				break
+			}
+		}
+		files = append(files, importedFile{
+			name:    fmt.Sprintf("%s_%s.sql", p.version, p.name),
+			content: fmt.Sprintf("-- +up\n%s%s\n\n-- +down\n%s\n", header, strings.TrimSpace(p.up), strings.TrimSpace(p.down)),
+		})
+	}
+	return writeImported(from, dir, files, originals)
+}
+
+var goosePattern = regexp.MustCompile(`^(\d+)_(.+)\.(sql|go)$`)
+
+// reGoose matches goose's "-- +goose <annotation>" lines.
+var reGoose = regexp.MustCompile(`(?i)^--\s*\+goose\s+(.+?)\s*$`)
+
+// ImportGoose converts the goose SQL migrations in from into migo files in
+// dir and returns their paths. "-- +goose Up" and "Down" become the
+// sections, "NO TRANSACTION" becomes "-- +notransaction" and the
+// StatementBegin/End markers are dropped, since migo splits dollar-quoted
+// bodies itself. Other annotations are kept as comments. Go migrations
+// can't be converted and are an error. When from is dir, the files are
+// converted in place.
+func ImportGoose(from, dir string) ([]string, error) {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []importedFile
+	var originals []string
+	for _, e := range entries {
+		matches := goosePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || matches == nil {
+			continue
+		}
+		path := filepath.Join(from, e.Name())
+		if matches[3] == "go" {
+			return nil, fmt.Errorf("goose Go migration %s can't be converted; rewrite it in SQL first", path)
+		}
+		data, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var b strings.Builder
+		up, down := false, false
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			m := reGoose.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				b.WriteString(line + "\n")
+				continue
+			}
+			switch strings.ToLower(strings.Join(strings.Fields(m[1]), " ")) {
+			case "up":
+				up = true
+				b.WriteString("-- +up\n")
+			case "down":
+				down = true
+				b.WriteString("\n-- +down\n")
+			case "no transaction":
+				b.WriteString("-- +notransaction\n")
+			case "statementbegin", "statementend":
+			default:
+				b.WriteString(line + "\n")
+			}
+		}
+		if !up {
+			continue // not a goose migration, e.g. already converted
+		}
+		if !down {
+			b.WriteString("\n-- +down\n")
+		}
+		files = append(files, importedFile{
+			name:    fmt.Sprintf("%s_%s.sql", matches[1], strings.ReplaceAll(matches[2], ".", "_")),
+			content: b.String(),
+		})
+		originals = append(originals, path)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no goose migrations in %s", ErrNothingToImport, from)
+	}
+	return writeImported(from, dir, files, originals)
+}
+
+// importedFile is a converted migration to be written into the migrations
+// directory.
+type importedFile struct {
+	name, content string
+}
+
+// writeImported writes files into dir and returns their paths. Every file
+// is checked before any is written, so a conflict leaves dir untouched;
+// only the originals being converted may be replaced. When from is dir,
+// the originals that weren't replaced are removed.
+func writeImported(from, dir string, files []importedFile, originals []string) ([]string, error) {
+	inPlace := filepath.Clean(from) == filepath.Clean(dir)
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if _, err := os.Stat(path); err == nil {
+			if !inPlace || !slices.Contains(originals, path) {
+				return nil, fmt.Errorf("%s already exists", path)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create migrations directory: %w", err)
+	}
+	for i, path := range paths {
+		if err := WriteFileAtomic(path, []byte(files[i].content), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write migration: %w", err)
+		}
+	}
+
+	if inPlace {
+		for _, path := range originals {
+			if slices.Contains(paths, path) {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+	}
+	return paths, nil
+}
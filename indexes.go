@@ -0,0 +1,128 @@
+package migo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// InvalidIndex is an index left in INVALID state, usually by a
+// CREATE INDEX CONCURRENTLY that failed or was interrupted. PostgreSQL keeps
+// maintaining such indexes on writes but never uses them for reads.
+type InvalidIndex struct {
+	Schema string
+	Name   string
+	Table  string
+
+	// Migration is the migration whose concurrent build created the index,
+	// or nil when no migration builds an index of that name.
+	Migration *Migration
+}
+
+// IndexInspector is implemented by drivers that can find invalid indexes.
+type IndexInspector interface {
+	InvalidIndexes(ctx context.Context) ([]InvalidIndex, error)
+}
+
+var reConcurrentIndexName = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX CONCURRENTLY (?:IF NOT EXISTS )?("(?:[^"]|"")+"|[^\s"(]+)`)
+
+// concurrentIndexes returns the names of the indexes the up section of m
+// builds concurrently, folded the way PostgreSQL folds identifiers.
+func concurrentIndexes(m *Migration) []string {
+	var names []string
+	for _, stmt := range splitStatements(m.UpSQL) {
+		match := reConcurrentIndexName.FindStringSubmatch(stmt.code)
+		if match == nil {
+			continue
+		}
+		name := match[1]
+		if unquoted, ok := strings.CutPrefix(name, `"`); ok {
+			name = strings.ReplaceAll(strings.TrimSuffix(unquoted, `"`), `""`, `"`)
+		} else {
+			name = strings.ToLower(name)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// InvalidIndexes returns the invalid indexes of the database, attributed to
+// the migrations that build them. It returns nil when the driver can't
+// inspect indexes.
+func (mg *Migrator) InvalidIndexes(ctx context.Context) ([]InvalidIndex, error) {
+	migrations, _, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return mg.invalidIndexes(ctx, migrations)
+}
+
+func (mg *Migrator) invalidIndexes(ctx context.Context, migrations []*Migration) ([]InvalidIndex, error) {
+	ii, ok := mg.drv.(IndexInspector)
+	if !ok {
+		return nil, nil
+	}
+	indexes, err := ii.InvalidIndexes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect indexes: %w", err)
+	}
+	for i := range indexes {
+		for _, m := range migrations {
+			if slices.Contains(concurrentIndexes(m), indexes[i].Name) {
+				indexes[i].Migration = m
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// dropInvalidIndexes drops the invalid indexes a previous failed run of p
+// left behind, so that retrying its concurrent builds doesn't fail on, or
+// silently skip, the existing index.
+func (mg *Migrator) dropInvalidIndexes(ctx context.Context, e Execer, p PlannedMigration) error {
+	indexes, err := mg.invalidIndexes(ctx, []*Migration{p.migration})
+	if err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		if idx.Migration == nil {
+			continue
+		}
+		mg.log().Warn("Dropping invalid index left by a failed build", "index", idx.Schema+"."+idx.Name, "version", p.Version, "name", p.Name)
+		if err := e.Exec(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+quoteIdent(idx.Schema)+"."+quoteIdent(idx.Name)); err != nil {
+			return fmt.Errorf("failed to drop invalid index %s.%s: %w", idx.Schema, idx.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) InvalidIndexes(ctx context.Context) ([]InvalidIndex, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT n.nspname, c.relname, t.relname
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT i.indisvalid
+		ORDER BY n.nspname, c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []InvalidIndex
+	for rows.Next() {
+		var idx InvalidIndex
+		if err := rows.Scan(&idx.Schema, &idx.Name, &idx.Table); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes, rows.Err()
+}
@@ -0,0 +1,36 @@
+package migo
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Only the braced form is expanded so that positional parameters ($1) and
+// dollar-quoted bodies ($$ ... $$) in SQL are left untouched.
+var interpolationPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate replaces ${VAR} references in the up, verify and down sections of m
+// with environment variables. The checksum keeps describing the raw file,
+// so the same template validates in every environment.
+func interpolate(m *Migration) error {
+	var missing []string
+	expand := func(s string) string {
+		return interpolationPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			name := interpolationPattern.FindStringSubmatch(ref)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+	}
+
+	m.UpSQL = expand(m.UpSQL)
+	m.VerifySQL = expand(m.VerifySQL)
+	m.DownSQL = expand(m.DownSQL)
+	if len(missing) > 0 {
+		return fmt.Errorf("migration %d_%s references undefined variable(s) %v", m.Version, m.Name, missing)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package migo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Severity is how seriously a lint finding is taken.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityOff     Severity = "off"
+)
+
+// LintRule describes a check for a dangerous operation in an up section.
+type LintRule struct {
+	ID          string
+	Description string
+	Severity    Severity // default severity
+
+	// match reports whether stmt violates the rule. created holds the
+	// tables created earlier in the same migration, which are empty and
+	// therefore safe to alter. Rules without match check whole migrations.
+	match func(m *Migration, stmt Statement, created map[string]bool) bool
+}
+
+// LintFinding is a rule violation in a migration.
+type LintFinding struct {
+	Rule      string
+	Severity  Severity
+	Message   string
+	Migration *Migration
+	Line      int // line of the offending statement in the file
+	Statement string
+}
+
+var (
+	reCreateTable = regexp.MustCompile(`^CREATE (?:(?:GLOBAL |LOCAL )?(?:TEMP|TEMPORARY|UNLOGGED) )?TABLE (?:IF NOT EXISTS )?([^\s(]+)`)
+	reAlterTable  = regexp.MustCompile(`^ALTER TABLE (?:IF EXISTS )?(?:ONLY )?([^\s(]+)`)
+	reCreateIndex = regexp.MustCompile(`^CREATE (?:UNIQUE )?INDEX\b`)
+	reConcurrent  = regexp.MustCompile(`^(?:CREATE (?:UNIQUE )?INDEX|DROP INDEX|REINDEX \w+) CONCURRENTLY\b`)
+	reIndexTable  = regexp.MustCompile(` ON (?:ONLY )?([^\s(]+)`)
+	reColumnType  = regexp.MustCompile(`\bALTER (?:COLUMN )?\S+ (?:SET DATA )?TYPE\b`)
+	reAddColumn   = regexp.MustCompile(`\bADD (?:COLUMN )?(?:IF NOT EXISTS )?`)
+)
+
+// alterTarget returns the table altered by stmt and whether it was created
+// earlier in the same migration.
+func alterTarget(stmt Statement, created map[string]bool) (string, bool, bool) {
+	match := reAlterTable.FindStringSubmatch(upper(stmt))
+	if match == nil {
+		return "", false, false
+	}
+	return match[1], true, created[match[1]]
+}
+
+func upper(stmt Statement) string {
+	return strings.ToUpper(stmt.code)
+}
+
+// LintRules is the built-in rule set.
+var LintRules = []LintRule{
+	{
+		ID:          "drop-table",
+		Description: "DROP TABLE destroys data and breaks application versions still using the table",
+		Severity:    SeverityError,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			return strings.HasPrefix(upper(stmt), "DROP TABLE ")
+		},
+	},
+	{
+		ID:          "drop-column",
+		Description: "dropping a column destroys data and breaks application versions still reading it",
+		Severity:    SeverityError,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			_, ok, fresh := alterTarget(stmt, created)
+			return ok && !fresh && strings.Contains(upper(stmt), " DROP COLUMN ")
+		},
+	},
+	{
+		ID:          "alter-column-type",
+		Description: "changing a column type rewrites the table under an ACCESS EXCLUSIVE lock",
+		Severity:    SeverityWarning,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			_, ok, fresh := alterTarget(stmt, created)
+			return ok && !fresh && reColumnType.MatchString(upper(stmt))
+		},
+	},
+	{
+		ID:          "add-not-null-without-default",
+		Description: "adding a NOT NULL column without a DEFAULT fails on tables that already have rows",
+		Severity:    SeverityError,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			_, ok, fresh := alterTarget(stmt, created)
+			if !ok || fresh {
+				return false
+			}
+			s := upper(stmt)
+			for _, clause := range reAddColumn.Split(s, -1)[1:] {
+				if strings.HasPrefix(clause, "CONSTRAINT ") {
+					continue
+				}
+				if strings.Contains(clause, "NOT NULL") && !strings.Contains(clause, "DEFAULT") {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		ID:          "set-not-null",
+		Description: "SET NOT NULL scans the whole table under an ACCESS EXCLUSIVE lock",
+		Severity:    SeverityWarning,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			_, ok, fresh := alterTarget(stmt, created)
+			return ok && !fresh && strings.Contains(upper(stmt), " SET NOT NULL")
+		},
+	},
+	{
+		ID:          "create-index-not-concurrently",
+		Description: "CREATE INDEX without CONCURRENTLY blocks writes to the table while it builds",
+		Severity:    SeverityWarning,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			s := upper(stmt)
+			if !reCreateIndex.MatchString(s) || reConcurrent.MatchString(s) {
+				return false
+			}
+			if t := reIndexTable.FindStringSubmatch(s); t != nil && created[t[1]] {
+				return false
+			}
+			return true
+		},
+	},
+	{
+		ID:          "concurrently-in-transaction",
+		Description: "CONCURRENTLY cannot run inside a transaction; mark the migration -- +notransaction",
+		Severity:    SeverityError,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			return m.Transactional && reConcurrent.MatchString(upper(stmt))
+		},
+	},
+	{
+		ID:          "rename",
+		Description: "renaming tables or columns breaks application versions still using the old name",
+		Severity:    SeverityWarning,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			_, ok, fresh := alterTarget(stmt, created)
+			return ok && !fresh && strings.Contains(upper(stmt), " RENAME ")
+		},
+	},
+	{
+		ID:          "truncate",
+		Description: "TRUNCATE destroys all rows of the table",
+		Severity:    SeverityError,
+		match: func(m *Migration, stmt Statement, created map[string]bool) bool {
+			return strings.HasPrefix(upper(stmt), "TRUNCATE ")
+		},
+	},
+	{
+		ID:          "cross-ownership",
+		Description: "the migration touches tables owned by more than one team",
+		Severity:    SeverityError,
+	},
+}
+
+// Lint checks the up sections of the pending migrations.
+func (mg *Migrator) Lint(ctx context.Context, severities map[string]Severity) ([]LintFinding, error) {
+	plan, err := mg.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]*Migration, 0, len(plan))
+	for _, p := range plan {
+		migrations = append(migrations, p.migration)
+	}
+	return LintWithOwnership(migrations, severities, mg.opts.Ownership)
+}
+
+// Lint checks the up sections of migrations against LintRules. severities
+// overrides the default severity of rules by ID; rules set to SeverityOff
+// and rules listed in a migration's "-- +lint-ignore" directive are
+// skipped.
+func Lint(migrations []*Migration, severities map[string]Severity) ([]LintFinding, error) {
+	return LintWithOwnership(migrations, severities, nil)
+}
+
+// LintWithOwnership is Lint with the cross-ownership rule checked against
+// ownership.
+func LintWithOwnership(migrations []*Migration, severities map[string]Severity, ownership Ownership) ([]LintFinding, error) {
+	for id, sev := range severities {
+		if !slices.ContainsFunc(LintRules, func(r LintRule) bool { return r.ID == id }) {
+			return nil, fmt.Errorf("unknown lint rule %q", id)
+		}
+		if sev != SeverityError && sev != SeverityWarning && sev != SeverityOff {
+			return nil, fmt.Errorf("invalid severity %q for lint rule %q", sev, id)
+		}
+	}
+
+	severity := func(m *Migration, rule LintRule) Severity {
+		sev := rule.Severity
+		if s, ok := severities[rule.ID]; ok {
+			sev = s
+		}
+		if slices.Contains(m.LintIgnore, rule.ID) {
+			return SeverityOff
+		}
+		return sev
+	}
+
+	var findings []LintFinding
+	for _, m := range migrations {
+		created := make(map[string]bool)
+		for _, stmt := range splitStatements(m.UpSQL) {
+			for _, rule := range LintRules {
+				sev := severity(m, rule)
+				if sev == SeverityOff || rule.match == nil {
+					continue
+				}
+				if rule.match(m, stmt, created) {
+					findings = append(findings, LintFinding{
+						Rule:      rule.ID,
+						Severity:  sev,
+						Message:   rule.Description,
+						Migration: m,
+						Line:      m.upLine + stmt.Line - 1,
+						Statement: stmt.SQL,
+					})
+				}
+			}
+			if t := reCreateTable.FindStringSubmatch(upper(stmt)); t != nil {
+				created[t[1]] = true
+			}
+		}
+		if f, ok := crossOwnership(m, ownership); ok {
+			if f.Severity = severity(m, lintRule(f.Rule)); f.Severity != SeverityOff {
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings, nil
+}
+
+func lintRule(id string) LintRule {
+	return LintRules[slices.IndexFunc(LintRules, func(r LintRule) bool { return r.ID == id })]
+}
+
+// crossOwnership reports the first statement of m touching a table owned by
+// a different team than the tables before it.
+func crossOwnership(m *Migration, ownership Ownership) (LintFinding, bool) {
+	first := ""
+	for _, stmt := range splitStatements(m.UpSQL) {
+		for _, t := range statementTables(stmt) {
+			team := ownership.Owner(t)
+			switch {
+			case team == "":
+			case first == "":
+				first = team
+			case team != first:
+				return LintFinding{
+					Rule:      "cross-ownership",
+					Message:   fmt.Sprintf("the migration touches tables owned by more than one team (%s and %s, via %s)", first, team, t),
+					Migration: m,
+					Line:      m.upLine + stmt.Line - 1,
+					Statement: stmt.SQL,
+				}, true
+			}
+		}
+	}
+	return LintFinding{}, false
+}
@@ -0,0 +1,87 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// LockHolder describes the runner holding the migration lock.
+type LockHolder struct {
+	PID       int    // process ID of the runner, or of its backend when unknown
+	Hostname  string // host of the runner, or its client address when unknown
+	StartedAt time.Time
+}
+
+// LockInspector is implemented by drivers that can report who holds the
+// migration lock.
+type LockInspector interface {
+	LockHolder(ctx context.Context) (*LockHolder, error)
+}
+
+// LockHeldError is returned when the migration lock could not be acquired
+// in time. errors.Is matches it against ErrLockHeld.
+type LockHeldError struct {
+	Holder *LockHolder // nil when unknown
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Holder == nil {
+		return ErrLockHeld.Error()
+	}
+	return fmt.Sprintf("%s (pid %d on %s since %s)", ErrLockHeld, e.Holder.PID, e.Holder.Hostname, e.Holder.StartedAt.Format(time.RFC3339))
+}
+
+func (e *LockHeldError) Is(target error) bool {
+	return target == ErrLockHeld
+}
+
+// lockApplicationName identifies the lock connection of this process in
+// pg_stat_activity, so runners waiting for the lock can tell who holds it.
+func lockApplicationName() string {
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("migo pid=%d host=%s", os.Getpid(), host)
+	if len(name) > 63 { // NAMEDATALEN - 1
+		name = name[:63]
+	}
+	return name
+}
+
+var reLockApplicationName = regexp.MustCompile(`^migo pid=(\d+) host=(.*)$`)
+
+// LockHolder looks up the backend holding migo's advisory lock. Bigint
+// advisory keys are split into classid (high half) and objid (low half).
+func (p *Postgres) LockHolder(ctx context.Context) (*LockHolder, error) {
+	var (
+		pid     int
+		app     string
+		addr    sql.NullString
+		started time.Time
+	)
+	err := p.db.QueryRowContext(ctx, `
+		SELECT a.pid, a.application_name, host(a.client_addr), a.state_change
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+			AND l.classid = ($1::bigint >> 32)::oid AND l.objid = ($1::bigint & 4294967295)::oid
+		LIMIT 1`, advisoryLockID).Scan(&pid, &app, &addr, &started)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := &LockHolder{PID: pid, Hostname: addr.String, StartedAt: started}
+	if h.Hostname == "" {
+		h.Hostname = "localhost"
+	}
+	if m := reLockApplicationName.FindStringSubmatch(app); m != nil {
+		h.PID, _ = strconv.Atoi(m[1])
+		h.Hostname = m[2]
+	}
+	return h, nil
+}
@@ -0,0 +1,131 @@
+package migo
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// migrationLocks is the lock footprint of a planned migration: the tables
+// its up section locks, in statement order, with existing tables only.
+type migrationLocks struct {
+	locks []tableLock
+	lines []int // line of the statement taking each lock
+}
+
+// planLocks returns the lock footprint of every step of plan. Tables
+// created earlier in the plan are left out: nothing else uses them yet.
+func planLocks(plan []PlannedMigration) []migrationLocks {
+	created := map[string]bool{}
+	footprints := make([]migrationLocks, len(plan))
+	for i, p := range plan {
+		for _, stmt := range splitStatements(p.SQL) {
+			for _, l := range statementLocks(stmt) {
+				l.table = qualifiedTable(l.table)
+				if l.created {
+					created[l.table] = true
+				}
+				if created[l.table] {
+					continue
+				}
+				footprints[i].locks = append(footprints[i].locks, l)
+				footprints[i].lines = append(footprints[i].lines, stmt.Line)
+			}
+		}
+	}
+	return footprints
+}
+
+// qualifiedTable qualifies an unqualified table name with public so both
+// spellings compare equal.
+func qualifiedTable(table string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+	return "public." + table
+}
+
+// lockHazards analyzes the locks the steps of plan take together and
+// returns warnings for each step:
+//
+//   - a table taking ACCESS EXCLUSIVE in several migrations is blocked once
+//     per migration, so they are better merged;
+//   - a transaction locking a table and later asking for a stronger lock on
+//     it can deadlock with sessions queued in between;
+//   - transactions locking the same tables in different orders can deadlock
+//     each other's waiters, so they are better reordered.
+func lockHazards(plan []PlannedMigration) [][]string {
+	footprints := planLocks(plan)
+	warnings := make([][]string, len(plan))
+
+	exclusive := map[string][]int{} // table → steps taking ACCESS EXCLUSIVE
+	var tables []string
+	for i, f := range footprints {
+		for _, l := range f.locks {
+			if l.mode == lockAccessExclusive && !slices.Contains(exclusive[l.table], i) {
+				if exclusive[l.table] == nil {
+					tables = append(tables, l.table)
+				}
+				exclusive[l.table] = append(exclusive[l.table], i)
+			}
+		}
+	}
+	for _, t := range tables {
+		steps := exclusive[t]
+		if len(steps) < 2 {
+			continue
+		}
+		for _, i := range steps {
+			var others []string
+			for _, j := range steps {
+				if j != i {
+					others = append(others, strconv.FormatInt(plan[j].Version, 10))
+				}
+			}
+			warnings[i] = append(warnings[i], fmt.Sprintf("ACCESS EXCLUSIVE lock on %s is also taken by %s in this plan; merge these migrations so the table is locked once", t, strings.Join(others, ", ")))
+		}
+	}
+
+	orders := make([][]string, len(plan)) // strongly locked tables of each transaction
+	for i, f := range footprints {
+		if !plan[i].Transactional {
+			continue // every statement commits and releases its locks
+		}
+		held := map[string]lockMode{}
+		for n, l := range f.locks {
+			prev, ok := held[l.table]
+			if ok && l.mode > prev && l.mode >= lockShare {
+				warnings[i] = append(warnings[i], fmt.Sprintf("line %d escalates the lock on %s from %s to %s; take the strongest lock first, e.g. LOCK TABLE %s IN %s MODE", f.lines[n], l.table, prev, l.mode, l.table, l.mode))
+			}
+			if !ok || l.mode > prev {
+				held[l.table] = l.mode
+			}
+			if l.mode >= lockShare && !slices.Contains(orders[i], l.table) {
+				orders[i] = append(orders[i], l.table)
+			}
+		}
+	}
+	for j := range orders {
+		for i := range j {
+			if a, b, ok := lockInversion(orders[i], orders[j]); ok {
+				warnings[j] = append(warnings[j], fmt.Sprintf("locks %s before %s while %d locks them the other way round; reorder the statements so both take locks in the same order", b, a, plan[i].Version))
+			}
+		}
+	}
+	return warnings
+}
+
+// lockInversion returns two tables first locked as a before b and second
+// locked as b before a.
+func lockInversion(first, second []string) (string, string, bool) {
+	for x, a := range first {
+		for _, b := range first[x+1:] {
+			ia, ib := slices.Index(second, a), slices.Index(second, b)
+			if ia >= 0 && ib >= 0 && ib < ia {
+				return a, b, true
+			}
+		}
+	}
+	return "", "", false
+}
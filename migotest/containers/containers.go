@@ -0,0 +1,80 @@
+// Package containers starts disposable PostgreSQL databases for
+// integration tests with testcontainers, migrated with migotest.Up. It
+// needs a Docker-compatible container runtime.
+package containers
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/bagastri07/migo/migotest"
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// DefaultImage is the PostgreSQL image Postgres runs unless WithImage
+// says otherwise.
+const DefaultImage = "postgres:16-alpine"
+
+// Option configures Postgres.
+type Option func(*config)
+
+type config struct {
+	image string
+	up    []migotest.UpOption
+	req   []testcontainers.ContainerCustomizer
+}
+
+// WithImage runs image instead of DefaultImage, e.g. to match the server
+// version of production.
+func WithImage(image string) Option {
+	return func(c *config) { c.image = image }
+}
+
+// WithUpOptions passes opts to the migotest.Up applying the migrations.
+func WithUpOptions(opts ...migotest.UpOption) Option {
+	return func(c *config) { c.up = append(c.up, opts...) }
+}
+
+// WithCustomizers customizes the container request, e.g. with
+// postgres.WithInitScripts for roles or extensions the migrations expect.
+func WithCustomizers(opts ...testcontainers.ContainerCustomizer) Option {
+	return func(c *config) { c.req = append(c.req, opts...) }
+}
+
+// Postgres starts a PostgreSQL container, applies the migrations in dir
+// and returns the database, failing t if either doesn't work. The
+// container is terminated and the database closed when the test ends.
+// Every call starts its own container; share one per package by calling it
+// from a single parent test with subtests.
+func Postgres(t testing.TB, dir string, opts ...Option) *sql.DB {
+	t.Helper()
+	c := config{image: DefaultImage}
+	for _, o := range opts {
+		o(&c)
+	}
+
+	req := append([]testcontainers.ContainerCustomizer{
+		postgres.WithDatabase("migotest"),
+		postgres.BasicWaitStrategies(),
+	}, c.req...)
+	ctr, err := postgres.Run(t.Context(), c.image, req...)
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatalf("migotest: starting %s: %v", c.image, err)
+	}
+
+	dsn, err := ctr.ConnectionString(t.Context(), "sslmode=disable")
+	if err != nil {
+		t.Fatalf("migotest: connecting to %s: %v", c.image, err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("migotest: connecting to %s: %v", c.image, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migotest.Up(t, db, dir, c.up...)
+	return db
+}
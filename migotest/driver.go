@@ -0,0 +1,285 @@
+// Package migotest provides helpers for testing code that embeds migo: an
+// in-memory driver for unit tests without a database, and Up to migrate a
+// real test database.
+package migotest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bagastri07/migo"
+)
+
+// Driver is an in-memory migo.Driver and migo.Locker. It records every
+// statement it is asked to execute instead of running it, keeps the
+// bookkeeping rows in memory and honors transaction boundaries, so
+// applications can unit test their migration logic.
+type Driver struct {
+	mu          sync.Mutex
+	initialized bool
+	records     map[int64]migo.Record
+	repeatables map[string]migo.RepeatableRecord
+	history     []migo.HistoryEntry
+	executed    []string
+	failures    []failure
+	refuted     []string
+	rows        []affected
+	lock        chan struct{}
+}
+
+type failure struct {
+	substr string
+	err    error
+}
+
+type affected struct {
+	substr string
+	counts []int64
+}
+
+// NewDriver returns an empty Driver, as if pointed at a fresh database.
+func NewDriver() *Driver {
+	return &Driver{
+		records:     make(map[int64]migo.Record),
+		repeatables: make(map[string]migo.RepeatableRecord),
+		lock:        make(chan struct{}, 1),
+	}
+}
+
+// Seed pre-populates the bookkeeping table, e.g. to simulate a database
+// that already applied some migrations.
+func (d *Driver) Seed(records ...migo.Record) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.initialized = true
+	for _, r := range records {
+		d.records[r.Version] = r
+	}
+}
+
+// FailOn makes every Exec whose query contains substr fail with err.
+func (d *Driver) FailOn(substr string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = append(d.failures, failure{substr, err})
+}
+
+// AffectRows makes the statements containing substr report counts as
+// their affected rows, one count per execution and zero once they are used
+// up, e.g. to drive a "-- +batch" migration.
+func (d *Driver) AffectRows(substr string, counts ...int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rows = append(d.rows, affected{substr, counts})
+}
+
+// Refute makes every verify query containing substr report false, so the
+// migration fails as if its assertion didn't hold.
+func (d *Driver) Refute(substr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refuted = append(d.refuted, substr)
+}
+
+// Executed returns the committed statements in execution order.
+func (d *Driver) Executed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.executed...)
+}
+
+// History returns the committed audit history, oldest first.
+func (d *Driver) History(ctx context.Context) ([]migo.HistoryEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]migo.HistoryEntry(nil), d.history...), nil
+}
+
+// Initialized reports whether Init was called.
+func (d *Driver) Initialized() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.initialized
+}
+
+func (d *Driver) Init(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.initialized = true
+	return nil
+}
+
+func (d *Driver) Records(ctx context.Context) ([]migo.Record, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	records := make([]migo.Record, 0, len(d.records))
+	for _, r := range d.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
+}
+
+// RepeatableRecords returns the bookkeeping rows of the repeatable
+// migrations, ordered by name.
+func (d *Driver) RepeatableRecords(ctx context.Context) ([]migo.RepeatableRecord, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	records := make([]migo.RepeatableRecord, 0, len(d.repeatables))
+	for _, r := range d.repeatables {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records, nil
+}
+
+func (d *Driver) Session(ctx context.Context) (migo.Session, error) {
+	return &session{execer{d: d}}, nil
+}
+
+// Lock blocks until no other run holds the lock or ctx is done.
+func (d *Driver) Lock(ctx context.Context) error {
+	select {
+	case d.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Driver) Unlock(ctx context.Context) error {
+	select {
+	case <-d.lock:
+		return nil
+	default:
+		return errors.New("migotest: unlock of unlocked driver")
+	}
+}
+
+// change is a pending effect of a statement, applied when it commits.
+type change func(d *Driver)
+
+func (d *Driver) check(query string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, f := range d.failures {
+		if strings.Contains(query, f.substr) {
+			return f.err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) commit(changes []change) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range changes {
+		c(d)
+	}
+}
+
+// execer applies changes immediately, or buffers them inside a transaction.
+type execer struct {
+	d       *Driver
+	buffer  bool
+	pending []change
+}
+
+func (e *execer) do(c change) {
+	if e.buffer {
+		e.pending = append(e.pending, c)
+		return
+	}
+	e.d.commit([]change{c})
+}
+
+func (e *execer) Exec(ctx context.Context, query string) error {
+	if err := e.d.check(query); err != nil {
+		return err
+	}
+	e.do(func(d *Driver) { d.executed = append(d.executed, query) })
+	return nil
+}
+
+// Verify holds unless the query was refuted with Refute. It fails like
+// Exec for queries matched by FailOn.
+func (e *execer) Verify(ctx context.Context, query string) (bool, error) {
+	if err := e.d.check(query); err != nil {
+		return false, err
+	}
+	e.d.mu.Lock()
+	defer e.d.mu.Unlock()
+	for _, substr := range e.d.refuted {
+		if strings.Contains(query, substr) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ExecRows is Exec reporting the rows set with AffectRows.
+func (e *execer) ExecRows(ctx context.Context, query string) (int64, error) {
+	if err := e.Exec(ctx, query); err != nil {
+		return 0, err
+	}
+	e.d.mu.Lock()
+	defer e.d.mu.Unlock()
+	for i, a := range e.d.rows {
+		if strings.Contains(query, a.substr) && len(a.counts) > 0 {
+			e.d.rows[i].counts = a.counts[1:]
+			return a.counts[0], nil
+		}
+	}
+	return 0, nil
+}
+
+func (e *execer) SaveRecord(ctx context.Context, r migo.Record) error {
+	e.do(func(d *Driver) { d.records[r.Version] = r })
+	return nil
+}
+
+func (e *execer) SaveRepeatable(ctx context.Context, r migo.RepeatableRecord) error {
+	e.do(func(d *Driver) { d.repeatables[r.Name] = r })
+	return nil
+}
+
+func (e *execer) AppendHistory(ctx context.Context, h migo.HistoryEntry) error {
+	e.do(func(d *Driver) {
+		h.ID = int64(len(d.history) + 1)
+		d.history = append(d.history, h)
+	})
+	return nil
+}
+
+func (e *execer) DeleteRecord(ctx context.Context, version int64) error {
+	e.do(func(d *Driver) { delete(d.records, version) })
+	return nil
+}
+
+type session struct {
+	execer
+}
+
+func (s *session) Begin(ctx context.Context) (migo.Tx, error) {
+	return &tx{execer{d: s.d, buffer: true}}, nil
+}
+
+func (s *session) Close() error { return nil }
+
+type tx struct {
+	execer
+}
+
+func (t *tx) Commit() error {
+	t.d.commit(t.pending)
+	t.pending = nil
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.pending = nil
+	return nil
+}
@@ -0,0 +1,33 @@
+package migotest
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/bagastri07/migo"
+)
+
+// MigrateUp applies the pending migrations at the root of fsys to db, e.g.
+// an embed.FS narrowed with fs.Sub, failing t if they don't apply. Unlike
+// Up, calls are not shared between tests.
+func MigrateUp(t testing.TB, db *sql.DB, fsys fs.FS, opts ...UpOption) {
+	t.Helper()
+	c := newUpConfig(t, opts)
+	c.opts.FS, c.opts.Dir = fsys, "."
+	up(t, db, c, "migrations")
+}
+
+// MigrateDownAll rolls back every applied migration at the root of fsys,
+// newest first, failing t if one doesn't roll back.
+// RollbackOnCleanup has no effect.
+func MigrateDownAll(t testing.TB, db *sql.DB, fsys fs.FS, opts ...UpOption) {
+	t.Helper()
+	c := newUpConfig(t, opts)
+	c.opts.FS, c.opts.Dir = fsys, "."
+	err := migo.New(migo.NewPostgres(db), c.opts).Reset(t.Context())
+	if err != nil && !errors.Is(err, migo.ErrNoRollback) {
+		t.Fatalf("migotest: rolling back migrations: %s", describe(err))
+	}
+}
@@ -0,0 +1,135 @@
+package migotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bagastri07/migo"
+)
+
+// UpOption configures Up.
+type UpOption func(*upConfig)
+
+type upConfig struct {
+	opts     migo.Options
+	rollback bool
+	level    slog.Level
+}
+
+// WithOptions sets the Options of the Migrator Up runs. Dir, FS and Logger
+// are always replaced by Up's.
+func WithOptions(opts migo.Options) UpOption {
+	return func(c *upConfig) { c.opts = opts }
+}
+
+// RollbackOnCleanup rolls back the migrations Up applied when the test
+// ends, leaving the database as it found it. Such calls are not shared
+// with other tests, so don't combine it with t.Parallel on the same
+// database.
+func RollbackOnCleanup() UpOption {
+	return func(c *upConfig) { c.rollback = true }
+}
+
+// Verbose logs every executed statement to the test log.
+func Verbose() UpOption {
+	return func(c *upConfig) { c.level = slog.LevelDebug }
+}
+
+// upKey identifies a shared Up of a directory on a database.
+type upKey struct {
+	db  *sql.DB
+	dir string
+}
+
+type upResult struct {
+	once sync.Once
+	err  error
+}
+
+// shared holds the Ups made without RollbackOnCleanup, so parallel tests of
+// a package migrate their database once.
+var shared sync.Map // upKey → *upResult
+
+// newUpConfig applies opts, logging to the test log of t.
+func newUpConfig(t testing.TB, opts []UpOption) upConfig {
+	c := upConfig{level: slog.LevelInfo}
+	for _, o := range opts {
+		o(&c)
+	}
+	c.opts.Logger = slog.New(slog.NewTextHandler(t.Output(), &slog.HandlerOptions{Level: c.level}))
+	return c
+}
+
+// Up applies the pending migrations in dir to db, a real test database,
+// failing t if they don't apply. Progress is logged to the test log.
+//
+// Tests of a package calling Up on the same db and dir share the first
+// call; its result is reported to all of them. Test packages run as
+// separate processes are serialized by the migration lock, and all but the
+// first find nothing pending.
+func Up(t testing.TB, db *sql.DB, dir string, opts ...UpOption) {
+	t.Helper()
+	c := newUpConfig(t, opts)
+	c.opts.Dir = dir
+	c.opts.FS = nil
+
+	if !c.rollback {
+		v, _ := shared.LoadOrStore(upKey{db, dir}, &upResult{})
+		r := v.(*upResult)
+		r.once.Do(func() { r.err = migo.New(migo.NewPostgres(db), c.opts).Up(t.Context()) })
+		if r.err != nil {
+			t.Fatalf("migotest: applying %s: %s", dir, describe(r.err))
+		}
+		return
+	}
+	up(t, db, c, dir)
+}
+
+// up applies the pending migrations of c.opts, rolling them back when the
+// test ends if c.rollback is set. what names the migrations in failures.
+func up(t testing.TB, db *sql.DB, c upConfig, what string) {
+	t.Helper()
+	applied := 0
+	onEvent := c.opts.OnEvent
+	c.opts.OnEvent = func(e migo.Event) {
+		// Repeatable migrations aren't undone by Down, so only versioned
+		// ones count.
+		if e.Kind == migo.EventMigrationFinished && !e.Repeatable && e.Direction == migo.DirectionUp {
+			applied++
+		}
+		if onEvent != nil {
+			onEvent(e)
+		}
+	}
+	m := migo.New(migo.NewPostgres(db), c.opts)
+	if c.rollback {
+		t.Cleanup(func() {
+			ctx := context.Background()
+			for range applied {
+				if err := m.Down(ctx); err != nil && !errors.Is(err, migo.ErrNoRollback) {
+					t.Errorf("migotest: rolling back %s: %s", what, describe(err))
+					return
+				}
+			}
+		})
+	}
+	if err := m.Up(t.Context()); err != nil {
+		t.Fatalf("migotest: applying %s: %s", what, describe(err))
+	}
+}
+
+// describe formats err for a test failure, adding the statement that
+// failed, which the error itself only locates.
+func describe(err error) string {
+	var me *migo.MigrationError
+	if errors.As(err, &me) && me.Statement != "" {
+		return fmt.Sprintf("%v\nfailing statement:\n%s", err, strings.TrimSpace(me.Statement))
+	}
+	return err.Error()
+}
@@ -0,0 +1,296 @@
+package migo
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Migration struct {
+	Version       int64
+	Name          string
+	Path          string
+	UpSQL         string
+	VerifySQL     string // "-- +verify" queries checked after UpSQL, see Verifier
+	DownSQL       string
+	Checksum      string
+	Squashes      []int64  // versions consolidated into this migration by squash
+	Transactional bool     // false when the file is marked "-- +notransaction"
+	LintIgnore    []string // lint rules disabled by "-- +lint-ignore"
+	Parallel      bool     // "-- +parallel": may run alongside its parallel neighbours, see Options.Parallel
+	DependsOn     []int64  // versions from "-- +depends_on" that must be applied first
+	Tags          []string // from "-- +tags", see Options.Tags
+	Repeatable    bool     // applied again whenever it changes, see LoadRepeatableMigrations; Version is zero
+	Irreversible  bool     // "-- +irreversible": has no down section and can't be rolled back
+	// StatementTimeout and LockTimeout, from "-- +statement_timeout 5min"
+	// and "-- +lock_timeout 10s", are in effect while the migration runs.
+	StatementTimeout string
+	LockTimeout      string
+	// BatchSize and BatchSleep, from "-- +batch size=10000 sleep=100ms",
+	// make every up statement run again until it affects no rows, see
+	// BatchPlaceholder.
+	BatchSize  int
+	BatchSleep time.Duration
+
+	upLine     int    // line of the file on which UpSQL starts
+	verifyLine int    // line of the file on which VerifySQL starts
+	downLine   int    // line of the file on which DownSQL starts
+	validation string // checksum under Options.Checksum, see validationChecksum
+	// folded maps each version of a "-- +squashes" line to the last
+	// version of that line, the row a squash reconciled it into.
+	folded map[int64]int64
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseMigrationFile parses the migration at path, whose file name parse
+// returns the version and name of.
+func parseMigrationFile(path string, content []byte, parse func(filename string) (int64, string, error)) (*Migration, error) {
+	filename := strings.TrimSuffix(filepath.Base(path), gzipSuffix)
+	version, name, err := parse(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	before, downPart, hasDown := strings.Cut(string(content), "-- +down")
+	upPart := strings.ReplaceAll(before, "-- +up", "")
+
+	leading := len(upPart) - len(strings.TrimLeft(upPart, " \t\r\n"))
+	downLeading := len(downPart) - len(strings.TrimLeft(downPart, " \t\r\n"))
+	m := &Migration{
+		Version:       version,
+		Name:          name,
+		Path:          path,
+		DownSQL:       strings.TrimSpace(downPart),
+		Transactional: true,
+		upLine:        1 + strings.Count(upPart[:leading], "\n"),
+		downLine:      1 + strings.Count(before, "\n") + strings.Count(downPart[:downLeading], "\n"),
+	}
+	upPart = m.cutVerify(upPart)
+	m.UpSQL = strings.TrimSpace(upPart)
+
+	if err := m.parseDirectives(upPart); err != nil {
+		return nil, err
+	}
+	switch {
+	case !hasDown && !m.Irreversible:
+		return nil, fmt.Errorf("missing '-- +down' section in %s; mark a migration that can't be rolled back with '-- +irreversible'", filename)
+	case m.Irreversible && !isBlankSQL(m.DownSQL):
+		return nil, fmt.Errorf("%s is marked '-- +irreversible' but has a down section", filename)
+	}
+
+	hash := sha256.Sum256(content)
+	m.Checksum = hex.EncodeToString(hash[:])
+	return m, nil
+}
+
+// cutVerify moves the "-- +verify" section at the end of the up section
+// up to m.VerifySQL and returns the rest.
+func (m *Migration) cutVerify(up string) string {
+	up, verify, ok := strings.Cut(up, "-- +verify")
+	if !ok {
+		return up
+	}
+	leading := len(verify) - len(strings.TrimLeft(verify, " \t\r\n"))
+	m.VerifySQL = strings.TrimSpace(verify)
+	m.verifyLine = 1 + strings.Count(up, "\n") + strings.Count(verify[:leading], "\n")
+	return up
+}
+
+// parseDirectives applies the "-- +" directives found in the up section.
+func (m *Migration) parseDirectives(up string) error {
+	for _, line := range strings.Split(up, "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "-- +squashes"); ok {
+			fields := strings.Fields(rest)
+			for _, f := range fields {
+				m.Squashes = append(m.Squashes, parseInt64(f))
+				if m.folded == nil {
+					m.folded = map[int64]int64{}
+				}
+				m.folded[parseInt64(f)] = parseInt64(fields[len(fields)-1])
+			}
+		}
+		if line == "-- +notransaction" {
+			m.Transactional = false
+		}
+		if line == "-- +parallel" {
+			m.Parallel = true
+		}
+		if line == "-- +irreversible" {
+			m.Irreversible = true
+		}
+		if rest, ok := strings.CutPrefix(line, "-- +tags"); ok {
+			m.Tags = append(m.Tags, strings.FieldsFunc(rest, func(r rune) bool {
+				return r == ',' || r == ' '
+			})...)
+		}
+		if rest, ok := strings.CutPrefix(line, "-- +depends_on"); ok {
+			for _, f := range strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == ' ' }) {
+				m.DependsOn = append(m.DependsOn, parseInt64(f))
+			}
+		}
+		if rest, ok := strings.CutPrefix(line, "-- +statement_timeout "); ok {
+			m.StatementTimeout = strings.TrimSpace(rest)
+		}
+		if rest, ok := strings.CutPrefix(line, "-- +lock_timeout "); ok {
+			m.LockTimeout = strings.TrimSpace(rest)
+		}
+		if rest, ok := strings.CutPrefix(line, "-- +lint-ignore"); ok {
+			m.LintIgnore = append(m.LintIgnore, strings.FieldsFunc(rest, func(r rune) bool {
+				return r == ',' || r == ' '
+			})...)
+		}
+		if rest, ok := strings.CutPrefix(line, "-- +batch"); ok && (rest == "" || rest[0] == ' ') {
+			if err := m.parseBatch(rest); err != nil {
+				return fmt.Errorf("invalid '-- +batch' directive in %s: %w", filepath.Base(m.Path), err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseInt64(s string) int64 {
+	var v int64
+	fmt.Sscanf(s, "%d", &v)
+	return v
+}
+
+// LoadMigrations parses every .sql and .sql.gz file in dir and its
+// subdirectories, ordered by version. The repeatable directory and directories whose name
+// starts with a dot are left out.
+func LoadMigrations(dir string) ([]*Migration, error) {
+	return FilenameFormat{}.LoadMigrations(dir)
+}
+
+// LoadMigrationsFS is LoadMigrations for the directory dir of fsys, e.g.
+// migrations embedded with go:embed.
+func LoadMigrationsFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	return FilenameFormat{}.LoadMigrationsFS(fsys, dir)
+}
+
+// LoadMigrations is the package's LoadMigrations for files named f.
+func (f FilenameFormat) LoadMigrations(dir string) ([]*Migration, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err // named after dir, unlike the errors of os.DirFS
+	}
+	return f.parseMigrations(os.DirFS(dir), ".", func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) })
+}
+
+// LoadMigrationsFS is the package's LoadMigrationsFS for files named f.
+func (f FilenameFormat) LoadMigrationsFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	return f.parseMigrations(fsys, path.Clean(dir), func(p string) string { return p })
+}
+
+// parseMigrations parses the migration files under root in fsys, named
+// by name in the Migration.Path of each.
+func (f FilenameFormat) parseMigrations(fsys fs.FS, root string, name func(p string) string) ([]*Migration, error) {
+	parse, err := f.parser()
+	if err != nil {
+		return nil, err
+	}
+	files, err := migrationFiles(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	var migrations []*Migration
+	for _, p := range files {
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = decompress(name(p), content); err != nil {
+			return nil, err
+		}
+		m, err := parseMigrationFile(name(p), content, parse)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+
+	if err := sortMigrations(migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// migrationFiles returns the .sql and .sql.gz files under root in fsys, in
+// subdirectories too, except the repeatable directory and directories
+// whose name starts with a dot, e.g. .git.
+func migrationFiles(fsys fs.FS, root string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && (strings.HasPrefix(d.Name(), ".") || p == path.Join(root, RepeatableDir)) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if isSQLFile(d.Name()) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// MergeMigrations merges the migrations loaded from several directories
+// into one list ordered by version. A version found in two of them is an
+// error naming both files.
+func MergeMigrations(sources ...[]*Migration) ([]*Migration, error) {
+	var migrations []*Migration
+	for _, s := range sources {
+		migrations = append(migrations, s...)
+	}
+	if err := sortMigrations(migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// compareMigrations orders migrations by version, then name, so plans are
+// identical on every machine regardless of how files were discovered.
+func compareMigrations(a, b *Migration) int {
+	if c := cmp.Compare(a.Version, b.Version); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+// sortMigrations sorts migrations deterministically and rejects versions
+// that appear more than once, since bookkeeping is keyed by version.
+func sortMigrations(migrations []*Migration) error {
+	slices.SortStableFunc(migrations, compareMigrations)
+	for i := 1; i < len(migrations); i++ {
+		prev, m := migrations[i-1], migrations[i]
+		if prev.Version == m.Version {
+			return fmt.Errorf("duplicate migration version %d: %s and %s", m.Version, prev.Path, m.Path)
+		}
+	}
+	return nil
+}
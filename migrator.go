@@ -0,0 +1,871 @@
+// Package migo applies file-based SQL migrations to PostgreSQL, tracking
+// them in a schema_migrations table with checksum validation.
+package migo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+)
+
+// DefaultDir is the migrations directory used when Options.Dir is empty.
+const DefaultDir = "./migrations"
+
+// Options configures a Migrator.
+type Options struct {
+	// Dir is the directory containing migration files. Defaults to DefaultDir.
+	Dir string
+	// Dirs, when set, replaces Dir with several directories whose
+	// migrations are merged into one plan ordered by version, e.g. a
+	// shared library's schema vendored next to the service's. A version
+	// or repeatable migration found in two of them is an error.
+	Dirs []string
+	// FS, when set, is the file system Dir is read from, e.g. an embed.FS;
+	// Dir then defaults to its root.
+	FS fs.FS
+	// Logger receives progress messages; each executed statement is logged
+	// at debug level. Defaults to slog.Default().
+	Logger *slog.Logger
+	// Hooks run around the migrations of every Up and Down.
+	Hooks Hooks
+	// Interpolate expands ${VAR} references in migration files with
+	// environment variables. Checksums are computed on the raw files.
+	Interpolate bool
+	// Template renders migration files as Go templates with Vars as data,
+	// before interpolation. Checksums are computed on the raw files.
+	Template bool
+	Vars     map[string]string
+	// OnEvent, when set, is called synchronously with progress events
+	// during Up and Down, e.g. to render live progress. It must not block.
+	OnEvent func(Event)
+	// Clock provides applied_at values, durations and event times.
+	// Defaults to SystemClock.
+	Clock Clock
+	// IDs provides the run IDs of events. Defaults to RandomIDs.
+	IDs IDGenerator
+	// LockTimeout bounds the wait for the migration lock; zero waits
+	// forever. On timeout a *LockHeldError describes the holder.
+	LockTimeout time.Duration
+	// Ownership maps teams to their tables. With Team set, Up, UpTo and
+	// the plans only include migrations touching that team's tables.
+	Ownership Ownership
+	Team      string
+	// Checksum selects the checksum applied migrations are validated
+	// against. Defaults to ChecksumFile.
+	Checksum ChecksumMode
+	// Flyway reads Flyway file names (V1__create_users.sql) with
+	// LoadFlywayMigrations instead of migo's. Pair it with
+	// Postgres.WithFlywayHistory to share Flyway's history table.
+	Flyway bool
+	// Filename is how migration files are named. The zero value reads and
+	// creates migo's <version>_<name>.sql files.
+	Filename FilenameFormat
+	// Limit caps the number of migrations Up, UpTo and the plans apply,
+	// taking the oldest pending ones first; zero applies all of them.
+	Limit int
+	// Atomic makes Up and UpTo apply the whole plan and its bookkeeping
+	// in a single transaction, so a failure rolls back every migration of
+	// the run. Plans with non-transactional migrations are refused.
+	Atomic bool
+	// AppliedBy is recorded with every bookkeeping row written. Defaults to
+	// DetectProvenance.
+	AppliedBy Provenance
+	// StrictGaps makes Up, UpTo and the plans fail with a *GapError when
+	// the history has gaps (see Gaps) instead of applying old migrations
+	// out of order.
+	StrictGaps bool
+	// IgnoreChecksum lets Up, UpTo and the plans proceed past applied
+	// migrations whose file changed instead of failing with a
+	// *ChecksumError. Up and UpTo log a warning listing them and record
+	// the override in the audit history; their rows keep the old
+	// checksum, so the mismatch is reported again until it is repaired.
+	IgnoreChecksum bool
+	// Retry retries migrations that fail with a transient error, such as a
+	// deadlock. The zero value doesn't retry.
+	Retry RetryPolicy
+	// Tags leaves the migrations it doesn't select out of Up, UpTo and
+	// the plans. Up and UpTo record them as deferred; they stay pending.
+	Tags TagFilter
+	// Preflight is checked before Up, UpTo, Down and their variants
+	// execute anything, see Migrator.Preflight.
+	Preflight Preflight
+	// EchoSQL logs every statement of the migrations and hooks once it
+	// ran, with its duration.
+	EchoSQL bool
+	// ProgressInterval is how often a migration still running is logged,
+	// with the wait event of its connection where the driver can tell.
+	// Defaults to DefaultProgressInterval; negative disables the logs.
+	ProgressInterval time.Duration
+	// Parallel, above 1, is how many consecutive migrations marked
+	// "-- +parallel" Up and UpTo apply at once, each on its own session
+	// that Hooks.BeforeAll runs on first. The other migrations still run
+	// one at a time, in order, and atomic runs ignore it.
+	Parallel int
+}
+
+// Migrator applies and rolls back the migrations of a directory against a
+// database.
+type Migrator struct {
+	drv  Driver
+	opts Options
+
+	noRepeatables bool // plans leave repeatable migrations out, for UpByOne
+}
+
+// New returns a Migrator running against drv, usually NewPostgres(db).
+func New(drv Driver, opts Options) *Migrator {
+	if opts.Dir == "" && opts.FS != nil {
+		opts.Dir = "."
+	} else if opts.Dir == "" {
+		opts.Dir = DefaultDir
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	if opts.IDs == nil {
+		opts.IDs = RandomIDs
+	}
+	if opts.AppliedBy == (Provenance{}) {
+		opts.AppliedBy = DetectProvenance()
+	}
+	return &Migrator{drv: drv, opts: opts}
+}
+
+func (mg *Migrator) log() *slog.Logger {
+	return mg.opts.Logger
+}
+
+func (mg *Migrator) now() time.Time {
+	return mg.opts.Clock.Now()
+}
+
+// lock takes the driver's lock when it has one and returns its release.
+func (mg *Migrator) lock(ctx context.Context) (func(), error) {
+	l, ok := mg.drv.(Locker)
+	if !ok {
+		return func() {}, nil
+	}
+	lockCtx, cancel := ctx, context.CancelFunc(func() {})
+	if mg.opts.LockTimeout > 0 {
+		lockCtx, cancel = context.WithTimeout(ctx, mg.opts.LockTimeout)
+	}
+	defer cancel()
+	if err := l.Lock(lockCtx); err != nil {
+		if errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+			return nil, mg.lockHeldError(ctx)
+		}
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	return func() {
+		if err := l.Unlock(context.WithoutCancel(ctx)); err != nil {
+			mg.log().Warn("failed to release migration lock", "error", err)
+		}
+	}, nil
+}
+
+// lockHeldError describes the runner holding the lock when the driver can
+// tell.
+func (mg *Migrator) lockHeldError(ctx context.Context) error {
+	li, ok := mg.drv.(LockInspector)
+	if !ok {
+		return &LockHeldError{}
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	holder, err := li.LockHolder(ctx)
+	if err != nil {
+		mg.log().Warn("failed to look up the migration lock holder", "error", err)
+	}
+	return &LockHeldError{Holder: holder}
+}
+
+// dirs returns the migration directories, Options.Dirs or else Options.Dir.
+func (mg *Migrator) dirs() []string {
+	if len(mg.opts.Dirs) > 0 {
+		return mg.opts.Dirs
+	}
+	return []string{mg.opts.Dir}
+}
+
+// loadDir reads the migration files of dir.
+func (mg *Migrator) loadDir(dir string) ([]*Migration, error) {
+	switch {
+	case mg.opts.FS != nil && mg.opts.Flyway:
+		return nil, errors.New("Flyway migrations can't be read from Options.FS")
+	case mg.opts.Flyway && mg.opts.Filename != FilenameFormat{}:
+		return nil, errors.New("Flyway migrations have their own file names, Options.Filename can't be used with them")
+	case mg.opts.FS != nil:
+		return mg.opts.Filename.LoadMigrationsFS(mg.opts.FS, dir)
+	case mg.opts.Flyway:
+		return LoadFlywayMigrations(dir)
+	default:
+		return mg.opts.Filename.LoadMigrations(dir)
+	}
+}
+
+// load reads the migration files and the bookkeeping rows. Writers pass
+// write to create the table and reconcile squashes first; readers get the
+// same view computed in memory.
+func (mg *Migrator) load(ctx context.Context, write bool) ([]*Migration, map[int64]Record, error) {
+	sources := make([][]*Migration, len(mg.dirs()))
+	for i, dir := range mg.dirs() {
+		var err error
+		if sources[i], err = mg.loadDir(dir); err != nil {
+			return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+		}
+	}
+	migrations, err := MergeMigrations(sources...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if mg.opts.Flyway && mg.opts.Checksum != ChecksumFile {
+		return nil, nil, errors.New("checksum modes can't be used with Flyway migrations, Flyway's history has no room for them")
+	}
+	for _, m := range migrations {
+		if err := mg.prepare(m); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if write {
+		if err := mg.drv.Init(ctx); err != nil {
+			return nil, nil, fmt.Errorf("failed to ensure migration table: %w", err)
+		}
+	}
+
+	rows, err := mg.drv.Records(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read migration history: %w", err)
+	}
+	records := make(map[int64]Record, len(rows))
+	for _, r := range rows {
+		records[r.Version] = r
+	}
+	baselineView(migrations, records)
+
+	if write {
+		if err := mg.reconcileSquashed(ctx, migrations, records); err != nil {
+			return nil, nil, fmt.Errorf("failed to reconcile squashed migrations: %w", err)
+		}
+		if err := mg.recordValidationChecksums(ctx, migrations, records); err != nil {
+			return nil, nil, fmt.Errorf("failed to record validation checksums: %w", err)
+		}
+	} else {
+		pending, err := unreconciledSquashes(migrations, records)
+		if err != nil {
+			return nil, nil, err
+		}
+		squashedView(records, pending)
+	}
+	return migrations, records, nil
+}
+
+// prepare computes the validation checksum of m and renders its SQL.
+func (mg *Migrator) prepare(m *Migration) (err error) {
+	if m.validation, err = validationChecksum(mg.opts.Checksum, m); err != nil {
+		return err
+	}
+	if mg.opts.Template {
+		if err := renderTemplate(m, mg.opts.Vars); err != nil {
+			return err
+		}
+	}
+	if mg.opts.Interpolate {
+		return interpolate(m)
+	}
+	return nil
+}
+
+// Up applies all pending migrations, then the repeatable migrations that
+// are new or changed.
+func (mg *Migrator) Up(ctx context.Context) error {
+	return mg.UpTo(ctx, math.MaxInt64)
+}
+
+// UpTo applies pending migrations up to and including version.
+func (mg *Migrator) UpTo(ctx context.Context, version int64) error {
+	_, err := mg.upTo(ctx, version)
+	return err
+}
+
+// UpByOne applies the oldest pending migration, and only that one, and
+// returns its version. It returns ErrNoPending when nothing is pending.
+// Repeatable migrations are left to Up.
+func (mg *Migrator) UpByOne(ctx context.Context) (int64, error) {
+	one := *mg
+	one.opts.Limit = 1
+	one.noRepeatables = true
+	plan, err := one.upTo(ctx, math.MaxInt64)
+	if err != nil {
+		return 0, err
+	}
+	if len(plan) == 0 {
+		return 0, ErrNoPending
+	}
+	return plan[0].Version, nil
+}
+
+// upTo applies pending migrations up to and including version and returns
+// the ones it applied.
+func (mg *Migrator) upTo(ctx context.Context, version int64) ([]PlannedMigration, error) {
+	unlock, err := mg.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := mg.preflight(ctx); err != nil {
+		return nil, err
+	}
+
+	migrations, records, err := mg.load(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planUp(migrations, records, version, mg.opts.IgnoreChecksum)
+	if err != nil {
+		return nil, err
+	}
+	gaps, err := mg.checkGaps(migrations, records)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gaps {
+		mg.log().Warn("Version gap in migration history", "version", g.Version, "name", g.Name, "missing_file", g.Missing)
+	}
+	plan, deferred := mg.filterTags(mg.scope(plan))
+	repeatables, err := mg.planRepeatables(ctx, migrations, records, version)
+	if err != nil {
+		return nil, err
+	}
+	plan, remaining := mg.limit(append(plan, repeatables...))
+	if err := checkDependencies(migrations, records, plan); err != nil {
+		return nil, err
+	}
+
+	if err := mg.recordDeferred(ctx, deferred, records); err != nil {
+		return nil, err
+	}
+	if err := mg.recordIgnoredChecksums(ctx, migrations, records); err != nil {
+		return nil, err
+	}
+	if err := mg.run(ctx, DirectionUp, plan); err != nil {
+		return nil, err
+	}
+
+	mg.log().Info("Migrations applied successfully", "count", len(plan))
+	if remaining > 0 {
+		mg.log().Info("Limit reached, migrations still pending", "limit", mg.opts.Limit, "pending", remaining)
+	}
+	return plan, nil
+}
+
+// run executes plan on a single session, so session settings made by
+// hooks stay in effect for every migration of the run. Parallel groups run
+// on sessions of their own, each set up by the before_all hook as well.
+func (mg *Migrator) run(ctx context.Context, dir Direction, plan []PlannedMigration) (err error) {
+	start := mg.now()
+	runID := mg.opts.IDs.NewID()
+	var server *ServerInfo
+	mg.emit(Event{Kind: EventRunStarted, RunID: runID, Direction: dir, Total: len(plan)})
+	defer func() {
+		mg.emit(Event{Kind: EventRunFinished, RunID: runID, Direction: dir, Total: len(plan), Duration: mg.now().Sub(start), Server: server, Err: err})
+	}()
+
+	if len(plan) == 0 {
+		return nil
+	}
+
+	atomic := mg.opts.Atomic && dir == DirectionUp
+	if atomic {
+		for _, p := range plan {
+			if !p.Transactional {
+				return fmt.Errorf("migration %d_%s runs outside a transaction and can't be part of an atomic run", p.Version, p.Name)
+			}
+		}
+	}
+
+	sess, err := mg.drv.Session(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	if err := mg.runHook(ctx, sess, "before_all", mg.opts.Hooks.BeforeAll); err != nil {
+		return err
+	}
+	server = mg.serverInfo(ctx, sess)
+	var tx Tx
+	if atomic {
+		if tx, err = sess.Begin(ctx); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+	for i := 0; i < len(plan); {
+		n := 1
+		if !atomic {
+			n = mg.parallelBatch(plan[i:])
+		}
+		if n > 1 {
+			err = mg.runParallel(ctx, runID, plan, i, n)
+		} else {
+			err = mg.step(ctx, sess, tx, Event{RunID: runID, Index: i + 1, Total: len(plan)}, plan[i], mg.emit)
+		}
+		if err != nil {
+			if atomic && i > 0 {
+				mg.log().Warn("Atomic run rolled back", "rolled_back", i)
+			}
+			return err
+		}
+		i += n
+	}
+	if atomic {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit atomic run: %w", err)
+		}
+	}
+	return mg.runHook(ctx, sess, "after_all", mg.opts.Hooks.AfterAll)
+}
+
+// step applies or rolls back p on sess, or inside tx in an atomic run, and
+// reports it through emit. e locates p within the run.
+func (mg *Migrator) step(ctx context.Context, sess Session, tx Tx, e Event, p PlannedMigration, emit func(Event)) error {
+	e.Direction, e.Version, e.Name, e.Repeatable = p.Direction, p.Version, p.Name, p.Repeatable
+	e.Kind = EventMigrationStarted
+	emit(e)
+
+	began := mg.now()
+	stop := mg.progress(ctx, sess, p, began)
+	var rows int64
+	var err error
+	switch {
+	case p.Repeatable && tx != nil:
+		rows, err = mg.applyRepeatable(ctx, sess, tx, p)
+	case p.Repeatable:
+		rows, err = mg.withRetry(ctx, p, func() (int64, error) { return mg.applyRepeatable(ctx, sess, nil, p) })
+	case p.Direction == DirectionDown:
+		rows, err = mg.withRetry(ctx, p, func() (int64, error) { return mg.rollback(ctx, sess, p) })
+	case tx != nil:
+		rows, err = mg.applyAtomic(ctx, sess, tx, p)
+	default:
+		rows, err = mg.withRetry(ctx, p, func() (int64, error) { return mg.apply(ctx, sess, p) })
+	}
+	stop()
+
+	e.Kind, e.Duration, e.Rows, e.Err = EventMigrationFinished, mg.now().Sub(began), rows, err
+	if err != nil {
+		e.Kind = EventMigrationFailed
+	}
+	emit(e)
+	return err
+}
+
+// apply runs the up section of p and returns the number of rows it
+// affected.
+func (mg *Migrator) apply(ctx context.Context, sess Session, p PlannedMigration) (int64, error) {
+	mg.log().Info("Applying migration", "version", p.Version, "name", p.Name)
+	began := mg.now()
+
+	if !p.Transactional {
+		if err := mg.dropInvalidIndexes(ctx, sess, p); err != nil {
+			return 0, err
+		}
+		rows, err := mg.execMigration(ctx, sess, p)
+		if err != nil {
+			if recErr := sess.SaveRecord(ctx, mg.newRecord(p.migration, StatusDirty)); recErr != nil {
+				mg.log().Error("failed to record migration failure", "version", p.Version, "error", recErr)
+			}
+			mg.auditFailure(ctx, sess, p.migration, HistoryApply, began, err)
+			return rows, err
+		}
+		if err := sess.SaveRecord(ctx, mg.appliedRecord(p, began)); err != nil {
+			return rows, fmt.Errorf("failed to record migration %d: %w", p.Version, err)
+		}
+		if err := mg.audit(ctx, sess, p.migration, HistoryApply, began, nil); err != nil {
+			return rows, fmt.Errorf("failed to record history of migration %d: %w", p.Version, err)
+		}
+		return rows, nil
+	}
+
+	tx, err := sess.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := mg.execMigration(ctx, tx, p)
+	if err != nil {
+		tx.Rollback()
+		if recErr := sess.SaveRecord(ctx, mg.newRecord(p.migration, StatusFailed)); recErr != nil {
+			mg.log().Error("failed to record migration failure", "version", p.Version, "error", recErr)
+		}
+		mg.auditFailure(ctx, sess, p.migration, HistoryApply, began, err)
+		return 0, err
+	}
+	if err := tx.SaveRecord(ctx, mg.appliedRecord(p, began)); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to record migration %d: %w", p.Version, err)
+	}
+	if err := mg.audit(ctx, tx, p.migration, HistoryApply, began, nil); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to record history of migration %d: %w", p.Version, err)
+	}
+	return rows, tx.Commit()
+}
+
+// applyAtomic runs the up section of p and records it inside tx, the
+// transaction of the whole run. On failure tx is rolled back, undoing the
+// migrations applied before p too, and p is recorded as failed.
+func (mg *Migrator) applyAtomic(ctx context.Context, sess Session, tx Tx, p PlannedMigration) (int64, error) {
+	mg.log().Info("Applying migration", "version", p.Version, "name", p.Name)
+	began := mg.now()
+
+	rows, err := mg.execMigration(ctx, tx, p)
+	if err == nil {
+		if err = tx.SaveRecord(ctx, mg.appliedRecord(p, began)); err != nil {
+			err = fmt.Errorf("failed to record migration %d: %w", p.Version, err)
+		}
+	}
+	if err == nil {
+		if err = mg.audit(ctx, tx, p.migration, HistoryApply, began, nil); err != nil {
+			err = fmt.Errorf("failed to record history of migration %d: %w", p.Version, err)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		if recErr := sess.SaveRecord(ctx, mg.newRecord(p.migration, StatusFailed)); recErr != nil {
+			mg.log().Error("failed to record migration failure", "version", p.Version, "error", recErr)
+		}
+		mg.auditFailure(ctx, sess, p.migration, HistoryApply, began, err)
+		return 0, err
+	}
+	return rows, nil
+}
+
+// rollback mirrors apply: the down section and the removal of the
+// bookkeeping row commit together, and a failure outside a transaction
+// leaves the migration dirty.
+func (mg *Migrator) rollback(ctx context.Context, sess Session, p PlannedMigration) (int64, error) {
+	mg.log().Info("Rolling back migration", "version", p.Version, "name", p.Name)
+	began := mg.now()
+
+	if !p.Transactional {
+		rows, err := mg.execMigration(ctx, sess, p)
+		if err != nil {
+			if recErr := sess.SaveRecord(ctx, mg.newRecord(p.migration, StatusDirty)); recErr != nil {
+				mg.log().Error("failed to record migration failure", "version", p.Version, "error", recErr)
+			}
+			mg.auditFailure(ctx, sess, p.migration, HistoryRollback, began, err)
+			return rows, err
+		}
+		if err := sess.DeleteRecord(ctx, p.Version); err != nil {
+			return rows, fmt.Errorf("failed to remove record of migration %d: %w", p.Version, err)
+		}
+		if err := mg.audit(ctx, sess, p.migration, HistoryRollback, began, nil); err != nil {
+			return rows, fmt.Errorf("failed to record history of migration %d: %w", p.Version, err)
+		}
+		return rows, nil
+	}
+
+	tx, err := sess.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := mg.execMigration(ctx, tx, p)
+	if err != nil {
+		tx.Rollback()
+		mg.auditFailure(ctx, sess, p.migration, HistoryRollback, began, err)
+		return 0, err
+	}
+	if err := tx.DeleteRecord(ctx, p.Version); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to remove record of migration %d: %w", p.Version, err)
+	}
+	if err := mg.audit(ctx, tx, p.migration, HistoryRollback, began, nil); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to record history of migration %d: %w", p.Version, err)
+	}
+	return rows, tx.Commit()
+}
+
+// execMigration runs the SQL of p wrapped in the per-migration hooks and
+// returns the rows affected by its statements, if e can report them.
+func (mg *Migrator) execMigration(ctx context.Context, e Execer, p PlannedMigration) (int64, error) {
+	if err := mg.runHook(ctx, e, "before_each", mg.opts.Hooks.BeforeEach); err != nil {
+		return 0, err
+	}
+	start := p.migration.upLine
+	if p.Direction == DirectionDown {
+		start = p.migration.downLine
+	}
+
+	verifier, ok := e.(Verifier)
+	if p.Verify != "" && !ok {
+		return 0, errors.New("driver can't run verify queries")
+	}
+	batcher, ok := e.(RowsExecer)
+	batched := p.Direction == DirectionUp && p.migration.BatchSize > 0
+	if batched && !ok {
+		return 0, errors.New("driver can't report affected rows, which '-- +batch' needs")
+	}
+
+	restore, err := setTimeouts(ctx, e, p)
+	if err != nil {
+		return 0, err
+	}
+
+	// Statements run one at a time so a failure can be pinned to its line,
+	// and so statements such as CREATE INDEX CONCURRENTLY aren't wrapped in
+	// the implicit transaction of a multi-statement query.
+	var total int64
+	for _, stmt := range splitStatements(p.SQL) {
+		line := start + stmt.Line - 1
+		mg.log().Debug("Executing statement", "version", p.Version, "line", line, "sql", stmt.SQL)
+		began := mg.now()
+		var rows int64
+		if batched {
+			rows, err = mg.execBatches(ctx, batcher, p, stmt.SQL, line)
+		} else {
+			rows, err = execRows(ctx, e, stmt.SQL)
+		}
+		mg.echo(began, stmt.SQL, err, "version", p.Version, "line", line, "rows", rows)
+		if err != nil {
+			if !p.Transactional {
+				restore() // a failed transaction is rolled back anyway
+			}
+			return total, &MigrationError{
+				Version:    p.Version,
+				Name:       p.Name,
+				Repeatable: p.Repeatable,
+				Direction:  p.Direction,
+				Path:       p.migration.Path,
+				Line:       line,
+				Statement:  stmt.SQL,
+				Err:        err,
+			}
+		}
+		total += rows
+	}
+	// Verify queries run right after the up SQL, so a transactional
+	// migration whose assertions don't hold is rolled back with them.
+	for _, stmt := range splitStatements(p.Verify) {
+		line := p.migration.verifyLine + stmt.Line - 1
+		mg.log().Debug("Verifying migration", "version", p.Version, "line", line, "sql", stmt.SQL)
+		began := mg.now()
+		holds, err := verifier.Verify(ctx, stmt.SQL)
+		if err == nil && !holds {
+			err = ErrVerifyFailed
+		}
+		mg.echo(began, stmt.SQL, err, "version", p.Version, "line", line, "verify", true)
+		if err != nil {
+			if !p.Transactional {
+				restore()
+			}
+			return total, &MigrationError{
+				Version:    p.Version,
+				Name:       p.Name,
+				Repeatable: p.Repeatable,
+				Direction:  p.Direction,
+				Path:       p.migration.Path,
+				Line:       line,
+				Statement:  stmt.SQL,
+				Err:        err,
+			}
+		}
+	}
+	if err := restore(); err != nil {
+		return total, err
+	}
+	return total, mg.runHook(ctx, e, "after_each", mg.opts.Hooks.AfterEach)
+}
+
+// echo logs query, executed since began, when Options.EchoSQL is set.
+func (mg *Migrator) echo(began time.Time, query string, err error, args ...any) {
+	if !mg.opts.EchoSQL {
+		return
+	}
+	args = append(args, "duration", mg.now().Sub(began), "sql", query)
+	if err != nil {
+		mg.log().Warn("Statement failed", append(args, "error", err)...)
+		return
+	}
+	mg.log().Info("Executed statement", args...)
+}
+
+func execRows(ctx context.Context, e Execer, query string) (int64, error) {
+	if re, ok := e.(RowsExecer); ok {
+		return re.ExecRows(ctx, query)
+	}
+	return 0, e.Exec(ctx, query)
+}
+
+// Down rolls back the most recently applied migration. It returns
+// ErrNoRollback when nothing has been applied.
+func (mg *Migrator) Down(ctx context.Context) error {
+	return mg.DownSteps(ctx, 1)
+}
+
+// DownSteps rolls back the n most recently applied migrations, newest
+// first, in a single run. It returns ErrNoRollback when nothing has been
+// applied and rolls back nothing when fewer than n are applied.
+func (mg *Migrator) DownSteps(ctx context.Context, n int) error {
+	return mg.down(ctx, func(migrations []*Migration, records map[int64]Record) ([]PlannedMigration, error) {
+		return planDown(migrations, records, n)
+	})
+}
+
+// DownTo rolls back every applied migration newer than version, newest
+// first, in a single run. It returns ErrNoRollback when there is none.
+func (mg *Migrator) DownTo(ctx context.Context, version int64) error {
+	return mg.down(ctx, func(migrations []*Migration, records map[int64]Record) ([]PlannedMigration, error) {
+		return planDownTo(migrations, records, version)
+	})
+}
+
+// Reset rolls back every applied migration, newest first, in a single run.
+// It returns ErrNoRollback when nothing has been applied.
+func (mg *Migrator) Reset(ctx context.Context) error {
+	return mg.DownTo(ctx, math.MinInt64)
+}
+
+// down rolls back the migrations planned by plan under the lock.
+func (mg *Migrator) down(ctx context.Context, plan func([]*Migration, map[int64]Record) ([]PlannedMigration, error)) error {
+	unlock, err := mg.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := mg.preflight(ctx); err != nil {
+		return err
+	}
+
+	migrations, records, err := mg.load(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	planned, err := plan(migrations, records)
+	if err != nil {
+		return err
+	}
+
+	if err := mg.run(ctx, DirectionDown, planned); err != nil {
+		return err
+	}
+
+	mg.log().Info("Rollback successful", "count", len(planned))
+	return nil
+}
+
+// Baseline marks every migration up to and including version as applied
+// without executing it, so an existing database can adopt migo and only
+// newer migrations run. It returns the number of migrations marked.
+func (mg *Migrator) Baseline(ctx context.Context, version int64) (int, error) {
+	return mg.markApplied(ctx, func(m *Migration) bool { return m.Version <= version }, nil)
+}
+
+// MarkApplied marks exactly the given versions as applied without
+// executing them, e.g. to adopt the history of another tool that allowed
+// gaps. It returns the number of migrations marked and fails without
+// marking any when a version has no migration file.
+func (mg *Migrator) MarkApplied(ctx context.Context, versions ...int64) (int, error) {
+	return mg.markApplied(ctx, func(m *Migration) bool { return slices.Contains(versions, m.Version) }, versions)
+}
+
+// markApplied records the migrations selected by include as applied.
+// Every version of want must have a migration file.
+func (mg *Migrator) markApplied(ctx context.Context, include func(*Migration) bool, want []int64) (int, error) {
+	unlock, err := mg.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := mg.preflight(ctx); err != nil {
+		return 0, err
+	}
+
+	migrations, records, err := mg.load(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range want {
+		if !slices.ContainsFunc(migrations, func(m *Migration) bool { return m.Version == v }) {
+			return 0, fmt.Errorf("no migration file for version %d", v)
+		}
+	}
+
+	sess, err := mg.drv.Session(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer sess.Close()
+
+	tx, err := sess.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count := 0
+	for _, m := range migrations {
+		if !include(m) {
+			continue
+		}
+		if r, ok := records[m.Version]; ok && r.Done() {
+			if !checksumMatches(r, m) {
+				return 0, checksumError(m)
+			}
+			continue // already applied
+		}
+
+		mg.log().Info("Baselining migration", "version", m.Version, "name", m.Name)
+		if err := tx.SaveRecord(ctx, mg.newRecord(m, StatusApplied)); err != nil {
+			return 0, fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+		if err := mg.audit(ctx, tx, m, HistoryMark, time.Time{}, nil); err != nil {
+			return 0, fmt.Errorf("failed to record history of migration %d: %w", m.Version, err)
+		}
+		count++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// MigrationInfo pairs a migration file with its bookkeeping row.
+type MigrationInfo struct {
+	*Migration
+	Record *Record // nil when the migration has never been recorded
+}
+
+// Valid reports whether the recorded checksum matches the file.
+func (i MigrationInfo) Valid() bool {
+	return i.Record != nil && checksumMatches(*i.Record, i.Migration)
+}
+
+// Info returns the state of every migration file, ordered by version.
+func (mg *Migrator) Info(ctx context.Context) ([]MigrationInfo, error) {
+	migrations, records, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]MigrationInfo, 0, len(migrations))
+	for _, m := range migrations {
+		info := MigrationInfo{Migration: m}
+		if r, ok := records[m.Version]; ok {
+			info.Record = &r
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
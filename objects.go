@@ -0,0 +1,124 @@
+package migo
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// lockMode is a PostgreSQL table lock mode, ordered by strength.
+type lockMode int
+
+const (
+	lockRowExclusive lockMode = iota + 1
+	lockShareUpdateExclusive
+	lockShare
+	lockShareRowExclusive
+	lockExclusive
+	lockAccessExclusive
+)
+
+var lockModeNames = map[lockMode]string{
+	lockRowExclusive:         "ROW EXCLUSIVE",
+	lockShareUpdateExclusive: "SHARE UPDATE EXCLUSIVE",
+	lockShare:                "SHARE",
+	lockShareRowExclusive:    "SHARE ROW EXCLUSIVE",
+	lockExclusive:            "EXCLUSIVE",
+	lockAccessExclusive:      "ACCESS EXCLUSIVE",
+}
+
+func (l lockMode) String() string {
+	return lockModeNames[l]
+}
+
+// tableLock is a table a statement touches and the lock it takes on it.
+type tableLock struct {
+	table   string
+	mode    lockMode
+	created bool // the statement creates the table
+}
+
+// Patterns locating the tables a statement touches, matched against the
+// statement with comments removed. Each captures one table name.
+var (
+	reTableDDL      = regexp.MustCompile(`(?i)^(CREATE|ALTER|DROP) (?:(?:GLOBAL |LOCAL )?(?:TEMP |TEMPORARY |UNLOGGED ))?TABLE (?:IF (?:NOT )?EXISTS )?(?:ONLY )?([^\s(,]+)`)
+	reIndexOn       = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (CONCURRENTLY )?.*? ON (?:ONLY )?([^\s(]+)`)
+	reTriggerOn     = regexp.MustCompile(`(?i)^CREATE (?:OR REPLACE )?(?:CONSTRAINT )?TRIGGER .*? ON ([^\s(]+)`)
+	reTruncate      = regexp.MustCompile(`(?i)^TRUNCATE (?:TABLE )?(?:ONLY )?([^\s,]+)`)
+	reLockTable     = regexp.MustCompile(`(?i)^LOCK (?:TABLE )?(?:ONLY )?([^\s,]+)(?: IN ([A-Z ]+?) MODE)?`)
+	reDML           = regexp.MustCompile(`(?i)^(?:INSERT INTO|UPDATE(?: ONLY)?|DELETE FROM(?: ONLY)?) ([^\s(]+)`)
+	reReferences    = regexp.MustCompile(`(?i)\bREFERENCES ([^\s(]+)`)
+	reValidateCheck = regexp.MustCompile(`(?i)\bVALIDATE CONSTRAINT\b`)
+)
+
+// statementLocks returns the tables stmt touches with the lock each one
+// takes, folded the way PostgreSQL folds identifiers. ALTER TABLE is
+// assumed to take ACCESS EXCLUSIVE unless it only validates constraints.
+func statementLocks(stmt Statement) []tableLock {
+	var locks []tableLock
+	add := func(name string, mode lockMode, created bool) {
+		locks = append(locks, tableLock{table: foldIdent(name), mode: mode, created: created})
+	}
+	code := stmt.code
+	if m := reTableDDL.FindStringSubmatch(code); m != nil {
+		mode := lockAccessExclusive
+		if strings.EqualFold(m[1], "ALTER") && reValidateCheck.MatchString(code) {
+			mode = lockShareUpdateExclusive
+		}
+		add(m[2], mode, strings.EqualFold(m[1], "CREATE"))
+	}
+	if m := reIndexOn.FindStringSubmatch(code); m != nil {
+		mode := lockShare
+		if m[1] != "" {
+			mode = lockShareUpdateExclusive
+		}
+		add(m[2], mode, false)
+	}
+	if m := reTriggerOn.FindStringSubmatch(code); m != nil {
+		add(m[1], lockShareRowExclusive, false)
+	}
+	if m := reTruncate.FindStringSubmatch(code); m != nil {
+		add(m[1], lockAccessExclusive, false)
+	}
+	if m := reLockTable.FindStringSubmatch(code); m != nil {
+		mode := lockAccessExclusive
+		for l, name := range lockModeNames {
+			if strings.EqualFold(m[2], name) {
+				mode = l
+			}
+		}
+		add(m[1], mode, false)
+	}
+	if m := reDML.FindStringSubmatch(code); m != nil {
+		add(m[1], lockRowExclusive, false)
+	}
+	for _, m := range reReferences.FindAllStringSubmatch(code, -1) {
+		add(m[1], lockShareRowExclusive, false)
+	}
+	return locks
+}
+
+// statementTables returns the tables stmt touches.
+func statementTables(stmt Statement) []string {
+	var tables []string
+	for _, l := range statementLocks(stmt) {
+		if !slices.Contains(tables, l.table) {
+			tables = append(tables, l.table)
+		}
+	}
+	return tables
+}
+
+// foldIdent lowercases the unquoted parts of a possibly qualified name and
+// unquotes the quoted ones.
+func foldIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if unquoted, ok := strings.CutPrefix(p, `"`); ok {
+			parts[i] = strings.ReplaceAll(strings.TrimSuffix(unquoted, `"`), `""`, `"`)
+		} else {
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
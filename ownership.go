@@ -0,0 +1,66 @@
+package migo
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Ownership maps teams to the tables they own. Entries are table names
+// ("users", matching the table in any schema on the search path),
+// qualified names ("billing.invoices") or whole schemas ("billing.*").
+type Ownership map[string][]string
+
+// Owner returns the team owning table, or "" when nobody does.
+func (o Ownership) Owner(table string) string {
+	schema, name, qualified := strings.Cut(table, ".")
+	if !qualified {
+		schema, name = "public", table
+	}
+	teams := make([]string, 0, len(o))
+	for team := range o {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams) // deterministic when entries overlap
+	for _, team := range teams {
+		for _, entry := range o[team] {
+			entry = foldIdent(entry)
+			switch {
+			case entry == schema+".*",
+				entry == schema+"."+name,
+				entry == name && (!qualified || schema == "public"):
+				return team
+			}
+		}
+	}
+	return ""
+}
+
+// Teams returns the teams owning the tables m's up section touches, in
+// order of first appearance.
+func (o Ownership) Teams(m *Migration) []string {
+	var teams []string
+	for _, stmt := range splitStatements(m.UpSQL) {
+		for _, t := range statementTables(stmt) {
+			if team := o.Owner(t); team != "" && !slices.Contains(teams, team) {
+				teams = append(teams, team)
+			}
+		}
+	}
+	return teams
+}
+
+// scope keeps the planned migrations touching Options.Team's tables when a
+// team is set. The others stay pending for their owners.
+func (mg *Migrator) scope(plan []PlannedMigration) []PlannedMigration {
+	if mg.opts.Team == "" {
+		return plan
+	}
+	var scoped []PlannedMigration
+	for _, p := range plan {
+		if slices.Contains(mg.opts.Ownership.Teams(p.migration), mg.opts.Team) {
+			scoped = append(scoped, p)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,92 @@
+package migo
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// parallelBatch returns how many migrations at the start of plan Up may
+// apply at once: the leading run of migrations marked "-- +parallel" that
+// don't depend on each other, or 1.
+func (mg *Migrator) parallelBatch(plan []PlannedMigration) int {
+	if mg.opts.Parallel < 2 {
+		return 1
+	}
+	n := 0
+	for n < len(plan) && plan[n].Direction == DirectionUp && plan[n].migration.Parallel && !dependsOnAny(plan[n].migration, plan[:n]) {
+		n++
+	}
+	return max(n, 1)
+}
+
+// runParallel applies the n migrations of plan starting at start with a
+// pool of up to Options.Parallel workers, each on its own session that the
+// before_all hook ran on first, so its session settings hold there too.
+// Once a migration fails no further one is started, but those already
+// running finish; the migrations never started stay pending.
+func (mg *Migrator) runParallel(ctx context.Context, runID string, plan []PlannedMigration, start, n int) error {
+	sessions := make([]Session, 0, min(mg.opts.Parallel, n))
+	defer func() {
+		for _, sess := range sessions {
+			sess.Close()
+		}
+	}()
+	for len(sessions) < cap(sessions) {
+		sess, err := mg.drv.Session(ctx)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, sess)
+		if err := mg.runHook(ctx, sess, "before_all", mg.opts.Hooks.BeforeAll); err != nil {
+			return err
+		}
+	}
+	mg.log().Info("Applying migrations in parallel", "count", n, "workers", len(sessions))
+
+	var mu sync.Mutex // serializes events and guards failed
+	failed := false
+	emit := func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		mg.emit(e)
+	}
+
+	errs := make([]error, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for _, sess := range sessions {
+		wg.Go(func() {
+			for k := range next {
+				i := start + k
+				if errs[k] = mg.step(ctx, sess, nil, Event{RunID: runID, Index: i + 1, Total: len(plan)}, plan[i], emit); errs[k] != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		})
+	}
+	for k := range n {
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+
+	var failures []error
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) == 1 {
+		return failures[0]
+	}
+	return errors.Join(failures...)
+}
@@ -0,0 +1,291 @@
+package migo
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ErrNoRollback is returned when there is no applied migration to roll back.
+var ErrNoRollback = errors.New("no migrations to rollback")
+
+// ErrNoPending is returned by UpByOne when every migration is applied.
+var ErrNoPending = errors.New("no pending migrations")
+
+// Direction tells whether a planned migration is applied or rolled back.
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// PlannedMigration is a single step of a plan: the SQL that will run for a
+// migration and anything an operator should know before approving it.
+type PlannedMigration struct {
+	Version       int64
+	Name          string
+	Direction     Direction
+	SQL           string
+	Verify        string // "-- +verify" queries checked after SQL, up only
+	Checksum      string // checksum of the migration file
+	Transactional bool
+	Repeatable    bool // a changed repeatable migration, planned after the versioned ones; Version is zero
+	Warnings      []string
+
+	migration *Migration
+}
+
+// Plan returns the migrations Up would apply, without touching the
+// database.
+func (mg *Migrator) Plan(ctx context.Context) ([]PlannedMigration, error) {
+	return mg.PlanTo(ctx, math.MaxInt64)
+}
+
+// PlanTo returns the migrations UpTo(version) would apply.
+func (mg *Migrator) PlanTo(ctx context.Context, version int64) ([]PlannedMigration, error) {
+	migrations, records, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planUp(migrations, records, version, mg.opts.IgnoreChecksum)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mg.checkGaps(migrations, records); err != nil {
+		return nil, err
+	}
+	plan, _ = mg.filterTags(mg.scope(plan))
+	repeatables, err := mg.planRepeatables(ctx, migrations, records, version)
+	if err != nil {
+		return nil, err
+	}
+	plan, _ = mg.limit(append(plan, repeatables...))
+	if err := checkDependencies(migrations, records, plan); err != nil {
+		return nil, err
+	}
+
+	indexes, err := mg.invalidIndexes(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range plan {
+		for _, idx := range indexes {
+			if idx.Migration == p.migration && !p.Transactional {
+				plan[i].Warnings = append(plan[i].Warnings, fmt.Sprintf("invalid index %s.%s from a failed build will be dropped and rebuilt", idx.Schema, idx.Name))
+			}
+		}
+	}
+	for i, warnings := range lockHazards(plan) {
+		plan[i].Warnings = append(plan[i].Warnings, warnings...)
+	}
+	return plan, nil
+}
+
+// PlanDown returns the rollback Down would perform.
+func (mg *Migrator) PlanDown(ctx context.Context) ([]PlannedMigration, error) {
+	return mg.PlanDownSteps(ctx, 1)
+}
+
+// PlanDownSteps returns the rollbacks DownSteps(n) would perform, newest
+// first.
+func (mg *Migrator) PlanDownSteps(ctx context.Context, n int) ([]PlannedMigration, error) {
+	migrations, records, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return planDown(migrations, records, n)
+}
+
+// PlanDownTo returns the rollbacks DownTo(version) would perform, newest
+// first.
+func (mg *Migrator) PlanDownTo(ctx context.Context, version int64) ([]PlannedMigration, error) {
+	migrations, records, err := mg.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return planDownTo(migrations, records, version)
+}
+
+// PlanReset returns the rollbacks Reset would perform, newest first.
+func (mg *Migrator) PlanReset(ctx context.Context) ([]PlannedMigration, error) {
+	return mg.PlanDownTo(ctx, math.MinInt64)
+}
+
+// limit cuts plan to Options.Limit migrations and returns how many were
+// cut.
+func (mg *Migrator) limit(plan []PlannedMigration) ([]PlannedMigration, int) {
+	if mg.opts.Limit <= 0 || len(plan) <= mg.opts.Limit {
+		return plan, 0
+	}
+	return plan[:mg.opts.Limit], len(plan) - mg.opts.Limit
+}
+
+func checksumError(m *Migration) error {
+	return &ChecksumError{Version: m.Version, Name: m.Name}
+}
+
+func planUp(migrations []*Migration, records map[int64]Record, target int64, ignoreChecksum bool) ([]PlannedMigration, error) {
+	// Validate checksums and refuse to continue past dirty migrations
+	var latest int64
+	for _, m := range migrations {
+		if r, ok := records[m.Version]; ok {
+			if r.Done() && !ignoreChecksum && !checksumMatches(r, m) {
+				return nil, checksumError(m)
+			}
+			if r.Status == StatusDirty {
+				return nil, fmt.Errorf("migration %d_%s is dirty — resolve it manually before running again", m.Version, m.Name)
+			}
+			if r.Done() && m.Version > latest {
+				latest = m.Version
+			}
+		}
+	}
+
+	var plan []PlannedMigration
+	for _, m := range migrations {
+		r, ok := records[m.Version]
+		if ok && r.Done() {
+			continue // already applied or skipped
+		}
+		if m.Version > target {
+			break
+		}
+
+		p := PlannedMigration{
+			Version:       m.Version,
+			Name:          m.Name,
+			Direction:     DirectionUp,
+			SQL:           m.UpSQL,
+			Verify:        m.VerifySQL,
+			Checksum:      m.Checksum,
+			Transactional: m.Transactional,
+			migration:     m,
+		}
+		if !m.Transactional {
+			p.Warnings = append(p.Warnings, "runs outside a transaction; a failure leaves the migration dirty")
+		}
+		if m.BatchSize > 0 {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("runs every statement in batches of %d until it affects no rows", m.BatchSize))
+		}
+		if isBlankSQL(m.UpSQL) {
+			p.Warnings = append(p.Warnings, "up section is empty")
+		}
+		switch {
+		case m.Irreversible:
+			p.Warnings = append(p.Warnings, "irreversible; down can't roll it back")
+		case isBlankSQL(m.DownSQL):
+			p.Warnings = append(p.Warnings, "down section is empty; rolling back will not undo anything")
+		}
+		if m.Version < latest {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("older than the latest applied migration %d; it will be applied out of order", latest))
+		}
+		if ok && r.Status == StatusFailed {
+			p.Warnings = append(p.Warnings, "previous attempt failed; retrying")
+		}
+		plan = append(plan, p)
+	}
+	return plan, nil
+}
+
+// planDownTo plans the rollback of the applied migrations newer than
+// version.
+func planDownTo(migrations []*Migration, records map[int64]Record, version int64) ([]PlannedMigration, error) {
+	if err := checkDirty(records); err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, r := range records {
+		if r.Status == StatusApplied && r.Version > version {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, ErrNoRollback
+	}
+	return planDown(migrations, records, n)
+}
+
+func planDown(migrations []*Migration, records map[int64]Record, n int) ([]PlannedMigration, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("cannot roll back %d migrations, steps must be at least 1", n)
+	}
+	if err := checkDirty(records); err != nil {
+		return nil, err
+	}
+	var applied []Record
+	for _, r := range records {
+		if r.Status == StatusApplied {
+			applied = append(applied, r)
+		}
+	}
+	if len(applied) == 0 {
+		return nil, ErrNoRollback
+	}
+	if n > len(applied) {
+		return nil, fmt.Errorf("cannot roll back %d migrations, only %d are applied", n, len(applied))
+	}
+	slices.SortFunc(applied, func(a, b Record) int { return cmp.Compare(b.Version, a.Version) })
+
+	files := make(map[int64]*Migration, len(migrations))
+	for _, m := range migrations {
+		files[m.Version] = m
+	}
+	plan := make([]PlannedMigration, 0, n)
+	for _, r := range applied[:n] {
+		m, ok := files[r.Version]
+		if !ok {
+			return nil, fmt.Errorf("migration file for applied version %d_%s not found", r.Version, r.Name)
+		}
+		if m.Irreversible {
+			return nil, &IrreversibleError{Version: m.Version, Name: m.Name}
+		}
+		p := PlannedMigration{
+			Version:       m.Version,
+			Name:          m.Name,
+			Direction:     DirectionDown,
+			SQL:           m.DownSQL,
+			Checksum:      m.Checksum,
+			Transactional: m.Transactional,
+			migration:     m,
+		}
+		if !m.Transactional {
+			p.Warnings = append(p.Warnings, "runs outside a transaction; a failure leaves the migration dirty")
+		}
+		if isBlankSQL(m.DownSQL) {
+			p.Warnings = append(p.Warnings, "down section is empty; only the bookkeeping row is removed")
+		}
+		plan = append(plan, p)
+	}
+	if err := checkDependencies(migrations, records, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// checkDirty fails when a migration was left dirty, as nothing can be
+// rolled back safely before it is resolved.
+func checkDirty(records map[int64]Record) error {
+	for _, r := range records {
+		if r.Status == StatusDirty {
+			return fmt.Errorf("migration %d_%s is dirty — resolve it manually before running again", r.Version, r.Name)
+		}
+	}
+	return nil
+}
+
+// isBlankSQL reports whether s contains nothing but whitespace and line
+// comments.
+func isBlankSQL(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
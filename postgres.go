@@ -0,0 +1,326 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// advisoryLockID identifies migo's session-level advisory lock.
+const advisoryLockID int64 = 7_274_834_620_581_283_921
+
+// Postgres is the PostgreSQL Driver. It also implements Locker with an
+// advisory lock.
+type Postgres struct {
+	// Scratch, when set, is the database drift detection replays
+	// migrations on instead of the live one, e.g. because the live
+	// connection is read-only.
+	Scratch *sql.DB
+
+	db        *sql.DB
+	lock      *sql.Conn
+	schema    string
+	component string // suffix of the bookkeeping tables
+	flyway    bool   // bookkeeping in flyway_schema_history
+}
+
+// NewPostgres returns a Driver for db.
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// WithSchema returns a Driver for the same database that keeps its
+// bookkeeping table in schema and runs migrations with schema first on the
+// search_path, so unqualified names resolve there. It is meant for
+// schema-per-tenant databases, with one Migrator per tenant schema.
+func (p *Postgres) WithSchema(schema string) *Postgres {
+	return &Postgres{db: p.db, Scratch: p.Scratch, schema: schema, component: p.component, flyway: p.flyway}
+}
+
+// WithComponent returns a Driver for the same database that keeps its
+// bookkeeping in tables of its own, suffixed with name, e.g.
+// schema_migrations_billing. It is meant for monorepos whose components
+// each have a migrations directory and are migrated independently, with
+// one Migrator per component. Components share the migration lock.
+func (p *Postgres) WithComponent(name string) *Postgres {
+	return &Postgres{db: p.db, Scratch: p.Scratch, schema: p.schema, component: name, flyway: p.flyway}
+}
+
+// table returns the bookkeeping table's name, qualified with the schema.
+func (p *Postgres) table() string {
+	if p.flyway {
+		return p.qualify("flyway_schema_history")
+	}
+	return p.qualify("schema_migrations")
+}
+
+// relname returns the unqualified name of the bookkeeping table name,
+// suffixed with the component.
+func (p *Postgres) relname(name string) string {
+	if p.component != "" {
+		return name + "_" + p.component
+	}
+	return name
+}
+
+// qualify returns the bookkeeping table name, suffixed with the component
+// and qualified with the schema.
+func (p *Postgres) qualify(name string) string {
+	if p.component != "" {
+		name = quoteIdent(p.relname(name))
+	}
+	if p.schema == "" {
+		return name
+	}
+	return quoteIdent(p.schema) + "." + name
+}
+
+// DB returns the underlying database handle.
+func (p *Postgres) DB() *sql.DB {
+	return p.db
+}
+
+func (p *Postgres) Init(ctx context.Context) error {
+	return p.init(ctx, p.db)
+}
+
+// init creates or upgrades the bookkeeping tables through e.
+func (p *Postgres) init(ctx context.Context, e execer) error {
+	if err := p.initHistory(ctx, e); err != nil {
+		return err
+	}
+	if p.flyway {
+		return p.initFlyway(ctx, e)
+	}
+	if err := p.initRepeatable(ctx, e); err != nil {
+		return err
+	}
+	_, err := e.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+p.table()+` (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL,
+			status TEXT NOT NULL DEFAULT 'applied'
+		);
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'applied';
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS validation_checksum TEXT;
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS duration_ms BIGINT;
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS applied_by TEXT;
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS applied_host TEXT;
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS ci_job_url TEXT;
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS migo_version TEXT;
+		ALTER TABLE `+p.table()+` ADD COLUMN IF NOT EXISTS migration_source TEXT;
+	`)
+	return err
+}
+
+// Records reports a missing table as an empty history so read-only callers
+// such as Plan don't have to create it. Columns added after the first
+// release are read through to_jsonb, so tables Init hasn't upgraded yet
+// can still be read.
+func (p *Postgres) Records(ctx context.Context) ([]Record, error) {
+	var exists bool
+	if err := p.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, p.table()).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	if p.flyway {
+		return p.flywayRecords(ctx)
+	}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT version, name, checksum, status, applied_at,
+		COALESCE(to_jsonb(m)->>'validation_checksum', ''), COALESCE((to_jsonb(m)->>'duration_ms')::bigint, 0),
+		COALESCE(to_jsonb(m)->>'applied_by', ''), COALESCE(to_jsonb(m)->>'applied_host', ''),
+		COALESCE(to_jsonb(m)->>'ci_job_url', ''), COALESCE(to_jsonb(m)->>'migo_version', ''),
+		COALESCE(to_jsonb(m)->>'migration_source', '')
+		FROM `+p.table()+` m ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		var durationMS int64
+		if err := rows.Scan(&r.Version, &r.Name, &r.Checksum, &r.Status, &r.AppliedAt, &r.ValidationChecksum, &durationMS,
+			&r.AppliedBy.User, &r.AppliedBy.Host, &r.AppliedBy.CIJobURL, &r.AppliedBy.Version, &r.AppliedBy.Source); err != nil {
+			return nil, err
+		}
+		r.Duration = time.Duration(durationMS) * time.Millisecond
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (p *Postgres) Session(ctx context.Context) (Session, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.schema != "" {
+		if _, err := conn.ExecContext(ctx, `SELECT set_config('search_path', $1, false)`, quoteIdent(p.schema)+", public"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	var pid int
+	if err := conn.QueryRowContext(ctx, `SELECT pg_backend_pid()`).Scan(&pid); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &pgSession{pgExecer{conn, p.table(), p.historyTable(), p.repeatableTable(), p.flyway}, conn, p.db, pid, p.schema != ""}, nil
+}
+
+// Lock blocks until migo's advisory lock is acquired on a dedicated
+// connection.
+func (p *Postgres) Lock(ctx context.Context) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+		conn.Close()
+		return err
+	}
+	// state_change of the lock connection then tells when it was taken
+	if _, err := conn.ExecContext(ctx, `SELECT set_config('application_name', $1, false)`, lockApplicationName()); err != nil {
+		conn.Close()
+		return err
+	}
+	p.lock = conn
+	return nil
+}
+
+func (p *Postgres) Unlock(ctx context.Context) error {
+	if p.lock == nil {
+		return nil
+	}
+	defer func() {
+		p.lock.Close()
+		p.lock = nil
+	}()
+	_, err := p.lock.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, advisoryLockID)
+	return err
+}
+
+// execer is satisfied by *sql.DB, *sql.Conn and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type pgExecer struct {
+	e          execer
+	table      string
+	history    string // audit history table
+	repeatable string // repeatable migrations table
+	flyway     bool
+}
+
+func (p pgExecer) Exec(ctx context.Context, query string) error {
+	_, err := p.e.ExecContext(ctx, query)
+	return err
+}
+
+func (p pgExecer) ExecRows(ctx context.Context, query string) (int64, error) {
+	res, err := p.e.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Verify queries the database, or writes a DO block raising an exception
+// when the query doesn't hold to a script.
+func (p pgExecer) Verify(ctx context.Context, query string) (bool, error) {
+	q, ok := p.e.(interface {
+		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	})
+	if !ok {
+		err := p.Exec(ctx, `
+			DO $migo_verify$
+			DECLARE holds boolean;
+			BEGIN
+				EXECUTE `+sqlLiteral(query)+` INTO holds;
+				IF holds IS NOT TRUE THEN
+					RAISE EXCEPTION 'verify query did not return true: %', `+sqlLiteral(query)+`;
+				END IF;
+			END
+			$migo_verify$`)
+		return err == nil, err
+	}
+	var holds sql.NullBool
+	err := q.QueryRowContext(ctx, query).Scan(&holds)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return holds.Bool, err
+}
+
+func (p pgExecer) SaveRecord(ctx context.Context, r Record) error {
+	if p.flyway {
+		return p.saveFlywayRecord(ctx, r)
+	}
+	by := r.AppliedBy
+	_, err := p.e.ExecContext(ctx, `INSERT INTO `+p.table+` (version, name, checksum, applied_at, status, validation_checksum, duration_ms,
+			applied_by, applied_host, ci_job_url, migo_version, migration_source)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''))
+		ON CONFLICT (version) DO UPDATE
+		SET name = EXCLUDED.name, checksum = EXCLUDED.checksum,
+			applied_at = EXCLUDED.applied_at, status = EXCLUDED.status,
+			validation_checksum = EXCLUDED.validation_checksum, duration_ms = EXCLUDED.duration_ms,
+			applied_by = EXCLUDED.applied_by, applied_host = EXCLUDED.applied_host,
+			ci_job_url = EXCLUDED.ci_job_url, migo_version = EXCLUDED.migo_version,
+			migration_source = EXCLUDED.migration_source`,
+		r.Version, r.Name, r.Checksum, r.AppliedAt, r.Status, r.ValidationChecksum, r.Duration.Milliseconds(),
+		by.User, by.Host, by.CIJobURL, by.Version, by.Source)
+	return err
+}
+
+func (p pgExecer) DeleteRecord(ctx context.Context, version int64) error {
+	var v any = version
+	if p.flyway {
+		v = strconv.FormatInt(version, 10) // flyway_schema_history.version is text
+	}
+	_, err := p.e.ExecContext(ctx, `DELETE FROM `+p.table+` WHERE version = $1`, v)
+	return err
+}
+
+type pgSession struct {
+	pgExecer
+	conn       *sql.Conn
+	db         *sql.DB // pool for inspecting conn while it's busy, see Activity
+	pid        int     // backend process ID of conn
+	searchPath bool    // search_path was set and is reset on Close
+}
+
+func (s *pgSession) Begin(ctx context.Context) (Tx, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	e := s.pgExecer
+	e.e = tx
+	return &pgTx{e, tx}, nil
+}
+
+// Close returns the connection to the pool, with the search_path of the
+// tenant schema reset so other users of the pool don't inherit it.
+func (s *pgSession) Close() error {
+	if s.searchPath {
+		s.conn.ExecContext(context.Background(), `RESET search_path`)
+	}
+	return s.conn.Close()
+}
+
+type pgTx struct {
+	pgExecer
+	tx *sql.Tx
+}
+
+func (t *pgTx) Commit() error   { return t.tx.Commit() }
+func (t *pgTx) Rollback() error { return t.tx.Rollback() }
@@ -0,0 +1,226 @@
+package migo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Preflight lists the checks Up, UpTo, Down and their variants make
+// against the target before executing any SQL, so a run pointed at the
+// wrong or a misconfigured database fails fast. The zero value checks
+// nothing.
+type Preflight struct {
+	// ServerVersion constrains the server version, e.g. ">=14, <18" or
+	// "16". Versions without a minor version compare the major version
+	// only.
+	ServerVersion string
+	// Extensions must be installed in the database.
+	Extensions []string
+	// Privileges checks that the role can create objects in the schema
+	// migrations run in and write the bookkeeping tables.
+	Privileges bool
+	// Database is a regular expression the name of the database must
+	// match, e.g. `^app_(staging|production)$`.
+	Database string
+}
+
+func (p Preflight) empty() bool {
+	return p.ServerVersion == "" && len(p.Extensions) == 0 && !p.Privileges && p.Database == ""
+}
+
+// Environment describes the target of a run for the pre-flight checks.
+type Environment struct {
+	ServerVersion    string // server_version, e.g. "16.4"
+	ServerVersionNum int    // server_version_num, e.g. 160004
+	Database         string
+	Role             string
+	Schema           string   // schema migrations create objects in
+	CanCreate        bool     // the role can create objects in Schema
+	ReadOnlyTables   []string // existing bookkeeping tables the role can't write
+	Installed        []string // extensions installed in the database
+	Available        []string // extensions the server can install
+}
+
+// EnvironmentInspector is implemented by drivers that can describe their
+// target for the pre-flight checks.
+type EnvironmentInspector interface {
+	Environment(ctx context.Context) (*Environment, error)
+}
+
+// PreflightError is returned when pre-flight checks fail. Nothing was
+// executed.
+type PreflightError struct {
+	Failures []string
+}
+
+func (e *PreflightError) Error() string {
+	return "pre-flight checks failed:\n  - " + strings.Join(e.Failures, "\n  - ")
+}
+
+// Preflight runs the checks of Options.Preflight and returns a
+// *PreflightError listing every one that failed.
+func (mg *Migrator) Preflight(ctx context.Context) error {
+	pf := mg.opts.Preflight
+	if pf.empty() {
+		return nil
+	}
+	var database *regexp.Regexp
+	if pf.Database != "" {
+		var err error
+		if database, err = regexp.Compile(pf.Database); err != nil {
+			return fmt.Errorf("invalid pre-flight database pattern: %w", err)
+		}
+	}
+	ei, ok := mg.drv.(EnvironmentInspector)
+	if !ok {
+		return errors.New("driver can't run pre-flight checks")
+	}
+	env, err := ei.Environment(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to inspect the server for pre-flight checks: %w", err)
+	}
+
+	var failures []string
+	if pf.ServerVersion != "" {
+		ok, err := satisfiesVersion(pf.ServerVersion, env.ServerVersionNum)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			failures = append(failures, fmt.Sprintf("server runs PostgreSQL %s, but %s is required; upgrade the server or point migo at one that matches", env.ServerVersion, pf.ServerVersion))
+		}
+	}
+	if database != nil && !database.MatchString(env.Database) {
+		failures = append(failures, fmt.Sprintf("connected to database %s, which doesn't match %s; check the connection string", env.Database, pf.Database))
+	}
+	for _, ext := range pf.Extensions {
+		switch {
+		case slices.Contains(env.Installed, ext):
+		case slices.Contains(env.Available, ext):
+			failures = append(failures, fmt.Sprintf("extension %s is not installed; run CREATE EXTENSION %s as a role allowed to, or in an earlier migration", ext, sqlIdent(ext)))
+		default:
+			failures = append(failures, fmt.Sprintf("extension %s is not available on the server; install its package first", ext))
+		}
+	}
+	if pf.Privileges {
+		if !env.CanCreate {
+			failures = append(failures, fmt.Sprintf("role %s can't create objects in schema %s; run GRANT CREATE ON SCHEMA %s TO %s", env.Role, env.Schema, sqlIdent(env.Schema), sqlIdent(env.Role)))
+		}
+		for _, t := range env.ReadOnlyTables {
+			failures = append(failures, fmt.Sprintf("role %s can't write %s; run GRANT SELECT, INSERT, UPDATE, DELETE ON %s TO %s", env.Role, t, t, sqlIdent(env.Role)))
+		}
+	}
+	if len(failures) > 0 {
+		return &PreflightError{Failures: failures}
+	}
+	mg.log().Info("Pre-flight checks passed", "server_version", env.ServerVersion, "database", env.Database, "role", env.Role)
+	return nil
+}
+
+// satisfiesVersion reports whether the server_version_num num satisfies
+// constraint, a comma-separated list of comparisons such as ">=14, <18".
+func satisfiesVersion(constraint string, num int) (bool, error) {
+	major, minor := num/10000, num%10000
+	if num < 100000 {
+		minor = num / 100 % 100 // 9.6 and older: 90624 is 9.6.24
+	}
+	for _, term := range strings.Split(constraint, ",") {
+		term = strings.TrimSpace(term)
+		op := strings.TrimRight(term, "0123456789. ")
+		v := strings.TrimSpace(term[len(op):])
+		wantMajor, wantMinor, hasMinor := strings.Cut(v, ".")
+		wmaj, err1 := strconv.Atoi(wantMajor)
+		wmin, err2 := strconv.Atoi(wantMinor)
+		if err1 != nil || hasMinor && err2 != nil {
+			return false, fmt.Errorf("invalid server version constraint %q", term)
+		}
+		c := major - wmaj
+		if c == 0 && hasMinor {
+			c = minor - wmin
+		}
+		var ok bool
+		switch op {
+		case ">=":
+			ok = c >= 0
+		case ">":
+			ok = c > 0
+		case "<=":
+			ok = c <= 0
+		case "<":
+			ok = c < 0
+		case "=", "==", "":
+			ok = c == 0
+		case "!=":
+			ok = c != 0
+		default:
+			return false, fmt.Errorf("invalid server version constraint %q", term)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// preflight runs the pre-flight checks of a writing operation.
+func (mg *Migrator) preflight(ctx context.Context) error {
+	if mg.opts.Preflight.empty() {
+		return nil
+	}
+	return mg.Preflight(ctx)
+}
+
+func (p *Postgres) Environment(ctx context.Context) (*Environment, error) {
+	env := &Environment{}
+	err := p.db.QueryRowContext(ctx, `SELECT current_setting('server_version'), current_setting('server_version_num')::int,
+		current_database(), current_user, COALESCE(NULLIF($1::text, ''), current_schema(), 'public')`, p.schema).
+		Scan(&env.ServerVersion, &env.ServerVersionNum, &env.Database, &env.Role, &env.Schema)
+	if err != nil {
+		return nil, err
+	}
+	// A missing schema is created by a migration, which takes CREATE on
+	// the database.
+	if err := p.db.QueryRowContext(ctx, `SELECT CASE WHEN to_regnamespace(quote_ident($1::text)) IS NULL
+		THEN has_database_privilege(current_database(), 'CREATE')
+		ELSE has_schema_privilege($1::text, 'CREATE') END`, env.Schema).Scan(&env.CanCreate); err != nil {
+		return nil, err
+	}
+
+	tables := []string{p.table(), p.historyTable()}
+	if !p.flyway {
+		tables = append(tables, p.repeatableTable())
+	}
+	for _, t := range tables {
+		var writable bool
+		if err := p.db.QueryRowContext(ctx, `SELECT CASE WHEN to_regclass($1::text) IS NULL THEN true
+			ELSE has_table_privilege($1::text, 'INSERT') AND has_table_privilege($1::text, 'UPDATE') AND has_table_privilege($1::text, 'DELETE') END`, t).Scan(&writable); err != nil {
+			return nil, err
+		}
+		if !writable {
+			env.ReadOnlyTables = append(env.ReadOnlyTables, t)
+		}
+	}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT name, installed_version IS NOT NULL FROM pg_available_extensions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var installed bool
+		if err := rows.Scan(&name, &installed); err != nil {
+			return nil, err
+		}
+		env.Available = append(env.Available, name)
+		if installed {
+			env.Installed = append(env.Installed, name)
+		}
+	}
+	return env, rows.Err()
+}
@@ -0,0 +1,97 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultProgressInterval is how often a running migration is reported
+// when Options.ProgressInterval is zero.
+const DefaultProgressInterval = time.Minute
+
+// Activity is what the connection of a session is doing, as reported by
+// the server.
+type Activity struct {
+	PID       int     // backend process ID
+	State     string  // e.g. "active" or "idle in transaction"
+	WaitEvent string  // e.g. "Lock:relation" or "IO:DataFileRead", empty when not waiting
+	BlockedBy []int64 // backends holding the locks it waits for
+}
+
+// ActivityReporter is implemented by Sessions that can tell, from another
+// connection, what their connection is doing while a statement runs.
+type ActivityReporter interface {
+	Activity(ctx context.Context) (*Activity, error)
+}
+
+// progress logs "Migration still running" for p every
+// Options.ProgressInterval until the returned function is called, with the
+// activity of sess when it is an ActivityReporter, so a migration waiting
+// on a lock can be told from one doing slow I/O.
+func (mg *Migrator) progress(ctx context.Context, sess Session, p PlannedMigration, began time.Time) (stop func()) {
+	interval := mg.opts.ProgressInterval
+	if interval == 0 {
+		interval = DefaultProgressInterval
+	}
+	if interval < 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			args := []any{"version", p.Version, "name", p.Name, "elapsed", mg.now().Sub(began).Round(time.Second)}
+			if ar, ok := sess.(ActivityReporter); ok {
+				a, err := ar.Activity(ctx)
+				switch {
+				case err != nil:
+					mg.log().Debug("failed to inspect the running migration", "version", p.Version, "error", err)
+				case a != nil:
+					args = append(args, "pid", a.PID, "state", a.State)
+					if a.WaitEvent != "" {
+						args = append(args, "wait_event", a.WaitEvent)
+					}
+					if len(a.BlockedBy) > 0 {
+						args = append(args, "blocked_by", a.BlockedBy)
+					}
+				}
+			}
+			mg.log().Info("Migration still running", args...)
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Activity looks up the backend of the session in pg_stat_activity, on a
+// connection of the pool since the session's is busy.
+func (s *pgSession) Activity(ctx context.Context) (*Activity, error) {
+	a := &Activity{PID: s.pid}
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(state, ''), COALESCE(wait_event_type || ':' || wait_event, ''), pg_blocking_pids(pid)
+		FROM pg_stat_activity WHERE pid = $1`, s.pid).Scan(&a.State, &a.WaitEvent, pq.Array(&a.BlockedBy))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
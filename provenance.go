@@ -0,0 +1,66 @@
+package migo
+
+import (
+	"os"
+	"os/user"
+	"runtime/debug"
+)
+
+// Provenance describes who or what applied a migration, for debugging
+// "who ran this on prod".
+type Provenance struct {
+	User     string // operating system user
+	Host     string
+	CIJobURL string // link to the CI job, when run in CI
+	Version  string // migo version
+	Source   string // where the migration files came from, e.g. the git commit of a fetched source
+}
+
+// ciJobURL returns the URL of the current CI job from the environment of
+// the common CI systems.
+func ciJobURL() string {
+	if run := os.Getenv("GITHUB_RUN_ID"); run != "" && os.Getenv("GITHUB_REPOSITORY") != "" {
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		return server + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" + run
+	}
+	for _, name := range []string{"CI_JOB_URL", "BUILD_URL", "CIRCLE_BUILD_URL", "BUILDKITE_BUILD_URL"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// moduleVersion returns the version of migo the binary was built with.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	const path = "github.com/bagastri07/migo"
+	if info.Main.Path == path {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			return dep.Version
+		}
+	}
+	return ""
+}
+
+// DetectProvenance describes the current process: the OS user, hostname,
+// CI job URL and migo version. Unknown parts are empty.
+func DetectProvenance() Provenance {
+	p := Provenance{CIJobURL: ciJobURL(), Version: moduleVersion()}
+	if u, err := user.Current(); err == nil {
+		p.User = u.Username
+	} else if p.User = os.Getenv("USER"); p.User == "" {
+		p.User = os.Getenv("USERNAME") // containers without a passwd entry, Windows
+	}
+	p.Host, _ = os.Hostname()
+	return p
+}
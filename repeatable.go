@@ -0,0 +1,372 @@
+package migo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RepeatableDir is the subdirectory of the migrations directory holding
+// repeatable migrations.
+const RepeatableDir = "repeatable"
+
+// RepeatableRecord is the bookkeeping row of a repeatable migration, kept
+// apart from the versioned ones.
+type RepeatableRecord struct {
+	Name      string
+	Checksum  string // of the file when it was last applied
+	AppliedAt time.Time
+	Duration  time.Duration
+}
+
+// RepeatableReader is implemented by drivers that track repeatable
+// migrations.
+type RepeatableReader interface {
+	// RepeatableRecords returns the bookkeeping rows of the repeatable
+	// migrations. A database that was never initialized has none.
+	RepeatableRecords(ctx context.Context) ([]RepeatableRecord, error)
+}
+
+// RepeatableWriter is implemented by Execers that track repeatable
+// migrations.
+type RepeatableWriter interface {
+	// SaveRepeatable inserts or replaces the bookkeeping row for r.Name.
+	SaveRepeatable(ctx context.Context, r RepeatableRecord) error
+}
+
+// LoadRepeatableMigrations parses the repeatable migrations in the
+// repeatable subdirectory of dir, ordered by name. A repeatable migration
+// is a .sql file without versions or a down section, e.g. views,
+// functions or grants written with CREATE OR REPLACE, and applied again
+// whenever it changes. A missing directory has none.
+func LoadRepeatableMigrations(dir string) ([]*Migration, error) {
+	dir = filepath.Join(dir, RepeatableDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRepeatables(entries, func(name string) (string, []byte, error) {
+		path := filepath.Join(dir, name)
+		content, err := readFile(path)
+		return path, content, err
+	})
+}
+
+// loadRepeatablesFS is LoadRepeatableMigrations for the directory dir of
+// fsys.
+func loadRepeatablesFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	dir = path.Join(path.Clean(dir), RepeatableDir)
+	entries, err := fs.ReadDir(fsys, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRepeatables(entries, func(name string) (string, []byte, error) {
+		p := path.Join(dir, name)
+		content, err := fs.ReadFile(fsys, p)
+		return p, content, err
+	})
+}
+
+func parseRepeatables(entries []fs.DirEntry, read func(name string) (path string, content []byte, err error)) ([]*Migration, error) {
+	var repeatables []*Migration
+	for _, e := range entries {
+		if e.IsDir() || !isSQLFile(e.Name()) {
+			continue
+		}
+		path, content, err := read(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if content, err = decompress(e.Name(), content); err != nil {
+			return nil, err
+		}
+		if strings.Contains(string(content), "-- +down") {
+			return nil, fmt.Errorf("repeatable migration %s can't have a '-- +down' section", e.Name())
+		}
+		hash := sha256.Sum256(content)
+		m, err := newRepeatable(strings.TrimSuffix(strings.TrimSuffix(e.Name(), gzipSuffix), ".sql"), path, string(content), hex.EncodeToString(hash[:]))
+		if err != nil {
+			return nil, err
+		}
+		repeatables = append(repeatables, m)
+	}
+	return repeatables, nil // ReadDir sorts by file name
+}
+
+// newRepeatable returns the repeatable migration name with the SQL text.
+func newRepeatable(name, path, text, checksum string) (*Migration, error) {
+	up := strings.ReplaceAll(text, "-- +up", "")
+	leading := len(up) - len(strings.TrimLeft(up, " \t\r\n"))
+	m := &Migration{
+		Name:          name,
+		Path:          path,
+		Checksum:      checksum,
+		Transactional: true,
+		Repeatable:    true,
+		upLine:        1 + strings.Count(up[:leading], "\n"),
+	}
+	up = m.cutVerify(up)
+	m.UpSQL = strings.TrimSpace(up)
+	return m, m.parseDirectives(up)
+}
+
+// loadRepeatables reads the repeatable migration files and their
+// bookkeeping rows, keyed by name.
+func (mg *Migrator) loadRepeatables(ctx context.Context) ([]*Migration, map[string]RepeatableRecord, error) {
+	var repeatables []*Migration
+	for _, dir := range mg.dirs() {
+		var found []*Migration
+		var err error
+		switch {
+		case mg.opts.FS != nil && mg.opts.Flyway:
+			err = errors.New("Flyway migrations can't be read from Options.FS")
+		case mg.opts.FS != nil:
+			found, err = loadRepeatablesFS(mg.opts.FS, dir)
+		case mg.opts.Flyway:
+			found, err = loadFlywayRepeatables(dir)
+		default:
+			found, err = LoadRepeatableMigrations(dir)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load repeatable migrations: %w", err)
+		}
+		repeatables = append(repeatables, found...)
+	}
+	// Repeatables are tracked by name, so sources can't share one
+	slices.SortStableFunc(repeatables, func(a, b *Migration) int { return strings.Compare(a.Name, b.Name) })
+	for i := 1; i < len(repeatables); i++ {
+		if prev, m := repeatables[i-1], repeatables[i]; prev.Name == m.Name {
+			return nil, nil, fmt.Errorf("duplicate repeatable migration %s: %s and %s", m.Name, prev.Path, m.Path)
+		}
+	}
+	if len(repeatables) == 0 {
+		return nil, nil, nil
+	}
+	for _, m := range repeatables {
+		if err := mg.prepare(m); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rr, ok := mg.drv.(RepeatableReader)
+	if !ok {
+		return nil, nil, errors.New("driver can't track repeatable migrations")
+	}
+	rows, err := rr.RepeatableRecords(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read repeatable migration history: %w", err)
+	}
+	records := make(map[string]RepeatableRecord, len(rows))
+	for _, r := range rows {
+		records[r.Name] = r
+	}
+	return repeatables, records, nil
+}
+
+// planRepeatables returns the repeatable migrations that are new or
+// changed since they were last applied, to run after the versioned
+// migrations of a run up to target. There are none while versioned
+// migrations past target stay pending, as the schema they are written
+// against may not exist yet.
+func (mg *Migrator) planRepeatables(ctx context.Context, migrations []*Migration, records map[int64]Record, target int64) ([]PlannedMigration, error) {
+	if mg.noRepeatables {
+		return nil, nil
+	}
+	for _, m := range migrations {
+		if r := records[m.Version]; m.Version > target && !r.Done() {
+			return nil, nil
+		}
+	}
+	repeatables, applied, err := mg.loadRepeatables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []PlannedMigration
+	for _, m := range repeatables {
+		r, ok := applied[m.Name]
+		if ok && r.Checksum == m.Checksum {
+			continue
+		}
+		p := PlannedMigration{
+			Name:          m.Name,
+			Direction:     DirectionUp,
+			SQL:           m.UpSQL,
+			Verify:        m.VerifySQL,
+			Checksum:      m.Checksum,
+			Transactional: m.Transactional,
+			Repeatable:    true,
+			migration:     m,
+		}
+		if ok {
+			p.Warnings = append(p.Warnings, "repeatable migration changed since it was last applied; it runs again")
+		}
+		if !m.Transactional {
+			p.Warnings = append(p.Warnings, "runs outside a transaction; a failure may leave it partly applied until the next run")
+		}
+		plan = append(plan, p)
+	}
+	plan, _ = mg.filterTags(mg.scope(plan))
+	return plan, nil
+}
+
+// applyRepeatable runs the repeatable migration p and records its
+// checksum, inside tx in an atomic run. A failure keeps the previous
+// record, so the migration runs again on the next run.
+func (mg *Migrator) applyRepeatable(ctx context.Context, sess Session, tx Tx, p PlannedMigration) (int64, error) {
+	mg.log().Info("Applying repeatable migration", "name", p.Name)
+	began := mg.now()
+
+	if tx == nil && !p.Transactional {
+		rows, err := mg.execRepeatable(ctx, sess, p, began)
+		if err != nil {
+			mg.auditFailure(ctx, sess, p.migration, HistoryApply, began, err)
+		}
+		return rows, err
+	}
+	atomic := tx != nil
+	if !atomic {
+		var err error
+		if tx, err = sess.Begin(ctx); err != nil {
+			return 0, err
+		}
+	}
+	rows, err := mg.execRepeatable(ctx, tx, p, began)
+	if err != nil {
+		tx.Rollback()
+		mg.auditFailure(ctx, sess, p.migration, HistoryApply, began, err)
+		return 0, err
+	}
+	if atomic {
+		return rows, nil
+	}
+	return rows, tx.Commit()
+}
+
+// execRepeatable runs p through e and records it there.
+func (mg *Migrator) execRepeatable(ctx context.Context, e Execer, p PlannedMigration, began time.Time) (int64, error) {
+	rows, err := mg.execMigration(ctx, e, p)
+	if err != nil {
+		return rows, err
+	}
+	w, ok := e.(RepeatableWriter)
+	if !ok {
+		return rows, errors.New("driver can't track repeatable migrations")
+	}
+	now := mg.now()
+	if err := w.SaveRepeatable(ctx, RepeatableRecord{Name: p.Name, Checksum: p.Checksum, AppliedAt: now, Duration: now.Sub(began)}); err != nil {
+		return rows, fmt.Errorf("failed to record repeatable migration %s: %w", p.Name, err)
+	}
+	if err := mg.audit(ctx, e, p.migration, HistoryApply, began, nil); err != nil {
+		return rows, fmt.Errorf("failed to record history of repeatable migration %s: %w", p.Name, err)
+	}
+	return rows, nil
+}
+
+// RepeatableInfo pairs a repeatable migration file with its bookkeeping
+// row.
+type RepeatableInfo struct {
+	*Migration
+	Record *RepeatableRecord // nil when the migration was never applied
+}
+
+// Pending reports whether the migration is new or changed since it was
+// last applied.
+func (i RepeatableInfo) Pending() bool {
+	return i.Record == nil || i.Record.Checksum != i.Checksum
+}
+
+// Repeatables returns the state of every repeatable migration file,
+// ordered by name.
+func (mg *Migrator) Repeatables(ctx context.Context) ([]RepeatableInfo, error) {
+	repeatables, records, err := mg.loadRepeatables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]RepeatableInfo, 0, len(repeatables))
+	for _, m := range repeatables {
+		info := RepeatableInfo{Migration: m}
+		if r, ok := records[m.Name]; ok {
+			info.Record = &r
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// repeatableTable returns the name of the table tracking repeatable
+// migrations, qualified with the schema.
+func (p *Postgres) repeatableTable() string {
+	return p.qualify("schema_repeatable_migrations")
+}
+
+func (p *Postgres) initRepeatable(ctx context.Context, e execer) error {
+	_, err := e.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS `+p.repeatableTable()+` (
+			name TEXT PRIMARY KEY,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL,
+			duration_ms BIGINT
+		);
+	`)
+	return err
+}
+
+// RepeatableRecords reports a missing table as no rows, like Records.
+func (p *Postgres) RepeatableRecords(ctx context.Context) ([]RepeatableRecord, error) {
+	if p.flyway {
+		return p.flywayRepeatableRecords(ctx)
+	}
+	var exists bool
+	if err := p.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, p.repeatableTable()).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT name, checksum, applied_at, COALESCE(duration_ms, 0) FROM `+p.repeatableTable()+` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []RepeatableRecord
+	for rows.Next() {
+		var r RepeatableRecord
+		var durationMS int64
+		if err := rows.Scan(&r.Name, &r.Checksum, &r.AppliedAt, &durationMS); err != nil {
+			return nil, err
+		}
+		r.Duration = time.Duration(durationMS) * time.Millisecond
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (p pgExecer) SaveRepeatable(ctx context.Context, r RepeatableRecord) error {
+	if p.flyway {
+		return p.saveFlywayRepeatable(ctx, r)
+	}
+	_, err := p.e.ExecContext(ctx, `INSERT INTO `+p.repeatable+` (name, checksum, applied_at, duration_ms)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		ON CONFLICT (name) DO UPDATE
+		SET checksum = EXCLUDED.checksum, applied_at = EXCLUDED.applied_at, duration_ms = EXCLUDED.duration_ms`,
+		r.Name, r.Checksum, r.AppliedAt, r.Duration.Milliseconds())
+	return err
+}
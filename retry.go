@@ -0,0 +1,67 @@
+package migo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// DefaultRetryCodes are the SQLSTATEs a RetryPolicy without Codes retries:
+// deadlock_detected, lock_not_available and serialization_failure.
+var DefaultRetryCodes = []string{"40P01", "55P03", "40001"}
+
+// RetryPolicy retries migrations failing with a transient error, such as a
+// deadlock with application traffic, instead of failing the run. Only
+// migrations running in their own transaction are retried, since a failed
+// one left nothing behind; atomic runs are never retried.
+type RetryPolicy struct {
+	// Attempts is how many times a migration is tried in total. Values
+	// below 2 disable retrying.
+	Attempts int
+	// Backoff is the wait before the first retry, doubled before every
+	// further one.
+	Backoff time.Duration
+	// Codes are the SQLSTATEs retried. Defaults to DefaultRetryCodes.
+	Codes []string
+}
+
+// transient returns the SQLSTATE of err, and whether it is one r retries.
+// Errors report their SQLSTATE with a SQLState method, as those of lib/pq
+// and pgx do.
+func (r RetryPolicy) transient(err error) (string, bool) {
+	var s interface{ SQLState() string }
+	if !errors.As(err, &s) {
+		return "", false
+	}
+	codes := r.Codes
+	if len(codes) == 0 {
+		codes = DefaultRetryCodes
+	}
+	return s.SQLState(), slices.Contains(codes, s.SQLState())
+}
+
+// withRetry runs fn, which applies or rolls back p, again while it fails
+// with a transient error and Options.Retry allows another attempt.
+func (mg *Migrator) withRetry(ctx context.Context, p PlannedMigration, fn func() (int64, error)) (int64, error) {
+	r := mg.opts.Retry
+	backoff := r.Backoff
+	for attempt := 1; ; attempt++ {
+		rows, err := fn()
+		if err == nil || !p.Transactional || attempt >= r.Attempts {
+			return rows, err
+		}
+		code, ok := r.transient(err)
+		if !ok {
+			return rows, err
+		}
+		mg.log().Warn("Retrying migration after transient error", "version", p.Version, "name", p.Name,
+			"attempt", attempt+1, "attempts", r.Attempts, "sqlstate", code, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return rows, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,200 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scripter is implemented by drivers that can write the statements of a
+// run to a SQL script instead of executing them.
+type Scripter interface {
+	// ScriptSession returns a Session appending every statement it runs,
+	// bookkeeping included, to w. The statements creating the bookkeeping
+	// tables are written first.
+	ScriptSession(ctx context.Context, w io.Writer) (Session, error)
+}
+
+// Script writes the migrations UpTo(version) would apply to w as a
+// standalone SQL script, for databases migo can't be given write access
+// to. Transactional migrations are wrapped in BEGIN and COMMIT together
+// with their bookkeeping rows, so running the script by hand leaves the
+// history as Up would. The database is only read, to know what is
+// pending. Script returns the number of migrations written.
+func (mg *Migrator) Script(ctx context.Context, w io.Writer, version int64) (int, error) {
+	sc, ok := mg.drv.(Scripter)
+	if !ok {
+		return 0, errors.New("driver can't write migration scripts")
+	}
+	plan, err := mg.PlanTo(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range plan {
+		if p.migration.BatchSize > 0 {
+			return 0, fmt.Errorf("%s runs in batches, which a script can't repeat; apply it with up", filepath.Base(p.migration.Path))
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "-- Generated by migo script: %d migration(s).\n-- Run it with psql -v ON_ERROR_STOP=1 so it stops at the first error.\n\n", len(plan)); err != nil {
+		return 0, err
+	}
+	sess, err := sc.ScriptSession(ctx, w)
+	if err != nil {
+		return 0, err
+	}
+
+	// The run executes against the script, one migration after the other:
+	// nothing to log or report, but every migration gets a header.
+	opts := mg.opts
+	opts.Logger = slog.New(slog.DiscardHandler)
+	opts.Parallel = 0
+	opts.OnEvent = func(e Event) {
+		if e.Kind != EventMigrationStarted {
+			return
+		}
+		p := plan[e.Index-1]
+		if p.Repeatable {
+			fmt.Fprintf(w, "\n-- Repeatable: %s\n", p.Name)
+		} else {
+			fmt.Fprintf(w, "\n-- Version %d: %s\n", p.Version, p.Name)
+		}
+		for _, warning := range p.Warnings {
+			fmt.Fprintf(w, "-- WARNING: %s\n", warning)
+		}
+	}
+	s := &Migrator{drv: scriptDriver{mg.drv, sess}, opts: opts}
+	return len(plan), s.run(ctx, DirectionUp, plan)
+}
+
+// scriptDriver hands out the script session of a Script run. It hides the
+// optional interfaces of the driver, so the run doesn't inspect the live
+// database.
+type scriptDriver struct {
+	Driver
+	sess Session
+}
+
+func (d scriptDriver) Session(context.Context) (Session, error) {
+	return d.sess, nil
+}
+
+// sqlScript is an execer writing statements to w, with their parameters
+// inlined as literals. Timestamps become now(), the time the script runs.
+type sqlScript struct {
+	w   io.Writer
+	err error // first write error, returned by every later statement
+}
+
+var reParam = regexp.MustCompile(`\$(\d+)`)
+
+func (s *sqlScript) ExecContext(_ context.Context, query string, args ...any) (sql.Result, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(args) > 0 {
+		query = reParam.ReplaceAllStringFunc(query, func(p string) string {
+			i, _ := strconv.Atoi(p[1:])
+			return sqlLiteral(args[i-1])
+		})
+	}
+	_, s.err = io.WriteString(s.w, scriptStatement(query))
+	return driver.RowsAffected(0), s.err
+}
+
+// scriptStatement returns query dedented and terminated for a script. The
+// semicolon goes on a line of its own when the last line ends in a
+// comment.
+func scriptStatement(query string) string {
+	lines := strings.Split(strings.Trim(query, "\n"), "\n")
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, l := range lines {
+		if len(l) >= indent {
+			lines[i] = l[indent:]
+		}
+	}
+	stmt := strings.TrimRight(strings.Join(lines, "\n"), " \t\n;")
+	last := stmt[strings.LastIndexByte(stmt, '\n')+1:]
+	if strings.Contains(last, "--") {
+		return stmt + "\n;\n"
+	}
+	return stmt + ";\n"
+}
+
+// sqlLiteral renders v as a SQL literal.
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return "now()"
+	}
+	return sqlLiteral(fmt.Sprint(v))
+}
+
+// ScriptSession writes the statements Init and Session would run on the
+// database, search_path of the tenant schema included.
+func (p *Postgres) ScriptSession(ctx context.Context, w io.Writer) (Session, error) {
+	s := &sqlScript{w: w}
+	if err := p.init(ctx, s); err != nil {
+		return nil, err
+	}
+	if p.schema != "" {
+		if _, err := s.ExecContext(ctx, `SELECT set_config('search_path', $1, false)`, quoteIdent(p.schema)+", public"); err != nil {
+			return nil, err
+		}
+	}
+	return &pgScriptSession{pgExecer{s, p.table(), p.historyTable(), p.repeatableTable(), p.flyway}}, nil
+}
+
+type pgScriptSession struct {
+	pgExecer
+}
+
+func (s *pgScriptSession) Begin(ctx context.Context) (Tx, error) {
+	if err := s.Exec(ctx, "BEGIN"); err != nil {
+		return nil, err
+	}
+	return &pgScriptTx{s.pgExecer}, nil
+}
+
+func (s *pgScriptSession) Close() error { return nil }
+
+type pgScriptTx struct {
+	pgExecer
+}
+
+func (t *pgScriptTx) Commit() error {
+	return t.Exec(context.Background(), "COMMIT")
+}
+
+// Rollback writes nothing: the script stops at the first error, and an
+// open transaction is rolled back when the connection ends.
+func (t *pgScriptTx) Rollback() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package migo
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+)
+
+// ServerInfo describes the server a run executed against and the session
+// settings in effect, so a run that behaved differently in one environment
+// can be explained afterwards.
+type ServerInfo struct {
+	Version  string            // server_version, e.g. "16.4"
+	Host     string            // address:port of the server, or "local" over a Unix socket
+	Database string            // current database
+	Settings map[string]string // lock_timeout, statement_timeout and search_path
+}
+
+// ServerInspector is implemented by sessions that can describe their
+// server.
+type ServerInspector interface {
+	ServerInfo(ctx context.Context) (*ServerInfo, error)
+}
+
+// auditSettings are the settings recorded with every run.
+var auditSettings = []string{"lock_timeout", "statement_timeout", "search_path"}
+
+// serverInfo describes the server of sess once the before_all hook ran, so
+// settings it changed are recorded. Runs don't fail for lack of it.
+func (mg *Migrator) serverInfo(ctx context.Context, sess Session) *ServerInfo {
+	si, ok := sess.(ServerInspector)
+	if !ok {
+		return nil
+	}
+	info, err := si.ServerInfo(ctx)
+	if err != nil {
+		mg.log().Warn("Failed to inspect the server", "err", err)
+		return nil
+	}
+	args := []any{"version", info.Version, "host", info.Host, "database", info.Database}
+	for _, name := range auditSettings {
+		args = append(args, name, info.Settings[name])
+	}
+	mg.log().Info("Connected to server", args...)
+	return info
+}
+
+func (s *pgSession) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	info := &ServerInfo{Settings: map[string]string{}}
+	var addr sql.NullString
+	var port sql.NullInt64
+	err := s.conn.QueryRowContext(ctx, `SELECT current_setting('server_version'), host(inet_server_addr()), inet_server_port(), current_database()`).
+		Scan(&info.Version, &addr, &port, &info.Database)
+	if err != nil {
+		return nil, err
+	}
+	info.Host = "local"
+	if addr.Valid {
+		info.Host = net.JoinHostPort(addr.String, strconv.FormatInt(port.Int64, 10))
+	}
+	for _, name := range auditSettings {
+		var value string
+		if err := s.conn.QueryRowContext(ctx, `SELECT current_setting($1)`, name).Scan(&value); err != nil {
+			return nil, err
+		}
+		info.Settings[name] = value
+	}
+	return info, nil
+}
@@ -0,0 +1,282 @@
+package migo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Squash replaces every migration file in dir with a version in [from, to]
+// by a single file carrying the combined up and down sections, and returns
+// its path. The new file reuses the last version of the range so it keeps
+// its place relative to newer migrations, and lists the replaced versions in
+// a "-- +squashes" directive so databases that applied the originals can
+// have their bookkeeping rewritten on their next run.
+func Squash(dir string, from, to int64, name string) (string, error) {
+	return FilenameFormat{}.Squash(dir, from, to, name)
+}
+
+// Squash is the package's Squash for files named f.
+func (f FilenameFormat) Squash(dir string, from, to int64, name string) (string, error) {
+	migrations, err := f.LoadMigrations(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	var selected []*Migration
+	for _, m := range migrations {
+		if m.Version >= from && m.Version <= to {
+			selected = append(selected, m)
+		}
+	}
+	if len(selected) < 2 {
+		return "", fmt.Errorf("nothing to squash: found %d migration(s) between %d and %d", len(selected), from, to)
+	}
+	// These directives hold for a single file, but would apply to every
+	// statement of the squash.
+	for _, m := range selected {
+		for _, d := range []struct {
+			name string
+			set  bool
+		}{
+			{"batch", m.BatchSize > 0},
+			{"statement_timeout", m.StatementTimeout != ""},
+			{"lock_timeout", m.LockTimeout != ""},
+			{"tags", len(m.Tags) > 0},
+		} {
+			if d.set {
+				return "", fmt.Errorf("can't squash %d_%s: its '-- +%s' directive would apply to the whole squash; leave it out of the range", m.Version, m.Name, d.name)
+			}
+		}
+	}
+
+	last := selected[len(selected)-1]
+	if name == "" {
+		name = fmt.Sprintf("squash_%d_%d", selected[0].Version, last.Version)
+	}
+	safeName := strings.ReplaceAll(name, " ", "_")
+	// The row of the last version is rewritten once its name is the
+	// squash's, so a squash named like an original would look reconciled.
+	for _, m := range selected {
+		if m.Name == safeName {
+			return "", fmt.Errorf("can't name the squash %q: %d_%s in the range has that name", safeName, m.Version, m.Name)
+		}
+	}
+
+	squashed := map[int64]bool{}
+	for _, m := range selected {
+		squashed[m.Version] = true
+		for _, v := range m.Squashes {
+			squashed[v] = true
+		}
+	}
+
+	// An earlier squash in the range keeps its versions on a line of their
+	// own, since databases that reconciled it only have a row for its last
+	// version; the other migrations share the last line.
+	var squashes, rest string
+	var dependsOn []string
+	var up, verify, down strings.Builder
+	for _, m := range selected {
+		if len(m.Squashes) == 0 {
+			rest += fmt.Sprintf(" %d", m.Version)
+		} else {
+			squashes += "-- +squashes"
+			for _, v := range m.Squashes {
+				squashes += fmt.Sprintf(" %d", v)
+			}
+			if !slices.Contains(m.Squashes, m.Version) {
+				squashes += fmt.Sprintf(" %d", m.Version)
+			}
+			squashes += "\n"
+		}
+		// Dependencies inside the range are met by the order of the
+		// combined up section; the others become the squash's own. One
+		// file being safe to run in parallel doesn't make the squash so.
+		for _, v := range m.DependsOn {
+			if dep := fmt.Sprintf("%d", v); !squashed[v] && !slices.Contains(dependsOn, dep) {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+		fmt.Fprintf(&up, "-- %d_%s\n%s\n\n", m.Version, m.Name, stripDirectives(m.UpSQL, "-- +squashes", "-- +depends_on", "-- +parallel"))
+		if m.VerifySQL != "" {
+			fmt.Fprintf(&verify, "-- %d_%s\n%s\n\n", m.Version, m.Name, m.VerifySQL)
+		}
+	}
+	if verify.Len() > 0 {
+		// Every assertion of the range is checked once the combined up
+		// section ran.
+		fmt.Fprintf(&up, "-- +verify\n%s", verify.String())
+	}
+	for i := len(selected) - 1; i >= 0; i-- {
+		m := selected[i]
+		fmt.Fprintf(&down, "-- %d_%s\n%s\n\n", m.Version, m.Name, m.DownSQL)
+	}
+
+	if rest != "" {
+		squashes += "-- +squashes" + rest + "\n"
+	}
+
+	var header string
+	if len(dependsOn) > 0 {
+		header = "-- +depends_on " + strings.Join(dependsOn, " ") + "\n"
+	}
+	irreversible := false
+	for _, m := range selected {
+		if !m.Transactional && !strings.Contains(header, "-- +notransaction\n") {
+			header += "-- +notransaction\n"
+		}
+		irreversible = irreversible || m.Irreversible
+	}
+
+	content := fmt.Sprintf("-- +up\n%s%s%s-- +down\n%s",
+		header, squashes, up.String(), strings.TrimRight(down.String(), "\n")+"\n")
+	if irreversible {
+		// The squash can only be rolled back as a whole, so not at all.
+		content = fmt.Sprintf("-- +up\n%s-- +irreversible\n%s%s",
+			header, squashes, strings.TrimRight(up.String(), "\n")+"\n")
+	}
+
+	path := filepath.Join(dir, f.filename(fmt.Sprintf("%0*d", f.Width, last.Version), safeName))
+	// Write the squashed file first so an interrupted squash never loses
+	// migrations; the file it replaces, if any, is swapped in one rename.
+	if err := WriteFileAtomic(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write squashed migration: %w", err)
+	}
+	for _, m := range selected {
+		if m.Path == path {
+			continue
+		}
+		if err := os.Remove(m.Path); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %w", m.Path, err)
+		}
+	}
+	return path, nil
+}
+
+// stripDirectives returns sql without the lines carrying one of
+// directives, e.g. "-- +depends_on".
+func stripDirectives(sql string, directives ...string) string {
+	lines := strings.Split(sql, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !slices.ContainsFunc(directives, func(d string) bool { return strings.HasPrefix(trimmed, d) }) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// unreconciledSquashes returns the squashed migrations whose original
+// migrations were applied before the squash. The squashed file reuses the
+// last version of its range, so a row for that version under another name
+// means the bookkeeping still describes the originals, which is only
+// reconciled once every one of them is done. Fresh databases have no such
+// row and simply run the squashed migration.
+func unreconciledSquashes(migrations []*Migration, records map[int64]Record) ([]*Migration, error) {
+	var pending []*Migration
+	for _, m := range migrations {
+		if len(m.Squashes) == 0 {
+			continue
+		}
+
+		r, ok := records[m.Version]
+		if ok && r.Name == m.Name {
+			continue // already reconciled
+		}
+		if !ok || !r.Done() {
+			for _, v := range m.Squashes {
+				if _, partial := records[v]; partial {
+					return nil, fmt.Errorf("migration %d_%s squashes versions that are only partially applied; apply the original migrations before adopting the squash", m.Version, m.Name)
+				}
+			}
+			continue
+		}
+		var missing []string
+		for _, v := range m.Squashes {
+			if into, ok := m.folded[v]; ok && into != m.Version && records[into].Done() {
+				continue // an earlier squash already folded its row into that of into
+			}
+			if r, ok := records[v]; !ok || !r.Done() {
+				missing = append(missing, strconv.FormatInt(v, 10))
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("migration %d_%s squashes versions that are not applied: %s; apply the original migrations before adopting the squash", m.Version, m.Name, strings.Join(missing, ", "))
+		}
+		pending = append(pending, m)
+	}
+	return pending, nil
+}
+
+// squashedView rewrites records in memory the way reconcileSquashed rewrites
+// the table, so read-only callers see the same history.
+func squashedView(records map[int64]Record, pending []*Migration) {
+	for _, m := range pending {
+		appliedAt := records[m.Version].AppliedAt
+		for _, v := range m.Squashes {
+			delete(records, v)
+		}
+		records[m.Version] = Record{
+			Version:            m.Version,
+			Name:               m.Name,
+			Checksum:           m.Checksum,
+			Status:             StatusApplied,
+			AppliedAt:          appliedAt,
+			ValidationChecksum: m.validation,
+		}
+	}
+}
+
+// reconcileSquashed replaces the rows of the original migrations of each
+// pending squash by a single row for the squashed migration.
+func (mg *Migrator) reconcileSquashed(ctx context.Context, migrations []*Migration, records map[int64]Record) error {
+	pending, err := unreconciledSquashes(migrations, records)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	sess, err := mg.drv.Session(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	for _, m := range pending {
+		tx, err := sess.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range append([]int64{m.Version}, m.Squashes...) {
+			if err := tx.DeleteRecord(ctx, v); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.SaveRecord(ctx, mg.newRecord(m, StatusApplied)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := mg.audit(ctx, tx, m, HistorySquash, time.Time{}, nil); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		mg.log().Info("Reconciled squashed migration", "version", m.Version, "name", m.Name)
+	}
+
+	squashedView(records, pending)
+	return nil
+}
@@ -0,0 +1,154 @@
+package migo
+
+import "strings"
+
+// Statement is a single SQL statement of a migration section.
+type Statement struct {
+	SQL  string // statement text as written, without the trailing semicolon
+	Line int    // 1-based line of the statement within its section
+
+	code string // SQL with comments removed and whitespace outside literals collapsed
+}
+
+// splitStatements splits sql on semicolons that are not inside quotes,
+// dollar-quoted bodies or comments. Statements consisting only of comments
+// are dropped.
+func splitStatements(sql string) []Statement {
+	var stmts []Statement
+	var raw, code strings.Builder
+	line, start := 1, 1
+	started, space := false, false
+
+	// emit adds s to the code of the statement, after a single space when
+	// whitespace or a comment came before it. Literals are added as they
+	// are, so changing the data they hold still changes the statement.
+	emit := func(s string) {
+		if space && code.Len() > 0 {
+			code.WriteByte(' ')
+		}
+		space = false
+		code.WriteString(s)
+	}
+
+	flush := func() {
+		text := strings.TrimSpace(raw.String())
+		c := code.String()
+		if c != "" {
+			stmts = append(stmts, Statement{SQL: text, Line: start, code: c})
+		}
+		raw.Reset()
+		code.Reset()
+		started, space = false, false
+	}
+
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+
+		// Statements start at their first non-space character.
+		if !started && !isSpace(ch) {
+			started, start = true, line
+		}
+
+		switch {
+		case ch == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			raw.WriteString(sql[i : i+end])
+			space = true
+			i += end
+			continue
+
+		case ch == '/' && strings.HasPrefix(sql[i:], "/*"):
+			// Block comments nest in PostgreSQL.
+			depth, j := 1, i+2
+			for j < len(sql) && depth > 0 {
+				switch {
+				case strings.HasPrefix(sql[j:], "/*"):
+					depth, j = depth+1, j+2
+				case strings.HasPrefix(sql[j:], "*/"):
+					depth, j = depth-1, j+2
+				default:
+					j++
+				}
+			}
+			line += strings.Count(sql[i:j], "\n")
+			raw.WriteString(sql[i:j])
+			space = true
+			i = j
+			continue
+
+		case ch == '\'' || ch == '"':
+			j := i + 1
+			for j < len(sql) {
+				if sql[j] == ch {
+					if j+1 < len(sql) && sql[j+1] == ch {
+						j += 2 // doubled quote escapes itself
+						continue
+					}
+					break
+				}
+				j++
+			}
+			j = min(j+1, len(sql))
+			line += strings.Count(sql[i:j], "\n")
+			raw.WriteString(sql[i:j])
+			emit(sql[i:j])
+			i = j
+			continue
+
+		case ch == '$':
+			if tag, ok := dollarTag(sql[i:]); ok {
+				end := strings.Index(sql[i+len(tag):], tag)
+				j := len(sql)
+				if end >= 0 {
+					j = i + len(tag) + end + len(tag)
+				}
+				line += strings.Count(sql[i:j], "\n")
+				raw.WriteString(sql[i:j])
+				emit(sql[i:j])
+				i = j
+				continue
+			}
+
+		case ch == ';':
+			flush()
+			i++
+			continue
+		}
+
+		if ch == '\n' {
+			line++
+		}
+		raw.WriteByte(ch)
+		if isSpace(ch) {
+			space = true
+		} else {
+			emit(sql[i : i+1])
+		}
+		i++
+	}
+	flush()
+	return stmts
+}
+
+// dollarTag returns the opening tag of a dollar-quoted string at the start
+// of s, such as "$$" or "$body$".
+func dollarTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case c == '$':
+			return s[:j+1], true
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 1 && c >= '0' && c <= '9':
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
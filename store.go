@@ -0,0 +1,57 @@
+package migo
+
+import "time"
+
+// Migration statuses recorded in schema_migrations.
+const (
+	StatusApplied  = "applied"  // ran successfully
+	StatusSkipped  = "skipped"  // intentionally not run, treated as done
+	StatusFailed   = "failed"   // last attempt failed and was rolled back, retried on next run
+	StatusDirty    = "dirty"    // failed partway, blocks further runs until resolved
+	StatusDeferred = "deferred" // postponed, picked up again on the next run
+	StatusBaseline = "baseline" // baseline recorded by another tool; it and every earlier version are done
+)
+
+// Record is a row of schema_migrations.
+type Record struct {
+	Version   int64
+	Name      string
+	Checksum  string // SHA256 of the migration file
+	Status    string
+	AppliedAt time.Time
+	// ValidationChecksum is the checksum under the Options.Checksum mode
+	// the migration was recorded with, empty for ChecksumFile.
+	ValidationChecksum string
+	// Duration is how long the migration took to apply, zero when unknown,
+	// e.g. for baselined migrations.
+	Duration time.Duration
+	// AppliedBy records who or what wrote the row, empty for rows written
+	// before it was recorded.
+	AppliedBy Provenance
+}
+
+// Done reports whether the migration needs no further work.
+func (r Record) Done() bool {
+	return r.Status == StatusApplied || r.Status == StatusSkipped || r.Status == StatusBaseline
+}
+
+// newRecord returns the bookkeeping row for m with the given status.
+func (mg *Migrator) newRecord(m *Migration, status string) Record {
+	return Record{
+		Version:            m.Version,
+		Name:               m.Name,
+		Checksum:           m.Checksum,
+		Status:             status,
+		AppliedAt:          mg.now(),
+		ValidationChecksum: m.validation,
+		AppliedBy:          mg.opts.AppliedBy,
+	}
+}
+
+// appliedRecord returns the bookkeeping row of p applied successfully
+// after running since began.
+func (mg *Migrator) appliedRecord(p PlannedMigration, began time.Time) Record {
+	r := mg.newRecord(p.migration, StatusApplied)
+	r.Duration = r.AppliedAt.Sub(began)
+	return r
+}
@@ -0,0 +1,69 @@
+package migo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TagFilter selects migrations by the tags of their "-- +tags" directive.
+// The zero value selects every migration.
+type TagFilter struct {
+	Only    []string // when set, only migrations with one of these tags
+	Exclude []string // migrations with one of these tags are left out
+}
+
+// Match reports whether f selects m.
+func (f TagFilter) Match(m *Migration) bool {
+	has := func(tag string) bool { return slices.Contains(m.Tags, tag) }
+	if slices.ContainsFunc(f.Exclude, has) {
+		return false
+	}
+	return len(f.Only) == 0 || slices.ContainsFunc(f.Only, has)
+}
+
+// filterTags splits plan into the migrations Options.Tags selects and
+// the ones it leaves out.
+func (mg *Migrator) filterTags(plan []PlannedMigration) (selected, deferred []PlannedMigration) {
+	for _, p := range plan {
+		if mg.opts.Tags.Match(p.migration) {
+			selected = append(selected, p)
+		} else {
+			deferred = append(deferred, p)
+		}
+	}
+	return selected, deferred
+}
+
+// recordDeferred records the migrations a tag filter left out of a run as
+// deferred, so the decision shows up in the history while they stay
+// pending for the next run. Migrations already deferred aren't recorded
+// again.
+func (mg *Migrator) recordDeferred(ctx context.Context, deferred []PlannedMigration, records map[int64]Record) error {
+	var todo []PlannedMigration
+	for _, p := range deferred {
+		if records[p.Version].Status != StatusDeferred {
+			todo = append(todo, p)
+		}
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+
+	sess, err := mg.drv.Session(ctx)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	for _, p := range todo {
+		mg.log().Info("Deferring migration left out by tag filter", "version", p.Version, "name", p.Name, "tags", p.migration.Tags)
+		if err := sess.SaveRecord(ctx, mg.newRecord(p.migration, StatusDeferred)); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", p.Version, err)
+		}
+		if err := mg.audit(ctx, sess, p.migration, HistoryDefer, time.Time{}, nil); err != nil {
+			return fmt.Errorf("failed to record history of migration %d: %w", p.Version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package migo
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// renderTemplate executes the up, verify and down sections of m as Go templates
+// with vars as data, e.g. {{ .schema }}. Referencing a missing variable is
+// an error. As with interpolation, the checksum describes the raw file.
+func renderTemplate(m *Migration, vars map[string]string) error {
+	render := func(section, text string) (string, error) {
+		t, err := template.New(fmt.Sprintf("%d_%s.%s", m.Version, m.Name, section)).
+			Option("missingkey=error").
+			Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid template in migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, vars); err != nil {
+			return "", fmt.Errorf("failed to render migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		return b.String(), nil
+	}
+
+	up, err := render("up", m.UpSQL)
+	if err != nil {
+		return err
+	}
+	verify, err := render("verify", m.VerifySQL)
+	if err != nil {
+		return err
+	}
+	down, err := render("down", m.DownSQL)
+	if err != nil {
+		return err
+	}
+	m.UpSQL, m.VerifySQL, m.DownSQL = up, verify, down
+	return nil
+}
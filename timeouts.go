@@ -0,0 +1,41 @@
+package migo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// setTimeouts puts the statement_timeout and lock_timeout directives of p
+// into effect on e, saving the current values in migo.* settings first.
+// The returned func restores them, so neither a later migration of an
+// atomic run nor the rest of the session inherits the directive. Inside a
+// transaction the settings are local to it.
+func setTimeouts(ctx context.Context, e Execer, p PlannedMigration) (func() error, error) {
+	local := strconv.FormatBool(p.Transactional)
+	var set []string
+	for _, s := range [][2]string{{"statement_timeout", p.migration.StatementTimeout}, {"lock_timeout", p.migration.LockTimeout}} {
+		name, value := s[0], s[1]
+		if value == "" {
+			continue
+		}
+		for _, stmt := range []string{
+			fmt.Sprintf("SELECT set_config('migo.%s', current_setting('%s'), %s)", name, name, local),
+			fmt.Sprintf("SELECT set_config('%s', %s, %s)", name, sqlLiteral(value), local),
+		} {
+			if err := e.Exec(ctx, stmt); err != nil {
+				return nil, fmt.Errorf("failed to set %s of migration %d: %w", name, p.Version, err)
+			}
+		}
+		set = append(set, name)
+	}
+
+	return func() error {
+		for _, name := range set {
+			if err := e.Exec(ctx, fmt.Sprintf("SELECT set_config('%s', current_setting('migo.%s'), %s)", name, name, local)); err != nil {
+				return fmt.Errorf("failed to restore %s after migration %d: %w", name, p.Version, err)
+			}
+		}
+		return nil
+	}, nil
+}